@@ -0,0 +1,385 @@
+package newdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// BackupManifestFile the manifest in the backup dir
+	BackupManifestFile = "MANIFEST.json"
+	// BackupCatalogFile the catalog schema in the backup dir, the filenames are relative to the backup dir
+	BackupCatalogFile = "catalog.json"
+	// BackupVersion the current version of backup manifest
+	BackupVersion = 1
+)
+
+// BackupTable one table in the backup
+type BackupTable struct {
+	CatalogSchema
+	// TableID the table id when backup
+	TableID string `json:"table_id"`
+	// Pages the num of pages after the header page
+	Pages int   `json:"pages"`
+	Size  int64 `json:"size"`
+	// CRC32C the crc32c of the whole file
+	CRC32C uint32 `json:"crc32c"`
+}
+
+// BackupManifest describe a backup
+type BackupManifest struct {
+	Version  int           `json:"version"`
+	Created  time.Time     `json:"created"`
+	PageSize int           `json:"page_size"`
+	Tables   []BackupTable `json:"tables"`
+}
+
+// pageSnapshot the copy-on-write snapshot of a HeapFile.
+// before a page is overwritten, its image on disk is kept,
+// so the backup always read the page as it was when the snapshot started
+type pageSnapshot struct {
+	mu       sync.Mutex
+	numPages int
+	// header the header page when the snapshot started, it is rewritten by reserveTxID
+	header []byte
+	// pages the images of pages overwritten since the snapshot started
+	pages map[int][]byte
+	// copied the pages already read by the backup, no need to keep their image
+	copied map[int]bool
+}
+
+// startSnapshot start the copy-on-write snapshot of the header and the pages in file now,
+// after the running writes are done
+func (hf *HeapFile) startSnapshot() (*pageSnapshot, error) {
+	hf.snapMu.Lock()
+	defer hf.snapMu.Unlock()
+	if hf.snap != nil {
+		return nil, fmt.Errorf("backup of %v is in progress", hf.File.Name())
+	}
+	header := make([]byte, DB.B().PageSize())
+	if _, err := hf.File.ReadAt(header, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	hf.snap = &pageSnapshot{
+		numPages: int(hf.NumPagesInFile()),
+		header:   header,
+		pages:    make(map[int][]byte),
+		copied:   make(map[int]bool),
+	}
+	return hf.snap, nil
+}
+
+// endSnapshot drop the kept images
+func (hf *HeapFile) endSnapshot() {
+	hf.snapMu.Lock()
+	defer hf.snapMu.Unlock()
+	hf.snap = nil
+}
+
+// preservePages keep the images of pages [from, from+n) before they are overwritten,
+// the caller must hold the lock of snap
+func (hf *HeapFile) preservePages(snap *pageSnapshot, from, n int) error {
+	for i := from; i < from+n && i < snap.numPages; i++ {
+		if snap.copied[i] || snap.pages[i] != nil {
+			continue
+		}
+		buf := make([]byte, DB.B().PageSize())
+		if _, err := hf.File.ReadAt(buf, hf.pageOffset(i)); err != nil && err != io.EOF {
+			return err
+		}
+		snap.pages[i] = buf
+	}
+	return nil
+}
+
+// writePages write the continuous pages from page from, and sync the file
+func (hf *HeapFile) writePages(from int, buf []byte) error {
+	if err := hf.writePagesAt(from, buf); err != nil {
+		return err
+	}
+	return hf.Sync()
+}
+
+// writePagesAt write the continuous pages from page from without sync,
+// the images are kept if a snapshot is running
+func (hf *HeapFile) writePagesAt(from int, buf []byte) error {
+	hf.snapMu.RLock()
+	defer hf.snapMu.RUnlock()
+	if snap := hf.snap; snap != nil {
+		snap.mu.Lock()
+		defer snap.mu.Unlock()
+		if err := hf.preservePages(snap, from, len(buf)/DB.B().PageSize()); err != nil {
+			return err
+		}
+	}
+	_, err := hf.File.WriteAt(buf, hf.pageOffset(from))
+	return err
+}
+
+// readSnapshotPage read the page as it was when the snapshot started
+func (hf *HeapFile) readSnapshotPage(snap *pageSnapshot, pageNum int, buf []byte) error {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	snap.copied[pageNum] = true
+	if image, ok := snap.pages[pageNum]; ok {
+		copy(buf, image)
+		delete(snap.pages, pageNum)
+		return nil
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+	// the trailing partial page is padded with zero
+	if _, err := hf.File.ReadAt(buf, hf.pageOffset(pageNum)); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// BackupTo write a consistent snapshot of all tables in Catalog into dir, while the writers keep going.
+// the snapshots of all tables start together between the commits, before any page is copied, so the
+// pages of a commit are all in the backup or none of them. the pages written after that are
+// copied on write, and the pages appended are not included.
+// the pages only dirty in BufferPool are not on disk, so they are not included.
+//
+// the dir must not exist, it contains MANIFEST.json, catalog.json and one file per table
+func (db *Database) BackupTo(dir string) (*BackupManifest, error) {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(db.C().Name2ID))
+	for name, id := range db.C().Name2ID {
+		names[id] = name
+	}
+	var files []*HeapFile
+	for _, dbFile := range db.C().TableID2DBFile {
+		hf, ok := dbFile.(*HeapFile)
+		if !ok {
+			return nil, fmt.Errorf("table %v is not HeapFile, can not backup", dbFile.ID())
+		}
+		files = append(files, hf)
+	}
+	sort.Slice(files, func(i, j int) bool { return names[files[i].ID()] < names[files[j].ID()] })
+
+	manifest := &BackupManifest{Version: BackupVersion, Created: time.Now().UTC(), PageSize: db.B().PageSize()}
+	snaps := make([]*pageSnapshot, len(files))
+	defer func() {
+		for i, snap := range snaps {
+			if snap != nil {
+				files[i].endSnapshot()
+			}
+		}
+	}()
+	// the commits write their pages under the latch, so each of them is in all snapshots or none
+	db.T().latch.Lock()
+	for i, hf := range files {
+		snap, err := hf.startSnapshot()
+		if err != nil {
+			db.T().latch.Unlock()
+			return nil, err
+		}
+		snaps[i] = snap
+	}
+	db.T().latch.Unlock()
+
+	seen := make(map[string]bool, len(files))
+	for i, hf := range files {
+		table := BackupTable{TableID: hf.ID()}
+		table.TableName = names[hf.ID()]
+		table.Filename = filepath.Base(hf.File.Name())
+		table.MVCC = hf.MVCC
+		if seen[table.Filename] {
+			return nil, fmt.Errorf("duplicate file name %v in backup", table.Filename)
+		}
+		seen[table.Filename] = true
+		for _, item := range hf.TD.TdItems {
+			info, ok := LookupTypeByName(item.Type.Name)
+			if !ok {
+				return nil, fmt.Errorf("type %v of table %v is not registered", item.Type.Name, table.TableName)
+			}
+			table.TD = append(table.TD, CatalogTDSchema{Name: item.Name, Type: info.SchemaName})
+		}
+		if err := hf.backupTo(snaps[i], filepath.Join(dir, table.Filename), &table); err != nil {
+			return nil, err
+		}
+		hf.endSnapshot()
+		snaps[i] = nil
+		manifest.Tables = append(manifest.Tables, table)
+		dbL.Info("backup table", "table", table.TableName, "pages", table.Pages)
+	}
+
+	catalog := make([]CatalogSchema, len(manifest.Tables))
+	for i, table := range manifest.Tables {
+		catalog[i] = table.CatalogSchema
+	}
+	if err := writeJSONFile(filepath.Join(dir, BackupCatalogFile), catalog); err != nil {
+		return nil, err
+	}
+	// the manifest is written at last, a backup without manifest is incomplete
+	return manifest, writeJSONFile(filepath.Join(dir, BackupManifestFile), manifest)
+}
+
+// backupTo copy the header page and the pages of snapshot to path
+func (hf *HeapFile) backupTo(snap *pageSnapshot, path string, table *BackupTable) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	crc := crc32.New(crc32c)
+	w := io.MultiWriter(f, crc)
+	if _, err = w.Write(snap.header); err != nil {
+		return err
+	}
+	buf := make([]byte, DB.B().PageSize())
+	for i := 0; i < snap.numPages; i++ {
+		if err = hf.readSnapshotPage(snap, i, buf); err != nil {
+			return err
+		}
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+	table.Pages = snap.numPages
+	table.Size = int64(snap.numPages+1) * int64(len(buf))
+	table.CRC32C = crc.Sum32()
+	return f.Sync()
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0644)
+}
+
+// ReadBackupManifest read the manifest of the backup dir
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, BackupManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{}
+	if err = json.Unmarshal(buf, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version != BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %v", manifest.Version)
+	}
+	return manifest, nil
+}
+
+// VerifyBackup check the size, crc32c, header and the checksum of every page of the tables in backup
+func VerifyBackup(dir string) (*BackupManifest, error) {
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range manifest.Tables {
+		if err = verifyBackupTable(filepath.Join(dir, table.Filename), manifest.PageSize, table); err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+func verifyBackupTable(path string, pageSize int, table BackupTable) error {
+	td, err := table.CatalogSchema.TupleDesc()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != table.Size {
+		return fmt.Errorf("%v: size %v, manifest %v", path, info.Size(), table.Size)
+	}
+	header, err := ReadHeapFileHeader(f)
+	if err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	if err = header.Validate(path, td, pageSize); err != nil {
+		return err
+	}
+	if mvcc := header.Flags&HeaderFlagMVCC != 0; mvcc != table.MVCC {
+		return fmt.Errorf("%v: mvcc %v, manifest %v", path, mvcc, table.MVCC)
+	}
+	crc := crc32.New(crc32c)
+	buf := make([]byte, pageSize)
+	for i := -1; i < table.Pages; i++ {
+		if _, err = io.ReadFull(f, buf); err != nil {
+			return fmt.Errorf("%v: read page %v: %v", path, i, err)
+		}
+		crc.Write(buf)
+		if i < 0 {
+			continue
+		}
+		if err = VerifyPageChecksum(NewHeapPageID(table.TableID, i), buf); err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	if crc.Sum32() != table.CRC32C {
+		return fmt.Errorf("%v: crc32c %08x, manifest %08x", path, crc.Sum32(), table.CRC32C)
+	}
+	return nil
+}
+
+// RestoreBackup verify the backup, then copy the tables into dir, and write the catalog schema
+// with the restored files into dir/catalog.json, the files in dir are never overwritten
+func RestoreBackup(backupDir, dir string) (*BackupManifest, error) {
+	manifest, err := VerifyBackup(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	catalog := make([]CatalogSchema, len(manifest.Tables))
+	for i, table := range manifest.Tables {
+		catalog[i] = table.CatalogSchema
+		catalog[i].Filename = filepath.Join(dir, table.Filename)
+		if err = copyFile(filepath.Join(backupDir, table.Filename), catalog[i].Filename); err != nil {
+			return nil, err
+		}
+	}
+	catalogPath := filepath.Join(dir, BackupCatalogFile)
+	if _, err = os.Stat(catalogPath); err == nil {
+		return nil, fmt.Errorf("%v exists", catalogPath)
+	}
+	return manifest, writeJSONFile(catalogPath, catalog)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
@@ -0,0 +1,226 @@
+package newdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func backupTestTable(t *testing.T, rows int) *HeapFile {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	scan := NewMockScan(0, rows, 2)
+	require.NoError(t, scan.Open(context.Background()))
+	n, err := hf.BulkLoad(scan)
+	require.NoError(t, err)
+	require.Equal(t, rows, n)
+	return hf
+}
+
+func countRows(t *testing.T, tableID string) (ret int) {
+	seq := NewSeqScan(NewTxID(), tableID, "t")
+	require.NoError(t, seq.Open(context.Background()))
+	for seq.HasNext() {
+		seq.Next()
+		ret++
+	}
+	require.NoError(t, seq.Error())
+	return
+}
+
+func TestHeapFile_SnapshotCopyOnWrite(t *testing.T) {
+	hf := backupTestTable(t, 10)
+	original := make([]byte, DB.B().PageSize())
+	_, err := hf.File.ReadAt(original, hf.pageOffset(0))
+	require.NoError(t, err)
+
+	snap, err := hf.startSnapshot()
+	require.NoError(t, err)
+	_, err = hf.startSnapshot()
+	assert.Error(t, err, "only one backup at a time")
+	txID := NewTxID()
+	page, err := DB.B().GetPage(context.Background(), txID, NewHeapPageID(hf.ID(), 0), PermReadWrite)
+	require.NoError(t, err)
+	tuple := page.(*HeapPage).Tuples[0]
+	require.NoError(t, DB.B().DeleteTuple(context.Background(), txID, tuple))
+	require.NoError(t, hf.WritePage(page))
+	assert.Len(t, snap.pages, 1)
+
+	path := filepath.Join("data", fmt.Sprintf("tmp-%v.backup", RandString(10)))
+	table := &BackupTable{}
+	require.NoError(t, hf.backupTo(snap, path, table))
+	hf.endSnapshot()
+	assert.Equal(t, 1, table.Pages)
+
+	copied := make([]byte, DB.B().PageSize())
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.ReadAt(copied, int64(DB.B().PageSize()))
+	require.NoError(t, err)
+	assert.Equal(t, original, copied, "backup see the page before the write")
+}
+
+func TestDatabase_BackupRestore(t *testing.T) {
+	hf := backupTestTable(t, 1000)
+	db, err := NewDatabaseWithOptions(DefaultOptions())
+	require.NoError(t, err)
+	db.C().AddTable(hf, "t")
+
+	dir := filepath.Join("data", fmt.Sprintf("tmp-%v.backup", RandString(10)))
+	manifest, err := db.BackupTo(dir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Tables, 1)
+	assert.Equal(t, "t", manifest.Tables[0].TableName)
+	assert.Equal(t, hf.ID(), manifest.Tables[0].TableID)
+	assert.Equal(t, int(hf.NumPagesInFile()), manifest.Tables[0].Pages)
+	assert.Nil(t, hf.snap)
+	_, err = db.BackupTo(dir)
+	assert.Error(t, err, "backup dir exists")
+
+	// the writes after backup are not in the restored table
+	require.NoError(t, DB.B().InsertTuple(context.Background(), NewTxID(), hf.ID(), &Tuple{TD: hf.TD, Fields: GetFields(2)}))
+
+	target := filepath.Join("data", fmt.Sprintf("tmp-%v.restore", RandString(10)))
+	_, err = RestoreBackup(dir, target)
+	require.NoError(t, err)
+	_, err = RestoreBackup(dir, target)
+	assert.Error(t, err, "never overwrite")
+	f, err := os.Open(filepath.Join(target, BackupCatalogFile))
+	require.NoError(t, err)
+	defer f.Close()
+	ids, err := DB.C().LoadSchema(f)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, countRows(t, ids[0]))
+
+	// corrupt one byte of page 0
+	path := filepath.Join(dir, manifest.Tables[0].Filename)
+	backup, err := os.OpenFile(path, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	defer backup.Close()
+	b := make([]byte, 1)
+	_, err = backup.ReadAt(b, int64(DB.B().PageSize()+PageReservedSize))
+	require.NoError(t, err)
+	b[0] ^= 0xff
+	_, err = backup.WriteAt(b, int64(DB.B().PageSize()+PageReservedSize))
+	require.NoError(t, err)
+	_, err = VerifyBackup(dir)
+	assert.Error(t, err)
+	_, err = RestoreBackup(dir, filepath.Join("data", fmt.Sprintf("tmp-%v.restore", RandString(10))))
+	assert.Error(t, err)
+}
+
+func TestDatabase_BackupWhileCommitting(t *testing.T) {
+	hf, other := backupTestTable(t, 20000), backupTestTable(t, 0)
+	db, err := NewDatabaseWithOptions(DefaultOptions())
+	require.NoError(t, err)
+	// the commits go through DB
+	db.TxManager = DB.T()
+	db.C().AddTable(hf, "t")
+	db.C().AddTable(other, "u")
+
+	stop, started := make(chan struct{}), make(chan struct{})
+	done := make(chan int)
+	go func() {
+		commits := 0
+		defer func() { done <- commits }()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			tx := NewTx()
+			for _, table := range []*HeapFile{hf, other} {
+				if err := DB.B().InsertTuple(context.Background(), tx.TxID, table.ID(), &Tuple{TD: table.TD, Fields: GetFields(2)}); err != nil {
+					t.Error(err)
+					tx.Abort()
+					return
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				t.Error(err)
+				return
+			}
+			if commits++; commits == 1 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+	var dir string
+	for i := 0; i < 5; i++ {
+		dir = filepath.Join("data", fmt.Sprintf("tmp-%v.backup", RandString(10)))
+		if _, err = db.BackupTo(dir); err != nil {
+			break
+		}
+		if _, err = VerifyBackup(dir); err != nil {
+			break
+		}
+	}
+	close(stop)
+	commits := <-done
+	require.NoError(t, err, "every page is copied as a whole")
+	target := filepath.Join("data", fmt.Sprintf("tmp-%v.restore", RandString(10)))
+	_, err = RestoreBackup(dir, target)
+	require.NoError(t, err)
+	f, err := os.Open(filepath.Join(target, BackupCatalogFile))
+	require.NoError(t, err)
+	defer f.Close()
+	ids, err := DB.C().LoadSchema(f)
+	require.NoError(t, err)
+	rows := countRows(t, ids[0])
+	assert.True(t, rows > 20000 && rows <= 20000+commits, "rows %v, commits %v", rows, commits)
+	assert.Equal(t, rows-20000, countRows(t, ids[1]), "the commits are in both tables or none")
+}
+
+func TestDatabase_BackupBetweenCommits(t *testing.T) {
+	hf := mvccTable(t, 1)
+	db, err := NewDatabaseWithOptions(DefaultOptions())
+	require.NoError(t, err)
+	db.TxManager = DB.T()
+	db.C().AddTable(hf, "t")
+
+	// a commit is writing its pages
+	DB.T().latch.RLock()
+	done := make(chan error)
+	go func() {
+		_, err := db.BackupTo(filepath.Join("data", fmt.Sprintf("tmp-%v.backup", RandString(10))))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	hf.snapMu.RLock()
+	assert.Nil(t, hf.snap, "the snapshot waits for the commit")
+	hf.snapMu.RUnlock()
+	DB.T().latch.RUnlock()
+	require.NoError(t, <-done)
+}
+
+func TestHeapFile_SnapshotHeader(t *testing.T) {
+	hf := mvccTable(t, 1)
+	original := make([]byte, DB.B().PageSize())
+	_, err := hf.File.ReadAt(original, 0)
+	require.NoError(t, err)
+
+	snap, err := hf.startSnapshot()
+	require.NoError(t, err)
+	require.NoError(t, hf.reserveTxID(hf.Header.TxID))
+	path := filepath.Join("data", fmt.Sprintf("tmp-%v.backup", RandString(10)))
+	require.NoError(t, hf.backupTo(snap, path, &BackupTable{}))
+	hf.endSnapshot()
+
+	copied := make([]byte, DB.B().PageSize())
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.ReadAt(copied, 0)
+	require.NoError(t, err)
+	assert.Equal(t, original, copied, "backup see the header before the write")
+}
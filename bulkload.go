@@ -0,0 +1,155 @@
+package newdb
+
+import "fmt"
+
+var (
+	// DefaultBulkLoadBatch default num of pages written by BulkLoader at once
+	DefaultBulkLoadBatch = 64
+)
+
+// BulkLoader append tuples to fresh pages at the end of the HeapFile.
+// Pages are filled sequentially and written in batches of BatchPages pages
+// with one write and one sync, the BufferPool is bypassed.
+//
+// the loaded pages are not part of any transaction, and should not be
+// modified by others until the BulkLoader is closed
+type BulkLoader struct {
+	HF         *HeapFile
+	BatchPages int
+
+	td   *TupleDesc
+	page *HeapPage
+	slot int
+	// pending marshaled pages start from pendingPage
+	pending []byte
+	// pendingFree whether the pending pages have free slot
+	pendingFree []bool
+	// pendingCount the num of tuples in the pending pages
+	pendingCount int
+	pendingPage  int
+	nextPage     int
+	count        int
+	flushed      int
+}
+
+// NewBulkLoader create a BulkLoader on hf, if batchPages <= 0, DefaultBulkLoadBatch is used
+func NewBulkLoader(hf *HeapFile, batchPages int) *BulkLoader {
+	if batchPages <= 0 {
+		batchPages = DefaultBulkLoadBatch
+	}
+	next := int(hf.NumPagesInFile())
+	return &BulkLoader{
+		HF:          hf,
+		BatchPages:  batchPages,
+		td:          hf.TupleDesc(),
+		pendingPage: next,
+		nextPage:    next,
+	}
+}
+
+// Add append a copy of the tuple, the field types must be the same as the table.
+// the tuple of MVCC table is the version visible to all
+func (b *BulkLoader) Add(tuple *Tuple) (err error) {
+	if tuple.TD != b.td && !b.td.EqualTypes(tuple.TD) {
+		return fmt.Errorf("tuple desc %v not match table %v", tuple.TD, b.td)
+	}
+	if b.page == nil || b.slot >= b.page.NumOfTuples() {
+		if err = b.finishPage(); err != nil {
+			return err
+		}
+		b.page, err = NewHeapPage(NewHeapPageID(b.HF.ID(), b.nextPage), HeapPageCreateEmptyPageData())
+		if err != nil {
+			return err
+		}
+		b.nextPage++
+		b.slot = 0
+	}
+	b.page.insertTupleAt(b.slot, &Tuple{TD: b.td, Fields: tuple.Fields})
+	b.slot++
+	b.count++
+	return nil
+}
+
+// Count the num of tuples added
+func (b *BulkLoader) Count() int {
+	return b.count
+}
+
+// Flushed the num of tuples written to file
+func (b *BulkLoader) Flushed() int {
+	return b.flushed
+}
+
+// finishPage marshal the filling page to pending, and flush if the batch is full
+func (b *BulkLoader) finishPage() error {
+	if b.page == nil {
+		return nil
+	}
+	buf, err := b.page.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	PutPageChecksum(buf)
+	b.pending = append(b.pending, buf...)
+	b.pendingFree = append(b.pendingFree, b.slot < b.page.NumOfTuples())
+	b.pendingCount += b.slot
+	b.page = nil
+	if len(b.pending) >= b.BatchPages*DB.B().PageSize() {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Flush write the pending pages to file, the page being filled is not written
+func (b *BulkLoader) Flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	if err := b.HF.writePages(b.pendingPage, b.pending); err != nil {
+		return err
+	}
+	fsm, err := b.HF.FreeSpaceMap()
+	if err != nil {
+		return err
+	}
+	for i, free := range b.pendingFree {
+		if err = fsm.Set(b.pendingPage+i, free); err != nil {
+			return err
+		}
+	}
+	hfLog.Debug("write pages", "op", "bulk_load", "from_page", b.pendingPage, "pages", len(b.pending)/DB.B().PageSize())
+	b.pendingPage += len(b.pending) / DB.B().PageSize()
+	b.pending = b.pending[:0]
+	b.pendingFree = b.pendingFree[:0]
+	b.flushed += b.pendingCount
+	b.pendingCount = 0
+	return nil
+}
+
+// Close write all the pages to file
+func (b *BulkLoader) Close() error {
+	if err := b.finishPage(); err != nil {
+		return err
+	}
+	return b.Flush()
+}
+
+// BulkLoad load all tuples from the opened iterator to the end of hf, return the num of tuples
+// written to file, the tuples not flushed yet are discarded on error
+func (hf *HeapFile) BulkLoad(it Iterator) (int, error) {
+	loader := NewBulkLoader(hf, DefaultBulkLoadBatch)
+	for it.HasNext() {
+		tuple := it.Next()
+		if err := it.Error(); err != nil {
+			return loader.Flushed(), err
+		}
+		if err := loader.Add(tuple); err != nil {
+			return loader.Flushed(), err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return loader.Flushed(), err
+	}
+	err := loader.Close()
+	return loader.Flushed(), err
+}
@@ -0,0 +1,94 @@
+package newdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkLoader(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	txID := NewTxID()
+	perPage := TuplesPerPage(hf.TupleDesc())
+	total := perPage*5 + 3
+
+	loader := NewBulkLoader(hf, 2)
+	scan := NewMockScan(0, total, 2)
+	require.NoError(t, scan.Open(context.Background()))
+	var last *Tuple
+	for scan.HasNext() {
+		last = scan.Next()
+		require.NoError(t, loader.Add(last))
+	}
+	assert.Nil(t, last.RecordID, "the tuple is copied")
+	assert.Equal(t, int64(4), hf.NumPagesInFile(), "2 batches of 2 pages are flushed")
+	assert.Equal(t, 4*perPage, loader.Flushed())
+	require.NoError(t, loader.Close())
+	assert.Equal(t, total, loader.Count())
+	assert.Equal(t, int64(6), hf.NumPagesInFile())
+
+	seq := NewSeqScan(txID, tableID, "t")
+	require.NoError(t, seq.Open(context.Background()))
+	var i int64
+	for seq.HasNext() {
+		tuple := seq.Next()
+		require.NotNil(t, tuple)
+		assert.Equal(t, NewIntField(i), tuple.Fields[1])
+		i++
+	}
+	assert.Equal(t, int64(total), i)
+
+	// loaded again after the existing pages
+	more := NewMockScan(0, 3, 2)
+	require.NoError(t, more.Open(context.Background()))
+	n, err := hf.BulkLoad(more)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, int64(7), hf.NumPagesInFile())
+
+	// the cached tuples of the source are not changed
+	copyID, err := RandDBFile(2)
+	require.NoError(t, err)
+	copyLoader := NewBulkLoader(DB.C().GetTableByID(copyID).(*HeapFile), 1)
+	source := NewSeqScan(txID, tableID, "t")
+	require.NoError(t, source.Open(context.Background()))
+	for source.HasNext() {
+		tuple := source.Next()
+		rid := *tuple.RecordID
+		require.NoError(t, copyLoader.Add(tuple))
+		assert.Equal(t, rid, *tuple.RecordID)
+		assert.True(t, hf.TupleDesc() == tuple.TD)
+	}
+	require.NoError(t, copyLoader.Close())
+	assert.Equal(t, total+3, copyLoader.Flushed())
+
+	bad := NewMockScan(0, 3, 3)
+	require.NoError(t, bad.Open(context.Background()))
+	_, err = hf.BulkLoad(bad)
+	assert.Error(t, err)
+}
+
+func TestHeapFile_BulkLoadError(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	perPage := TuplesPerPage(hf.TupleDesc())
+	defer func(batch int) { DefaultBulkLoadBatch = batch }(DefaultBulkLoadBatch)
+	DefaultBulkLoadBatch = 1
+
+	var tuples []*Tuple
+	for i := 0; i < 2*perPage+1; i++ {
+		tuples = append(tuples, &Tuple{TD: GetTupleDesc(2, "x"), Fields: GetFields(2)})
+	}
+	tuples = append(tuples, &Tuple{TD: GetTupleDesc(3, "x"), Fields: GetFields(3)})
+	it := NewTupleIterator(hf.TupleDesc(), tuples)
+	require.NoError(t, it.Open(context.Background()))
+	n, err := hf.BulkLoad(it)
+	assert.Error(t, err)
+	assert.Equal(t, 2*perPage, n, "the tuple in the unflushed page is not counted")
+	assert.Equal(t, int64(2), hf.NumPagesInFile())
+}
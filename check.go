@@ -0,0 +1,257 @@
+package newdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/anydemo/newdb/pkg/bitset"
+)
+
+// kinds of CheckIssue
+const (
+	IssueHeader        = "header"
+	IssueFileLength    = "file_length"
+	IssueChecksum      = "checksum"
+	IssueBitsetPadding = "bitset_padding"
+	IssueFreeSlotData  = "free_slot_data"
+	IssueTuple         = "tuple"
+	IssueFreeSpaceMap  = "free_space_map"
+)
+
+// CheckIssue one problem found by CheckHeapFile
+type CheckIssue struct {
+	File string `json:"file"`
+	// Page the PageNum, -1 for the problem of the whole file
+	Page     int    `json:"page"`
+	Kind     string `json:"kind"`
+	Msg      string `json:"msg"`
+	Repaired bool   `json:"repaired"`
+	// Warning the hint is wrong but no data is broken, like the free space map
+	Warning bool `json:"warning"`
+}
+
+func (ci CheckIssue) String() string {
+	ret := fmt.Sprintf("%v page %v: %v: %v", ci.File, ci.Page, ci.Kind, ci.Msg)
+	if ci.Page < 0 {
+		ret = fmt.Sprintf("%v: %v: %v", ci.File, ci.Kind, ci.Msg)
+	}
+	if ci.Warning {
+		ret = "warning: " + ret
+	}
+	if ci.Repaired {
+		ret += " (repaired)"
+	}
+	return ret
+}
+
+// CheckReport the result of integrity check
+type CheckReport struct {
+	Files  int          `json:"files"`
+	Pages  int          `json:"pages"`
+	Tuples int          `json:"tuples"`
+	Issues []CheckIssue `json:"issues"`
+}
+
+func (r *CheckReport) add(file string, page int, kind string, repaired bool, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, CheckIssue{File: file, Page: page, Kind: kind, Msg: fmt.Sprintf(format, args...), Repaired: repaired})
+}
+
+// warn add the issue of the wrong hint, see CheckIssue.Warning
+func (r *CheckReport) warn(file string, page int, kind string, repaired bool, format string, args ...interface{}) {
+	r.add(file, page, kind, repaired, format, args...)
+	r.Issues[len(r.Issues)-1].Warning = true
+}
+
+// Unrepaired the num of issues not repaired, the warnings are not counted
+func (r *CheckReport) Unrepaired() (ret int) {
+	for _, issue := range r.Issues {
+		if !issue.Repaired && !issue.Warning {
+			ret++
+		}
+	}
+	return
+}
+
+// Warnings the num of warnings
+func (r *CheckReport) Warnings() (ret int) {
+	for _, issue := range r.Issues {
+		if issue.Warning {
+			ret++
+		}
+	}
+	return
+}
+
+// WriteTo write the readable report
+func (r *CheckReport) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, issue := range r.Issues {
+		fmt.Fprintln(&buf, issue.String())
+	}
+	fmt.Fprintf(&buf, "checked %v files, %v pages, %v tuples, no index to check: %v issues, %v warnings, %v unrepaired\n",
+		r.Files, r.Pages, r.Tuples, len(r.Issues), r.Warnings(), r.Unrepaired())
+	return buf.WriteTo(w)
+}
+
+// CheckSchema check all the files in the schema json, if repair, the safe issues are repaired.
+// the files are read directly, the header is checked but not required to be valid
+func CheckSchema(r io.Reader, repair bool) (*CheckReport, error) {
+	schema, err := ReadCatalogSchema(r)
+	if err != nil {
+		return nil, err
+	}
+	report := &CheckReport{}
+	flag := os.O_RDONLY
+	if repair {
+		flag = os.O_RDWR
+	}
+	for _, cs := range schema {
+		td, err := cs.TupleDesc()
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(cs.Filename, flag, 0666)
+		if err != nil {
+			return nil, err
+		}
+		err = CheckHeapFile(&HeapFile{File: f, TD: td, MVCC: cs.MVCC}, repair, report)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// CheckHeapFile check the header, file length, checksum and the slots of every page,
+// and the free space map if exists. the issues are added to report.
+// there is no index structure yet, so no index entry is checked against the heap.
+//
+// only the issues that lose no data are repaired: the trailing partial page, the padding bits of
+// bitset, the data left in free slots and the free space map.
+// the page with bad checksum is never rewritten. the bits of the free space map are hints,
+// so the wrong ones are reported as warnings.
+func CheckHeapFile(hf *HeapFile, repair bool, report *CheckReport) error {
+	name := hf.File.Name()
+	pageSize := DB.B().PageSize()
+	report.Files++
+	info, err := hf.File.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < int64(HeapFileHeaderSize) {
+		report.add(name, -1, IssueHeader, false, "file size %v is smaller than header", info.Size())
+		return nil
+	}
+	header, err := ReadHeapFileHeader(hf.File)
+	if err != nil {
+		return err
+	}
+	if err = header.Validate(name, hf.TD, pageSize); err != nil {
+		report.add(name, -1, IssueHeader, false, "%v", err)
+		return nil
+	}
+	// the slots of the other layout are wrong, and repair would wipe them
+	if mvcc := header.Flags&HeaderFlagMVCC != 0; mvcc != hf.MVCC {
+		report.add(name, -1, IssueHeader, false, "file mvcc %v, schema mvcc %v", mvcc, hf.MVCC)
+		return nil
+	}
+	if rem := info.Size() % int64(pageSize); rem != 0 {
+		repaired := false
+		if repair {
+			if err = hf.File.Truncate(info.Size() - rem); err != nil {
+				return err
+			}
+			repaired = true
+		}
+		report.add(name, -1, IssueFileLength, repaired, "file size %v is not a multiple of page size %v, %v bytes of partial page", info.Size(), pageSize, rem)
+	}
+
+	var fsm *FreeSpaceMap
+	if _, err = os.Stat(name + FSMFileSuffix); err == nil {
+		if fsm, err = OpenFreeSpaceMap(name + FSMFileSuffix); err != nil {
+			return err
+		}
+		defer fsm.Close()
+	}
+	numPages := int((info.Size() - int64(pageSize)) / int64(pageSize))
+	buf := make([]byte, pageSize)
+	for i := 0; i < numPages; i++ {
+		report.Pages++
+		if _, err = hf.File.ReadAt(buf, hf.pageOffset(i)); err != nil {
+			return err
+		}
+		if err = VerifyPageChecksum(NewHeapPageID(hf.ID(), i), buf); err != nil {
+			report.add(name, i, IssueChecksum, false, "%v", err)
+			continue
+		}
+		dirty, free := checkHeapPageSlots(hf, i, buf, repair, report)
+		if dirty {
+			PutPageChecksum(buf)
+			if _, err = hf.File.WriteAt(buf, hf.pageOffset(i)); err != nil {
+				return err
+			}
+		}
+		if fsm != nil && fsm.Get(i) != free {
+			repaired := false
+			if repair {
+				if err = fsm.Set(i, free); err != nil {
+					return err
+				}
+				repaired = true
+			}
+			report.warn(name, i, IssueFreeSpaceMap, repaired, "page has free slot: %v, free space map: %v", free, !free)
+		}
+	}
+	if repair {
+		return hf.File.Sync()
+	}
+	return nil
+}
+
+// checkHeapPageSlots check the bitset and slots of the page in buf, return whether buf is repaired,
+// and whether the page has free slot
+func checkHeapPageSlots(hf *HeapFile, pageNum int, buf []byte, repair bool, report *CheckReport) (dirty bool, free bool) {
+	name := hf.File.Name()
+	layout := hf.layout()
+	numSlots, tupleSize := layout.NumOfTuples(), layout.TupleSize()
+	head := bitset.Bytes(buf[PageReservedSize : PageReservedSize+layout.HeaderSize()])
+	for i := numSlots; i < len(head)*8; i++ {
+		if head.Get(uint(i)) {
+			if repair {
+				head.Unset(uint(i))
+				dirty = true
+			}
+			report.add(name, pageNum, IssueBitsetPadding, repair, "bit %v is set, but the page only has %v slots", i, numSlots)
+		}
+	}
+	tuplesStart := PageReservedSize + layout.HeaderSize()
+	for i := 0; i < numSlots; i++ {
+		slot := buf[tuplesStart+i*tupleSize : tuplesStart+(i+1)*tupleSize]
+		if !head.Get(uint(i)) {
+			free = true
+			if !isZero(slot) {
+				if repair {
+					copy(slot, make([]byte, tupleSize))
+					dirty = true
+				}
+				report.add(name, pageNum, IssueFreeSlotData, repair, "free slot %v has data", i)
+			}
+			continue
+		}
+		report.Tuples++
+		if hf.MVCC {
+			slot = slot[TupleVersionSize:]
+		}
+		r := bytes.NewReader(slot)
+		for j, item := range hf.TD.TdItems {
+			if _, err := item.Type.Parse(r); err != nil {
+				report.add(name, pageNum, IssueTuple, false, "slot %v field %v(%v): %v", i, j, item.Name, err)
+				break
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,152 @@
+package newdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSchema(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	name := hf.File.Name()
+	perPage := TuplesPerPage(hf.TupleDesc())
+	scan := NewMockScan(0, perPage*3-2, 2)
+	require.NoError(t, scan.Open(context.Background()))
+	_, err = hf.BulkLoad(scan)
+	require.NoError(t, err)
+
+	check := func(repair bool) *CheckReport {
+		schema, err := os.Open(name + ".schema.json")
+		require.NoError(t, err)
+		defer schema.Close()
+		report, err := CheckSchema(schema, repair)
+		require.NoError(t, err)
+		return report
+	}
+	report := check(false)
+	assert.Empty(t, report.Issues)
+	assert.Equal(t, 1, report.Files)
+	assert.Equal(t, 3, report.Pages)
+	assert.Equal(t, perPage*3-2, report.Tuples)
+
+	layout := HeapPage{TD: hf.TupleDesc()}
+	pageSize := DB.B().PageSize()
+	modify := func(pageNum int, fn func(buf []byte)) {
+		buf := make([]byte, pageSize)
+		_, err := hf.File.ReadAt(buf, hf.pageOffset(pageNum))
+		require.NoError(t, err)
+		fn(buf)
+		_, err = hf.File.WriteAt(buf, hf.pageOffset(pageNum))
+		require.NoError(t, err)
+	}
+	// page 0: corrupt data
+	modify(0, func(buf []byte) { buf[pageSize-1] ^= 0xff })
+	// page 2: the last 2 slots are free, set a padding bit and write data in free slot
+	modify(2, func(buf []byte) {
+		head := buf[PageReservedSize:]
+		if layout.NumOfTuples()%8 != 0 {
+			head[layout.HeaderSize()-1] |= 0x80
+		}
+		buf[PageReservedSize+layout.HeaderSize()+(perPage-1)*hf.TupleDesc().Size()] = 0x1
+		PutPageChecksum(buf)
+	})
+	// the free space map says page 2 is full
+	fsm, err := hf.FreeSpaceMap()
+	require.NoError(t, err)
+	require.NoError(t, fsm.Set(2, false))
+	// partial page
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("torn"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	kinds := func(report *CheckReport) (ret []string) {
+		for _, issue := range report.Issues {
+			ret = append(ret, issue.Kind)
+		}
+		return
+	}
+	want := []string{IssueFileLength, IssueChecksum, IssueFreeSlotData, IssueFreeSpaceMap}
+	if layout.NumOfTuples()%8 != 0 {
+		want = []string{IssueFileLength, IssueChecksum, IssueBitsetPadding, IssueFreeSlotData, IssueFreeSpaceMap}
+	}
+	report = check(false)
+	assert.Equal(t, want, kinds(report))
+	assert.Equal(t, len(want)-1, report.Unrepaired(), "the free space map is a warning")
+	assert.Equal(t, 1, report.Warnings())
+	assert.True(t, report.Issues[len(want)-1].Warning)
+
+	report = check(true)
+	assert.Equal(t, want, kinds(report))
+	assert.Equal(t, 1, report.Unrepaired(), "checksum issue is not repaired")
+
+	report = check(false)
+	assert.Equal(t, []string{IssueChecksum}, kinds(report))
+	var out strings.Builder
+	_, err = report.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "page 0: checksum: corrupt page")
+	assert.Contains(t, out.String(), "checked 1 files, 3 pages")
+	assert.Contains(t, out.String(), "no index to check")
+}
+
+func TestCheckHeapFile_BadHeader(t *testing.T) {
+	name, err := TmpDataFile()
+	require.NoError(t, err)
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write(make([]byte, DB.B().PageSize()))
+	require.NoError(t, err)
+	report := &CheckReport{}
+	require.NoError(t, CheckHeapFile(&HeapFile{File: f, TD: GetTupleDesc(1, "c")}, true, report))
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, IssueHeader, report.Issues[0].Kind)
+	assert.False(t, report.Issues[0].Repaired)
+}
+
+func TestCheckSchema_MVCC(t *testing.T) {
+	name, err := TmpDataFile()
+	require.NoError(t, err)
+	schema := func(mvcc bool) string {
+		return fmt.Sprintf(`[{"filename":%q,"td":[{"name":"v","type":"int"}],"mvcc":%v}]`, name, mvcc)
+	}
+	tableIDs, err := DB.C().LoadSchema(strings.NewReader(schema(true)))
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableIDs[0]).(*HeapFile)
+	tx := NewTx()
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, DB.B().InsertTuple(context.Background(), tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(i)}}))
+	}
+	require.NoError(t, tx.Commit())
+	tx = NewTx()
+	require.NoError(t, DB.B().DeleteTuple(context.Background(), tx.TxID, scanTuples(t, tx.TxID, hf)[0]))
+	require.NoError(t, tx.Commit())
+
+	check := func(mvcc bool) *CheckReport {
+		report, err := CheckSchema(strings.NewReader(schema(mvcc)), true)
+		require.NoError(t, err)
+		return report
+	}
+	report := check(true)
+	assert.Empty(t, report.Issues)
+	assert.Equal(t, 3, report.Tuples, "the deleted version is kept until vacuum")
+
+	report = check(false)
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, IssueHeader, report.Issues[0].Kind)
+	assert.Contains(t, report.Issues[0].String(), "file mvcc true, schema mvcc false")
+
+	inspect, err := InspectPage(hf, 0)
+	require.NoError(t, err)
+	require.Len(t, inspect.Tuples, 3, "repair keeps the versions")
+	assert.NotZero(t, inspect.Tuples[0].Xmax)
+}
@@ -0,0 +1,63 @@
+package newdb
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	// PageChecksumSize the size of CRC32C checksum at the beginning of page
+	PageChecksumSize = 4
+	// PageLSNSize the size of LSN after the checksum
+	PageLSNSize = 8
+	// PageReservedSize the reserved bytes at the beginning of every HeapPage
+	PageReservedSize = PageChecksumSize + PageLSNSize
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorruptPage the checksum of the page read from disk is not match
+type ErrCorruptPage struct {
+	PID      PageID
+	Stored   uint32
+	Computed uint32
+}
+
+func (e ErrCorruptPage) Error() string {
+	return fmt.Sprintf("corrupt page %v: stored checksum %08x, computed %08x", e.PID.ID(), e.Stored, e.Computed)
+}
+
+// PageChecksum the CRC32C of the page, the checksum field is excluded
+func PageChecksum(page []byte) uint32 {
+	return crc32.Checksum(page[PageChecksumSize:], crc32c)
+}
+
+// PutPageChecksum compute and write the checksum to the page
+func PutPageChecksum(page []byte) {
+	DefaultOrder.PutUint32(page, PageChecksum(page))
+}
+
+// VerifyPageChecksum check the stored checksum of page, the all-zero page is never written and is valid
+func VerifyPageChecksum(pid PageID, page []byte) error {
+	if len(page) < PageReservedSize {
+		return ErrCorruptPage{PID: pid}
+	}
+	stored := DefaultOrder.Uint32(page)
+	computed := PageChecksum(page)
+	if stored == computed {
+		return nil
+	}
+	if stored == 0 && isZero(page) {
+		return nil
+	}
+	return ErrCorruptPage{PID: pid, Stored: stored, Computed: computed}
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package newdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPageChecksum(t *testing.T) {
+	pid := NewHeapPageID(singleFieldTableID, 0)
+	page := make([]byte, DB.B().PageSize())
+	assert.NoError(t, VerifyPageChecksum(pid, page), "all-zero page is valid")
+
+	page[100] = 1
+	err := VerifyPageChecksum(pid, page)
+	require.Error(t, err)
+	corrupt, ok := err.(ErrCorruptPage)
+	require.True(t, ok)
+	assert.Equal(t, pid, corrupt.PID)
+
+	PutPageChecksum(page)
+	assert.NoError(t, VerifyPageChecksum(pid, page))
+	page[DB.B().PageSize()-1] ^= 0x80
+	assert.IsType(t, ErrCorruptPage{}, VerifyPageChecksum(pid, page))
+	assert.IsType(t, ErrCorruptPage{}, VerifyPageChecksum(pid, page[:PageReservedSize-1]))
+}
+
+func TestHeapFile_ReadPageChecksum(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	tuple := &Tuple{TD: hf.TupleDesc(), Fields: GetFields(2)}
+	require.NoError(t, DB.B().InsertTuple(context.Background(), NewTxID(), tableID, tuple))
+	pid := NewHeapPageID(tableID, 0)
+	page, err := hf.ReadPage(pid)
+	require.NoError(t, err)
+	page.(*HeapPage).LSN = 42
+	require.NoError(t, hf.WritePage(page))
+	page, err = hf.ReadPage(pid)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), page.(*HeapPage).LSN)
+
+	// flip one bit of the tuple on disk
+	buf := make([]byte, 1)
+	offset := hf.pageOffset(0) + int64(PageReservedSize+page.(*HeapPage).HeaderSize())
+	_, err = hf.File.ReadAt(buf, offset)
+	require.NoError(t, err)
+	buf[0] ^= 0x1
+	_, err = hf.File.WriteAt(buf, offset)
+	require.NoError(t, err)
+	_, err = hf.ReadPage(pid)
+	require.Error(t, err)
+	assert.Equal(t, pid, err.(ErrCorruptPage).PID)
+
+	// torn write: only the first bytes of the new page are written
+	require.NoError(t, hf.WritePage(page))
+	require.NoError(t, page.(*HeapPage).InsertTuple(&Tuple{TD: hf.TupleDesc(), Fields: GetFields(2)}))
+	newBuf, err := page.MarshalBinary()
+	require.NoError(t, err)
+	PutPageChecksum(newBuf)
+	_, err = hf.File.WriteAt(newBuf[:PageReservedSize], hf.pageOffset(0))
+	require.NoError(t, err)
+	_, err = hf.ReadPage(pid)
+	assert.IsType(t, ErrCorruptPage{}, err)
+}
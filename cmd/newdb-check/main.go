@@ -0,0 +1,56 @@
+// newdb-check offline integrity checker of the files in a catalog schema
+//
+// usage:
+//
+//	newdb-check -schema catalog.json [-repair] [-json]
+//
+// the database must not be running. exit with 1 if any issue is not repaired,
+// the wrong bits of the free space map are warnings. there is no index yet, so only
+// the heap files are checked.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anydemo/newdb"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "", "the catalog schema json")
+	repair := flag.Bool("repair", false, "repair the safe issues: partial page, bitset padding, data in free slot and free space map")
+	asJSON := flag.Bool("json", false, "print the report as json")
+	flag.Parse()
+	if *schemaPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	schema, err := os.Open(*schemaPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open schema err: %v\n", err)
+		os.Exit(2)
+	}
+	defer schema.Close()
+	report, err := newdb.CheckSchema(schema, *repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check err: %v\n", err)
+		os.Exit(2)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		_, err = report.WriteTo(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write report err: %v\n", err)
+		os.Exit(2)
+	}
+	if report.Unrepaired() > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,123 @@
+// newdb-inspect print the decoded pages of a HeapFile in a catalog schema
+//
+// usage:
+//
+//	newdb-inspect -schema catalog.json [-table name] [-pages 0-3] [-json]
+//
+// -table is the table_name or the filename in schema, could be omitted if only one table.
+// -pages is one page `3`, a range `0-3`, or an open range `2-`, default all pages.
+// the mvcc of the table in schema must match the file header.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/anydemo/newdb"
+)
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
+
+// parseRange parse the -pages, to is exclusive
+func parseRange(s string, numPages int) (from, to int, err error) {
+	if s == "" {
+		return 0, numPages, nil
+	}
+	parts := strings.SplitN(s, "-", 2)
+	if from, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, fmt.Errorf("invalid pages %q", s)
+	}
+	to = from + 1
+	if len(parts) == 2 {
+		to = numPages
+		if parts[1] != "" {
+			if to, err = strconv.Atoi(parts[1]); err != nil {
+				return 0, 0, fmt.Errorf("invalid pages %q", s)
+			}
+			to++
+		}
+	}
+	if from < 0 || from >= to || to > numPages {
+		return 0, 0, fmt.Errorf("pages %q out of range [0, %v)", s, numPages)
+	}
+	return from, to, nil
+}
+
+func main() {
+	schemaPath := flag.String("schema", "", "the catalog schema json")
+	table := flag.String("table", "", "the table_name or filename in schema")
+	pages := flag.String("pages", "", "page range: 3, 0-3 or 2-")
+	asJSON := flag.Bool("json", false, "print one json per page")
+	flag.Parse()
+	if *schemaPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	schemaFile, err := os.Open(*schemaPath)
+	if err != nil {
+		fatalf("open schema err: %v", err)
+	}
+	schema, err := newdb.ReadCatalogSchema(schemaFile)
+	schemaFile.Close()
+	if err != nil {
+		fatalf("read schema err: %v", err)
+	}
+	var cs *newdb.CatalogSchema
+	for i := range schema {
+		if (*table == "" && len(schema) == 1) || schema[i].TableName == *table || schema[i].Filename == *table {
+			cs = &schema[i]
+			break
+		}
+	}
+	if cs == nil {
+		fatalf("no table %q in schema, -table is required if more than one table", *table)
+	}
+	td, err := cs.TupleDesc()
+	if err != nil {
+		fatalf("schema err: %v", err)
+	}
+	file, err := os.Open(cs.Filename)
+	if err != nil {
+		fatalf("open file err: %v", err)
+	}
+	defer file.Close()
+	hf := &newdb.HeapFile{File: file, TD: td, MVCC: cs.MVCC}
+	// the pages of a file with bad header are decoded in the layout of schema
+	header, err := newdb.ReadHeapFileHeader(file)
+	if err == nil {
+		err = header.Validate(cs.Filename, td, newdb.DB.B().PageSize())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "header err: %v\n", err)
+	} else if mvcc := header.Flags&newdb.HeaderFlagMVCC != 0; mvcc != cs.MVCC {
+		fatalf("file mvcc %v, schema mvcc %v", mvcc, cs.MVCC)
+	}
+
+	from, to, err := parseRange(*pages, int(hf.NumPagesInFile()))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for i := from; i < to; i++ {
+		p, err := newdb.InspectPage(hf, i)
+		if err != nil {
+			fatalf("inspect page %v err: %v", i, err)
+		}
+		if *asJSON {
+			err = enc.Encode(p)
+		} else {
+			_, err = p.WriteTo(os.Stdout)
+		}
+		if err != nil {
+			fatalf("write err: %v", err)
+		}
+	}
+}
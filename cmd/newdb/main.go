@@ -0,0 +1,308 @@
+// newdb the command line tool of newdb
+//
+// usage:
+//
+//	newdb -schema catalog.json [-format csv|col] import <table> <file>
+//	newdb -schema catalog.json [-format csv|jsonl|col] export <table> [file]
+//	newdb -schema catalog.json backup <dir>
+//	newdb restore <backup dir> <dir>
+//	newdb -schema catalog.json analyze <table>
+//	newdb -schema catalog.json [-analyze] [-explain-format text|json] explain <table> [<field> <op> <value>]
+//
+// <table> is the table_name in schema, or the table id.
+// -format is the file format: csv, jsonl (JSON Lines, export only) or col (newdb columnar file)
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anydemo/newdb"
+)
+
+var (
+	errUsage = errors.New("wrong arguments")
+	format   = flag.String("format", "csv", "the file format: csv, jsonl or col")
+
+	explainAnalyze = flag.Bool("analyze", false, "explain: run the query and show the actual rows, pages and time")
+	explainFormat  = flag.String("explain-format", "text", "explain: the output format, text or json")
+)
+
+type command struct {
+	args string
+	help string
+	run  func(ctx context.Context, args []string) error
+	// noSchema the command does not load -schema
+	noSchema bool
+}
+
+var commands = map[string]command{
+	"import":  {"import <table> <file>", "load the csv with header or the columnar file into the table", runImport, false},
+	"export":  {"export <table> [file]", "write the table in -format, default to stdout", runExport, false},
+	"backup":  {"backup <dir>", "write a consistent snapshot of all tables into the new dir", runBackup, false},
+	"analyze": {"analyze <table>", "compute and save the stats of the table for cost estimation", runAnalyze, false},
+	"explain": {"explain <table> [<field> <op> <value>]", "show the plan of scan the table with the filter", runExplain, false},
+	"restore": {"restore <backup dir> <dir>", "verify the backup, and restore the tables and catalog.json into dir", runRestore, true},
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %v -schema catalog.json <command> [args]\n\ncommands:\n", os.Args[0])
+	for _, name := range []string{"import", "export", "backup", "restore", "analyze", "explain"} {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-30v %v\n", commands[name].args, commands[name].help)
+	}
+	fmt.Fprintln(flag.CommandLine.Output(), "\nflags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	schemaPath := flag.String("schema", "", "the catalog schema json")
+	timeout := flag.Duration("timeout", 0, "cancel the command after the timeout, 0 is no timeout")
+	logLevel := flag.String("log-level", newdb.DefaultLogLevel.String(), "the log level of all subsystems: debug, info, warn, error or off")
+	flag.Usage = usage
+	flag.Parse()
+	level, err := newdb.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for _, subsystem := range []string{newdb.LogDB, newdb.LogTx, newdb.LogHeapFile} {
+		newdb.SetLogLevel(subsystem, level)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok || (*schemaPath == "" && !cmd.noSchema) {
+		usage()
+		os.Exit(2)
+	}
+	if !cmd.noSchema {
+		if err := loadSchema(*schemaPath); err != nil {
+			fmt.Fprintf(os.Stderr, "load schema err: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	}
+	err = cmd.run(ctx, flag.Args()[1:])
+	cancel()
+	if err != nil {
+		if err == errUsage {
+			fmt.Fprintf(os.Stderr, "usage: %v -schema catalog.json %v\n", os.Args[0], cmd.args)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "%v: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func loadSchema(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = newdb.DB.C().LoadSchema(f)
+	return err
+}
+
+// tableID find the table by name or id
+func tableID(table string) (string, error) {
+	if dbFile := newdb.DB.C().GetTableByName(table); dbFile != nil {
+		return dbFile.ID(), nil
+	}
+	if dbFile := newdb.DB.C().GetTableByID(table); dbFile != nil {
+		return dbFile.ID(), nil
+	}
+	return "", fmt.Errorf("no table %v", table)
+}
+
+func runImport(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	id, err := tableID(args[0])
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch *format {
+	case "csv":
+	case "col":
+		return importColumnar(ctx, id, f)
+	default:
+		return fmt.Errorf("can not import format %v", *format)
+	}
+	result, err := newdb.ImportCSV(id, f)
+	if result != nil {
+		for _, rowErr := range result.Errors {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", args[1], rowErr)
+		}
+		fmt.Printf("imported %v rows, %v rows with error\n", result.Rows, len(result.Errors))
+	}
+	if err == nil && len(result.Errors) > 0 {
+		err = fmt.Errorf("%v rows skipped", len(result.Errors))
+	}
+	return err
+}
+
+func runExport(ctx context.Context, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	id, err := tableID(args[0])
+	if err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "jsonl" && *format != "col" {
+		return fmt.Errorf("can not export format %v", *format)
+	}
+	var w io.Writer = os.Stdout
+	if len(args) == 2 {
+		f, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	scan := newdb.NewSeqScan(newdb.NewTxID(), id, args[0])
+	if err = scan.Open(ctx); err != nil {
+		return err
+	}
+	defer scan.Close()
+	switch *format {
+	case "jsonl":
+		return newdb.ExportJSONLines(scan, w)
+	case "col":
+		_, err = newdb.ExportColumnar(scan, w)
+		return err
+	}
+	return newdb.ExportCSV(scan, w)
+}
+
+func importColumnar(ctx context.Context, id string, f *os.File) error {
+	hf, ok := newdb.DB.C().GetTableByID(id).(*newdb.HeapFile)
+	if !ok {
+		return fmt.Errorf("no HeapFile table %v", id)
+	}
+	reader, err := newdb.NewColumnarReader(f)
+	if err != nil {
+		return err
+	}
+	if err = reader.Open(ctx); err != nil {
+		return err
+	}
+	defer reader.Close()
+	n, err := hf.BulkLoad(reader)
+	fmt.Printf("imported %v rows\n", n)
+	return err
+}
+
+func runBackup(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	manifest, err := newdb.DB.BackupTo(args[0])
+	if err != nil {
+		return err
+	}
+	for _, table := range manifest.Tables {
+		fmt.Printf("%v: %v pages\n", table.TableName, table.Pages)
+	}
+	return nil
+}
+
+func runRestore(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	manifest, err := newdb.RestoreBackup(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %v tables of backup at %v, the schema is %v\n", len(manifest.Tables), manifest.Created.Format(time.RFC3339), filepath.Join(args[1], newdb.BackupCatalogFile))
+	return nil
+}
+
+func runAnalyze(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := tableID(args[0])
+	if err != nil {
+		return err
+	}
+	stats, err := newdb.DB.C().Analyze(ctx, newdb.NewTxID(), id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rows: %v  pages: %v  scan cost: %v\n", stats.Rows, stats.Pages, stats.EstimateScanCost())
+	for i, col := range stats.Columns {
+		fmt.Printf("  %v %v  min: %v  max: %v  distinct: %v\n", col.Name, col.Type, col.Min, col.Max, stats.DistinctCount(i))
+	}
+	return nil
+}
+
+func runExplain(ctx context.Context, args []string) error {
+	if len(args) != 1 && len(args) != 4 {
+		return errUsage
+	}
+	if *explainFormat != "text" && *explainFormat != "json" {
+		return fmt.Errorf("can not explain in format %v", *explainFormat)
+	}
+	id, err := tableID(args[0])
+	if err != nil {
+		return err
+	}
+	var op newdb.OpIterator = newdb.NewSeqScan(newdb.NewTxID(), id, args[0])
+	if len(args) == 4 {
+		if op, err = filter(op, args[1], args[2], args[3]); err != nil {
+			return err
+		}
+	}
+	var plan *newdb.PlanNode
+	if *explainAnalyze {
+		if plan, err = newdb.NewExplainAnalyze(op).Run(ctx); err != nil {
+			return err
+		}
+	} else {
+		plan = op.Explain()
+	}
+	if *explainFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+	fmt.Print(plan)
+	return nil
+}
+
+// filter the Filter of child by `field op value`, the value is parsed by the type of field
+func filter(child newdb.OpIterator, field, op, value string) (newdb.OpIterator, error) {
+	for i, item := range child.TupleDesc().TdItems {
+		if item.Name != field {
+			continue
+		}
+		o, err := newdb.ParseOp(op)
+		if err != nil {
+			return nil, err
+		}
+		operand, err := newdb.ParseField(item.Type, value)
+		if err != nil {
+			return nil, err
+		}
+		return newdb.NewFilter(&newdb.Predicate{Field: i, Op: o, Operand: operand}, child), nil
+	}
+	return nil, fmt.Errorf("no field %v", field)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -17,7 +18,10 @@ func main() {
 	if err != nil {
 		panic(fmt.Errorf("create file err: %v", err))
 	}
-	table1 := newdb.NewHeapFile(file, td)
+	table1, err := newdb.NewHeapFile(file, td)
+	if err != nil {
+		panic(fmt.Errorf("open heap file err: %v", err))
+	}
 	newdb.DB.C().AddTable(table1, "seqscan_table")
 	txID := newdb.NewTxID()
 
@@ -26,14 +30,14 @@ func main() {
 		TD:     td,
 		Fields: []newdb.Field{newdb.NewIntField(9), newdb.NewIntField(8), newdb.NewIntField(7)},
 	}
-	err = newdb.DB.B().InsertTuple(txID, table1.ID(), tuple)
+	err = newdb.DB.B().InsertTuple(context.Background(), txID, table1.ID(), tuple)
 	if err != nil {
 		panic(fmt.Errorf("insert tuple err: %v", err))
 	}
 
 	// real SeqScan
 	seq := newdb.NewSeqScan(txID, table1.ID(), "seqscan")
-	err = seq.Open()
+	err = seq.Open(context.Background())
 	if err != nil {
 		panic(fmt.Errorf("open SeqScan err: %v", err))
 	}
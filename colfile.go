@@ -0,0 +1,308 @@
+package newdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// ColumnarMagic the magic number at the beginning of columnar file
+	ColumnarMagic = "NEWDBCOL"
+	// ColumnarVersion the current format version of columnar file
+	ColumnarVersion = 1
+	// DefaultRowGroupSize default num of rows in one row group
+	DefaultRowGroupSize = 8192
+)
+
+// ColumnarHeader the self-describing header of columnar file
+type ColumnarHeader struct {
+	Version int               `json:"version"`
+	Columns []CatalogTDSchema `json:"columns"`
+}
+
+// ColumnarWriter write tuples in columnar format.
+//
+// file format:
+//
+// | magic 8B | header len 4B | header json | [row group] [row group] ... | 0 4B |
+//
+// row group format, the values of one column are stored together by Field.MarshalBinary:
+//
+// | rows 4B | crc32c of data 4B | data: [column 0 values][column 1 values] ... |
+type ColumnarWriter struct {
+	w            *bufio.Writer
+	td           *TupleDesc
+	rowGroupSize int
+	columns      []bytes.Buffer
+	rows         int
+}
+
+// NewColumnarWriter write the header, if rowGroupSize <= 0, DefaultRowGroupSize is used
+func NewColumnarWriter(w io.Writer, td *TupleDesc, rowGroupSize int) (*ColumnarWriter, error) {
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+	header := ColumnarHeader{Version: ColumnarVersion}
+	for _, item := range td.TdItems {
+		info, ok := LookupTypeByName(item.Type.Name)
+		if !ok {
+			return nil, fmt.Errorf("type %v of column %v is not registered", item.Type.Name, item.Name)
+		}
+		header.Columns = append(header.Columns, CatalogTDSchema{Name: item.Name, Type: info.SchemaName})
+	}
+	buf, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	cw := &ColumnarWriter{
+		w:            bufio.NewWriter(w),
+		td:           td,
+		rowGroupSize: rowGroupSize,
+		columns:      make([]bytes.Buffer, len(td.TdItems)),
+	}
+	cw.w.WriteString(ColumnarMagic)
+	binary.Write(cw.w, DefaultOrder, uint32(len(buf)))
+	_, err = cw.w.Write(buf)
+	return cw, err
+}
+
+// Write add one tuple, the row group is written when full
+func (cw *ColumnarWriter) Write(tuple *Tuple) error {
+	if len(tuple.Fields) != len(cw.columns) {
+		return fmt.Errorf("tuple has %v fields, want %v", len(tuple.Fields), len(cw.columns))
+	}
+	for i, field := range tuple.Fields {
+		buf, err := field.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if len(buf) != int(cw.td.TdItems[i].Type.Len) {
+			return fmt.Errorf("field %v marshal to %v bytes, want %v", i, len(buf), cw.td.TdItems[i].Type.Len)
+		}
+		cw.columns[i].Write(buf)
+	}
+	cw.rows++
+	if cw.rows >= cw.rowGroupSize {
+		return cw.flushRowGroup()
+	}
+	return nil
+}
+
+func (cw *ColumnarWriter) flushRowGroup() error {
+	if cw.rows == 0 {
+		return nil
+	}
+	crc := crc32.New(crc32c)
+	for i := range cw.columns {
+		crc.Write(cw.columns[i].Bytes())
+	}
+	binary.Write(cw.w, DefaultOrder, uint32(cw.rows))
+	binary.Write(cw.w, DefaultOrder, crc.Sum32())
+	for i := range cw.columns {
+		if _, err := cw.columns[i].WriteTo(cw.w); err != nil {
+			return err
+		}
+	}
+	cw.rows = 0
+	return nil
+}
+
+// Close write the last row group and the end mark, the underlying writer is not closed
+func (cw *ColumnarWriter) Close() error {
+	if err := cw.flushRowGroup(); err != nil {
+		return err
+	}
+	if err := binary.Write(cw.w, DefaultOrder, uint32(0)); err != nil {
+		return err
+	}
+	return cw.w.Flush()
+}
+
+// ExportColumnar write all tuples of the opened iterator in columnar format, return the num of tuples
+func ExportColumnar(it OpIterator, w io.Writer) (count int, err error) {
+	cw, err := NewColumnarWriter(w, it.TupleDesc(), DefaultRowGroupSize)
+	if err != nil {
+		return 0, err
+	}
+	for it.HasNext() {
+		tuple := it.Next()
+		if err = it.Error(); err != nil {
+			return count, err
+		}
+		if err = cw.Write(tuple); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err = it.Error(); err != nil {
+		return count, err
+	}
+	return count, cw.Close()
+}
+
+var _ OpIterator = (*ColumnarReader)(nil)
+
+// ColumnarReader read the columnar file as OpIterator, one row group is in memory at a time
+type ColumnarReader struct {
+	r         io.ReadSeeker
+	td        *TupleDesc
+	dataStart int64
+
+	ctx     context.Context
+	br      *bufio.Reader
+	group   [][]byte
+	rows    int
+	cur     int
+	open    bool
+	end     bool
+	Header  *ColumnarHeader
+	Err     error
+	numRead int
+}
+
+// NewColumnarReader read and validate the header, the TupleDesc is built with the registered types
+func NewColumnarReader(r io.ReadSeeker) (*ColumnarReader, error) {
+	magic := make([]byte, len(ColumnarMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("read magic: %v", err)
+	}
+	if string(magic) != ColumnarMagic {
+		return nil, fmt.Errorf("bad magic %q, not a newdb columnar file", magic)
+	}
+	var headerLen uint32
+	if err := binary.Read(r, DefaultOrder, &headerLen); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("read header: %v", err)
+	}
+	header := &ColumnarHeader{}
+	if err := json.Unmarshal(buf, header); err != nil {
+		return nil, err
+	}
+	if header.Version != ColumnarVersion {
+		return nil, fmt.Errorf("unsupported columnar version %v", header.Version)
+	}
+	td, err := CatalogSchema{TD: header.Columns}.TupleDesc()
+	if err != nil {
+		return nil, err
+	}
+	return &ColumnarReader{
+		r:         r,
+		td:        td,
+		dataStart: int64(len(ColumnarMagic) + 4 + len(buf)),
+		Header:    header,
+	}, nil
+}
+
+// Open seek to the first row group, ctx is checked before reading every row group
+func (cr *ColumnarReader) Open(ctx context.Context) error {
+	cr.ctx = ctx
+	if _, cr.Err = cr.r.Seek(cr.dataStart, io.SeekStart); cr.Err != nil {
+		return cr.Err
+	}
+	cr.br = bufio.NewReader(cr.r)
+	cr.rows, cr.cur, cr.end = 0, 0, false
+	cr.open = true
+	return nil
+}
+
+// Close close the iterator, the underlying reader is not closed
+func (cr *ColumnarReader) Close() {
+	cr.open = false
+	cr.group = nil
+}
+
+func (cr *ColumnarReader) readRowGroup() error {
+	if err := cr.ctx.Err(); err != nil {
+		return err
+	}
+	var rows, sum uint32
+	if err := binary.Read(cr.br, DefaultOrder, &rows); err != nil {
+		return fmt.Errorf("read row group: %v", err)
+	}
+	if rows == 0 {
+		cr.end = true
+		return nil
+	}
+	if err := binary.Read(cr.br, DefaultOrder, &sum); err != nil {
+		return fmt.Errorf("read row group: %v", err)
+	}
+	crc := crc32.New(crc32c)
+	cr.group = make([][]byte, len(cr.td.TdItems))
+	for i, item := range cr.td.TdItems {
+		cr.group[i] = make([]byte, int(rows)*int(item.Type.Len))
+		if _, err := io.ReadFull(cr.br, cr.group[i]); err != nil {
+			return fmt.Errorf("read column %v: %v", item.Name, err)
+		}
+		crc.Write(cr.group[i])
+	}
+	if crc.Sum32() != sum {
+		return fmt.Errorf("row group after %v rows is corrupt: checksum %08x, computed %08x", cr.numRead, sum, crc.Sum32())
+	}
+	cr.rows, cr.cur = int(rows), 0
+	return nil
+}
+
+// HasNext read the next row group if the current one is exhausted
+func (cr *ColumnarReader) HasNext() bool {
+	if !cr.open || cr.Err != nil {
+		return false
+	}
+	for cr.cur >= cr.rows && !cr.end {
+		if cr.Err = cr.readRowGroup(); cr.Err != nil {
+			return false
+		}
+	}
+	return cr.cur < cr.rows
+}
+
+// Next next tuple
+func (cr *ColumnarReader) Next() *Tuple {
+	if !cr.HasNext() {
+		if cr.Err == nil {
+			cr.Err = fmt.Errorf("no such element")
+		}
+		return nil
+	}
+	tuple := &Tuple{TD: cr.td, Fields: make([]Field, len(cr.td.TdItems))}
+	for i, item := range cr.td.TdItems {
+		size := int(item.Type.Len)
+		tuple.Fields[i], cr.Err = item.Type.Parse(bytes.NewReader(cr.group[i][cr.cur*size : (cr.cur+1)*size]))
+		if cr.Err != nil {
+			return nil
+		}
+	}
+	cr.cur++
+	cr.numRead++
+	return tuple
+}
+
+// Rewind read from the first row group again
+func (cr *ColumnarReader) Rewind() error {
+	cr.Close()
+	cr.numRead = 0
+	return cr.Open(cr.ctx)
+}
+
+// TupleDesc the TupleDesc from header
+func (cr *ColumnarReader) TupleDesc() *TupleDesc {
+	return cr.td
+}
+
+// Explain the rows are unknown until the row groups are read
+func (cr *ColumnarReader) Explain() *PlanNode {
+	return &PlanNode{Operator: "ColumnarReader", Detail: fmt.Sprintf("columns=%v", len(cr.td.TdItems)), Rows: UnknownRows}
+}
+
+// Error return error
+func (cr *ColumnarReader) Error() error {
+	return cr.Err
+}
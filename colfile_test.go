@@ -0,0 +1,88 @@
+package newdb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnar_WriteRead(t *testing.T) {
+	td := NewTupleDesc([]*Type{IntType, TimestampType, DecimalType}, []string{"id", "at", "price"})
+	at := time.Date(2019, 10, 1, 8, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	cw, err := NewColumnarWriter(&buf, td, 3)
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		tuple := &Tuple{TD: td, Fields: []Field{NewIntField(int64(i)), NewTimestampField(at.Add(time.Duration(i) * time.Second)), NewDecimalField(int64(i * 100))}}
+		require.NoError(t, cw.Write(tuple))
+	}
+	assert.Error(t, cw.Write(&Tuple{TD: td, Fields: GetFields(1)}))
+	require.NoError(t, cw.Close())
+
+	cr, err := NewColumnarReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, td, cr.TupleDesc())
+	assert.Equal(t, []CatalogTDSchema{{"id", "int"}, {"at", "timestamp"}, {"price", "decimal"}}, cr.Header.Columns)
+	require.NoError(t, cr.Open(context.Background()))
+	read := func() (ret []string) {
+		for cr.HasNext() {
+			tuple := cr.Next()
+			require.NoError(t, cr.Error())
+			ret = append(ret, tuple.String())
+		}
+		require.NoError(t, cr.Error())
+		return
+	}
+	rows := read()
+	require.Len(t, rows, 7)
+	assert.Equal(t, "int(6)\ttimestamp(2019-10-01T08:00:06Z)\tdecimal(0.0600)", rows[6])
+	require.NoError(t, cr.Rewind())
+	assert.Equal(t, rows, read())
+
+	// corrupt the last byte of data
+	data := buf.Bytes()
+	data[len(data)-5] ^= 0xff
+	cr, err = NewColumnarReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NoError(t, cr.Open(context.Background()))
+	for cr.HasNext() {
+		cr.Next()
+	}
+	assert.Error(t, cr.Error())
+
+	_, err = NewColumnarReader(bytes.NewReader([]byte("NEWDBHF\x00")))
+	assert.Error(t, err)
+}
+
+func TestColumnar_ExportImport(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	txID := NewTxID()
+	scan := NewMockScan(0, 1000, 2)
+	require.NoError(t, scan.Open(context.Background()))
+	var buf bytes.Buffer
+	n, err := ExportColumnar(scan, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, n)
+
+	cr, err := NewColumnarReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.NoError(t, cr.Open(context.Background()))
+	n, err = DB.C().GetTableByID(tableID).(*HeapFile).BulkLoad(cr)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, n)
+
+	seq := NewSeqScan(txID, tableID, "t")
+	require.NoError(t, seq.Open(context.Background()))
+	var i int64
+	for seq.HasNext() {
+		tuple := seq.Next()
+		assert.Equal(t, NewIntField(i), tuple.Fields[0])
+		i++
+	}
+	assert.Equal(t, int64(1000), i)
+}
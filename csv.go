@@ -0,0 +1,181 @@
+package newdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RowError the error of one row in the imported file
+type RowError struct {
+	// Line the line number in file, start from 1
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %v: %v", e.Line, e.Err)
+}
+
+// ImportResult the result of ImportCSV
+type ImportResult struct {
+	// Rows the num of rows imported
+	Rows int
+	// Errors the rows can not be parsed, they are skipped
+	Errors []RowError
+}
+
+// ImportCSV load the csv into the table through the BulkLoader.
+// the first row is the header, each column maps to the TdItem.Name of the table, the order could be different.
+// the values are parsed by ParseField, the rows with error are skipped and reported in ImportResult.Errors
+func ImportCSV(tableID string, r io.Reader) (*ImportResult, error) {
+	hf, ok := DB.C().GetTableByID(tableID).(*HeapFile)
+	if !ok {
+		return nil, fmt.Errorf("no HeapFile table %v", tableID)
+	}
+	td := hf.TupleDesc()
+	lines := &lineReader{r: bufio.NewReader(r)}
+	reader := csv.NewReader(lines)
+	reader.FieldsPerRecord = len(td.TdItems)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %v", err)
+	}
+	// columns[i] is the index of csv column for the i-th field
+	columns, err := csvColumns(td, header)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	loader := NewBulkLoader(hf, DefaultBulkLoadBatch)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				result.Errors = append(result.Errors, RowError{Line: parseErr.StartLine, Err: parseErr.Err})
+				continue
+			}
+			return result, err
+		}
+		// the quoted fields may span lines
+		line := lines.Line() - strings.Count(strings.Join(record, ""), "\n")
+		tuple := &Tuple{TD: td, Fields: make([]Field, len(td.TdItems))}
+		for i, item := range td.TdItems {
+			tuple.Fields[i], err = ParseField(item.Type, record[columns[i]])
+			if err != nil {
+				err = fmt.Errorf("column %v: %v", item.Name, err)
+				break
+			}
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, RowError{Line: line, Err: err})
+			continue
+		}
+		if err = loader.Add(tuple); err != nil {
+			return result, err
+		}
+		result.Rows++
+	}
+	return result, loader.Close()
+}
+
+// lineReader count the lines read, it never reads over the end of a line,
+// so the csv.Reader upon it has read the lines of the records returned, and no more
+type lineReader struct {
+	r *bufio.Reader
+	// newlines the num of newlines read
+	newlines int
+	// partial a line is read without its newline
+	partial bool
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := lr.r.Peek(1); err != nil {
+		return 0, err
+	}
+	buf, _ := lr.r.Peek(lr.r.Buffered())
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i+1]
+	}
+	n := copy(p, buf)
+	if _, err := lr.r.Discard(n); err != nil {
+		return n, err
+	}
+	lr.partial = p[n-1] != '\n'
+	if !lr.partial {
+		lr.newlines++
+	}
+	return n, nil
+}
+
+// Line the line number of the last line read, start from 1
+func (lr *lineReader) Line() int {
+	if lr.partial {
+		return lr.newlines + 1
+	}
+	return lr.newlines
+}
+
+func csvColumns(td *TupleDesc, header []string) ([]int, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, dup := index[name]; dup {
+			return nil, fmt.Errorf("duplicate column %v in csv header", name)
+		}
+		index[name] = i
+	}
+	columns := make([]int, len(td.TdItems))
+	for i, item := range td.TdItems {
+		column, ok := index[item.Name]
+		if !ok {
+			return nil, fmt.Errorf("column %v not in csv header %v", item.Name, header)
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+// ExportCSV write all tuples of the opened iterator as csv, the header is the TdItem.Name,
+// the values are formatted by FormatField
+func ExportCSV(it OpIterator, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	td := it.TupleDesc()
+	record := make([]string, len(td.TdItems))
+	for i, item := range td.TdItems {
+		record[i] = item.Name
+	}
+	if err := writer.Write(record); err != nil {
+		return err
+	}
+	for it.HasNext() {
+		tuple := it.Next()
+		if err := it.Error(); err != nil {
+			return err
+		}
+		for i, field := range tuple.Fields {
+			text, err := FormatField(field)
+			if err != nil {
+				return err
+			}
+			record[i] = text
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
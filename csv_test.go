@@ -0,0 +1,104 @@
+package newdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportExportCSV(t *testing.T) {
+	tableID, err := RandTable([]string{"int", "decimal", "date", "bool"}, []string{"id", "price", "day", "ok"})
+	require.NoError(t, err)
+	txID := NewTxID()
+	in := strings.Join([]string{
+		"day,id,ok,price",
+		"2019-10-01,1,true,12.5",
+		"2019-10-02,2,false,-0.25",
+		"2019-13-01,3,true,1",
+		"2019-10-04,x,true,1",
+		"2019-10-05,5,true",
+		"\"2019-10-06\",6,1,100",
+		"",
+	}, "\n")
+	result, err := ImportCSV(tableID, strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Rows)
+	require.Len(t, result.Errors, 3)
+	assert.Equal(t, 4, result.Errors[0].Line)
+	assert.Contains(t, result.Errors[0].Error(), "line 4: column day")
+	assert.Equal(t, 5, result.Errors[1].Line)
+	assert.Contains(t, result.Errors[1].Error(), "column id")
+	assert.Equal(t, 6, result.Errors[2].Line)
+
+	scan := NewSeqScan(txID, tableID, "t")
+	require.NoError(t, scan.Open(context.Background()))
+	var out strings.Builder
+	require.NoError(t, ExportCSV(scan, &out))
+	assert.Equal(t, strings.Join([]string{
+		"id,price,day,ok",
+		"1,12.5000,2019-10-01,true",
+		"2,-0.2500,2019-10-02,false",
+		"6,100.0000,2019-10-06,true",
+		"",
+	}, "\n"), out.String())
+}
+
+func TestImportCSV_Line(t *testing.T) {
+	tableID, err := RandTable([]string{"int", "int"}, []string{"a", "b"})
+	require.NoError(t, err)
+	in := "a,b\n1,2\n\n\"3\nx\",4\nx,5\r\n6,\"y\ny\"\n7,z"
+	result, err := ImportCSV(tableID, strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Rows)
+	require.Len(t, result.Errors, 4)
+	for i, line := range []int{4, 6, 7, 9} {
+		assert.Equal(t, line, result.Errors[i].Line, "%v", result.Errors[i])
+	}
+}
+
+func TestImportCSV_BadHeader(t *testing.T) {
+	tableID, err := RandTable([]string{"int", "int"}, []string{"a", "b"})
+	require.NoError(t, err)
+	_, err = ImportCSV(tableID, strings.NewReader("a,c\n1,2\n"))
+	assert.Error(t, err)
+	_, err = ImportCSV(tableID, strings.NewReader("a,a\n1,2\n"))
+	assert.Error(t, err)
+	_, err = ImportCSV(tableID, strings.NewReader(""))
+	assert.Error(t, err)
+	_, err = ImportCSV("no-such-table", strings.NewReader("a,b\n"))
+	assert.Error(t, err)
+}
+
+func TestParseFormatField(t *testing.T) {
+	var tests = []struct {
+		typ  *Type
+		text string
+		want string
+	}{
+		{IntType, "-12", "-12"},
+		{FloatType, "1e3", "1000"},
+		{BoolType, "T", "true"},
+		{DateType, " 1999-12-31 ", "1999-12-31"},
+		{TimestampType, "2019-10-01T08:00:00+08:00", "2019-10-01T00:00:00Z"},
+		{DecimalType, "3.14159", ""},
+	}
+	for _, test := range tests {
+		field, err := ParseField(test.typ, test.text)
+		if test.want == "" {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err, test.text)
+		text, err := FormatField(field)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, text)
+	}
+	_, err := ParseField(StringType, "x")
+	assert.Error(t, err)
+	text, err := FormatField(&uuidField{TypeReal: uuidType})
+	require.NoError(t, err)
+	assert.Equal(t, "uuid(00000000000000000000000000000000)", text, "fallback to String")
+}
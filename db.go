@@ -1,32 +1,76 @@
 package newdb
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-
-	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
 )
 
 var (
 	// DB singleton db
 	DB = NewDatabase()
 
-	log = logrus.New()
-	dbL = log.WithField("name", "db")
+	dbL = newSubsystemLogger(LogDB)
 
-	// DefaultPageSize the os dependency pagesize
-	DefaultPageSize = os.Getpagesize()
+	// DefaultPageSize the default Options.PageSize, not depend on os, so the file is portable
+	DefaultPageSize = 4096
 	// DefaultPageNum default page num
 	DefaultPageNum = 50
 )
 
+// Options the options of Database
+type Options struct {
+	// PageSize the size of page in bytes, recorded in the header of every HeapFile
+	PageSize int
+	// PageNum the max num of pages in BufferPool
+	PageNum int
+	// Logger receive the logs of all subsystems, nil keep the current one, default to logrus writing to stderr.
+	// the logging is shared by the process, so it is also the Logger of the other Databases
+	Logger Logger
+	// LogLevels the level of subsystems LogDB, LogTx and LogHeapFile, shared by the process like Logger,
+	// the missing ones are kept, see SetLogLevel
+	LogLevels map[string]Level
+	// GroupCommitDelay the max time a commit waits for others to share one fsync of the file,
+	// 0 start the fsync at once, the commits arrived while it is running share the next one
+	GroupCommitDelay time.Duration
+	// GroupCommitBatch the max num of commits sharing one fsync, the fsync starts when reached,
+	// and the commits over it wait for the next one, 0 for no limit
+	GroupCommitBatch int
+}
+
+// DefaultOptions the default Options
+func DefaultOptions() *Options {
+	return &Options{
+		PageSize: DefaultPageSize,
+		PageNum:  DefaultPageNum,
+	}
+}
+
+// Validate check the options
+func (opts Options) Validate() error {
+	if opts.PageSize < MinPageSize {
+		return fmt.Errorf("page size %v is less than %v", opts.PageSize, MinPageSize)
+	}
+	if opts.PageNum <= 0 {
+		return fmt.Errorf("page num %v must be positive", opts.PageNum)
+	}
+	if opts.GroupCommitDelay < 0 || opts.GroupCommitBatch < 0 {
+		return fmt.Errorf("group commit delay %v and batch %v must not be negative", opts.GroupCommitDelay, opts.GroupCommitBatch)
+	}
+	return nil
+}
+
 // Database singleton struct
 type Database struct {
+	Options    *Options
 	Catalog    *Catalog
 	BufferPool *BufferPool
+	TxManager  *TxManager
 }
 
 // C get Catalog
@@ -39,19 +83,44 @@ func (db *Database) B() *BufferPool {
 	return db.BufferPool
 }
 
-// NewDatabase return new
+// T get TxManager
+func (db *Database) T() *TxManager {
+	return db.TxManager
+}
+
+// NewDatabase return new with DefaultOptions
 func NewDatabase() *Database {
-	catalog := NewCatalog()
-	return &Database{
-		Catalog:    catalog,
-		BufferPool: NewBufferPool(-1),
+	db, err := NewDatabaseWithOptions(DefaultOptions())
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// NewDatabaseWithOptions return new with opts
+func NewDatabaseWithOptions(opts *Options) (*Database, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
 	}
+	configureLogging(opts)
+	bp := NewBufferPool(opts.PageNum)
+	bp.pageSize = opts.PageSize
+	return &Database{
+		Options:    opts,
+		Catalog:    NewCatalog(),
+		BufferPool: bp,
+		TxManager:  NewTxManager(),
+	}, nil
 }
 
 // Catalog The Catalog keeps track of all available tables in the database and their associated schemas.
 type Catalog struct {
 	TableID2DBFile map[string]DBFile
 	Name2ID        map[string]string
+	// TableID2Stats the cached stats, see Analyze
+	TableID2Stats map[string]*TableStats
+	// statsMu guard TableID2Stats, a pointer as the methods of Catalog copy it
+	statsMu *sync.Mutex
 }
 
 // NewCatalog new Catalog
@@ -59,6 +128,8 @@ func NewCatalog() *Catalog {
 	return &Catalog{
 		TableID2DBFile: make(map[string]DBFile),
 		Name2ID:        make(map[string]string),
+		TableID2Stats:  make(map[string]*TableStats),
+		statsMu:        &sync.Mutex{},
 	}
 }
 
@@ -90,45 +161,63 @@ type CatalogSchema struct {
 	Filename  string            `json:"filename,omitempty"`
 	TD        []CatalogTDSchema `json:"td,omitempty"`
 	TableName string            `json:"table_name,omitempty"`
+	// MVCC the table is multi-version, see TxManager
+	MVCC bool `json:"mvcc,omitempty"`
 }
 
-// LoadSchema load Catalog from file, and return slice of TableID
-func (c *Catalog) LoadSchema(r io.Reader) (ret []string, err error) {
-	var schema []CatalogSchema
+// TupleDesc build the TupleDesc with the registered types
+func (cs CatalogSchema) TupleDesc() (*TupleDesc, error) {
+	var td = &TupleDesc{}
+	for _, oneTDItem := range cs.TD {
+		info, ok := LookupType(oneTDItem.Type)
+		if !ok {
+			return nil, fmt.Errorf("unknown type %v", oneTDItem.Type)
+		}
+		td.TdItems = append(td.TdItems, TdItem{Name: oneTDItem.Name, Type: info.Type})
+	}
+	return td, nil
+}
+
+// ReadCatalogSchema read the schema json
+func ReadCatalogSchema(r io.Reader) (schema []CatalogSchema, err error) {
 	fBuf, err := ioutil.ReadAll(r)
 	if err != nil {
-		dbL.WithError(err).Error("read file err")
-		return
+		return nil, err
 	}
 	err = json.Unmarshal(fBuf, &schema)
+	return
+}
+
+// LoadSchema load Catalog from file, and return slice of TableID
+func (c *Catalog) LoadSchema(r io.Reader) (ret []string, err error) {
+	schema, err := ReadCatalogSchema(r)
 	if err != nil {
-		dbL.WithError(err).Error("unmarshal err")
+		dbL.Error("read schema err", "error", err)
+		return nil, err
 	}
 	for _, cs := range schema {
 		f, err := os.OpenFile(cs.Filename, os.O_RDWR, 0666)
 		if err != nil {
-			dbL.WithError(err).Error("open file error")
+			dbL.Error("open file error", "error", err, "file", cs.Filename)
+			return nil, err
 		}
-		var td = &TupleDesc{}
-		for _, oneTDItem := range cs.TD {
-			one := TdItem{}
-			one.Name = oneTDItem.Name
-			switch oneTDItem.Type {
-			case "int":
-				one.Type = IntType
-			default:
-				err := fmt.Errorf("unknown type %v", oneTDItem.Type)
-				dbL.WithError(err).Error("err in Load schema from reader")
-				return nil, err
-			}
-			td.TdItems = append(td.TdItems, one)
+		td, err := cs.TupleDesc()
+		if err != nil {
+			f.Close()
+			dbL.Error("err in Load schema from reader", "error", err)
+			return nil, err
 		}
 
-		heapFile := NewHeapFile(f, td)
+		heapFile, err := newHeapFile(f, td, cs.MVCC)
+		if err != nil {
+			f.Close()
+			dbL.Error("open heap file error", "error", err)
+			return nil, err
+		}
 		heapFileID := heapFile.ID()
 		tableName := heapFileID
 		if cs.TableName != "" {
-			tableName = heapFileID
+			tableName = cs.TableName
 		}
 		c.AddTable(heapFile, tableName)
 
@@ -144,13 +233,25 @@ func (c *Catalog) LoadSchema(r io.Reader) (ret []string, err error) {
 // The BufferPool is also responsible for locking;  when a transaction fetches
 // a page, BufferPool checks that the transaction has the appropriate
 // locks to read/write the page.
+// <p>
+// There is no write-ahead log. The pages are FORCE at commit, they are written and synced before
+// the commit returns, and NO STEAL, the dirty pages are never evicted, and the pages of MVCC tables
+// are written without the changes of the uncommitted transactions, see HeapPage.committedImage.
+// So the changes of a returned commit are on disk, and no checkpoint is needed. But a commit is not
+// atomic on crash: the pages are written one by one and the files are synced one after another,
+// so a crash in the middle may leave only some of them on disk. The checksum finds a page written
+// partly, but not a page of the commit never written, it keeps the old content with a valid checksum.
 //
 //@Threadsafe, all fields are final
 type BufferPool struct {
 	maxSize  int
 	pageSize int
+	// mu guard PageID2Page and stats
+	mu sync.Mutex
 	// PageID2Page k is PageID.ID()
 	PageID2Page map[string]Page
+	// stats k is PageID.TableID()
+	stats map[string]*PoolCounters
 }
 
 // NewBufferPool return BufferPool
@@ -162,11 +263,12 @@ func NewBufferPool(size int) *BufferPool {
 		maxSize:     size,
 		pageSize:    DefaultPageSize,
 		PageID2Page: make(map[string]Page),
+		stats:       make(map[string]*PoolCounters),
 	}
 }
 
 // PageSize get the os dependencied page size
-func (bp BufferPool) PageSize() int {
+func (bp *BufferPool) PageSize() int {
 	return bp.pageSize
 }
 
@@ -179,45 +281,225 @@ func (bp BufferPool) PageSize() int {
 // be added to the buffer pool and returned.  If there is insufficient
 // space in the buffer pool, a page should be evicted and the new page
 // should be added in its place.
-func (bp *BufferPool) GetPage(tx *TxID, pid PageID, perm Permission) (ret Page, err error) {
+// <p>
+// ctx.Err() is returned if ctx is canceled or its deadline is exceeded.
+func (bp *BufferPool) GetPage(ctx context.Context, tx *TxID, pid PageID, perm Permission) (ret Page, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
 	pidKey := pid.ID()
-	if _, exists := bp.PageID2Page[pidKey]; !exists {
-		if len(bp.PageID2Page) >= bp.maxSize {
-			err = bp.evictPage()
-			if err != nil {
-				return
-			}
-		}
-		ret, err = DB.C().GetTableByID(pid.TableID()).ReadPage(pid)
+	stats := bp.tableStats(pid.TableID())
+	if page, exists := bp.PageID2Page[pidKey]; exists {
+		stats.Hits++
+		return page, nil
+	}
+	stats.Misses++
+	if len(bp.PageID2Page) >= bp.maxSize {
+		err = bp.evictPage()
 		if err != nil {
-			return nil, err
+			return
+		}
+	}
+	ret, err = DB.C().GetTableByID(pid.TableID()).ReadPage(pid)
+	if err != nil {
+		return nil, err
+	}
+	bp.PageID2Page[pidKey] = ret
+	return ret, nil
+}
+
+// getTuples the tuples of the page with only the fields of table, td is the TupleDesc of fields.
+// the page in BufferPool is projected, as it may be dirty, or else the page is read from file by
+// HeapFile.readPageFields without being cached, so the fields not needed are never decoded
+func (bp *BufferPool) getTuples(ctx context.Context, hf *HeapFile, pid PageID, td *TupleDesc, fields []int) ([]*Tuple, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	stats := bp.tableStats(pid.TableID())
+	page, exists := bp.PageID2Page[pid.ID()]
+	if !exists {
+		stats.Misses++
+		return hf.readPageFields(pid, td, fields)
+	}
+	stats.Hits++
+	hp, ok := page.(*HeapPage)
+	if !ok {
+		return nil, fmt.Errorf("page is not HeapPage: %T", page)
+	}
+	var ret []*Tuple
+	for _, tuple := range hp.Tuples {
+		if tuple == nil {
+			continue
 		}
-		bp.PageID2Page[pidKey] = ret
+		projected := projectTuple(td, fields, tuple)
+		projected.Xmin, projected.Xmax = tuple.Xmin, tuple.Xmax
+		ret = append(ret, projected)
 	}
-	return bp.PageID2Page[pidKey], nil
+	return ret, nil
 }
 
+// evictPage discard one clean page, the dirty pages are never evicted (NO STEAL),
+// so the pool grows over its size if all pages are dirty, until they are flushed
 func (bp *BufferPool) evictPage() error {
+	for key, page := range bp.PageID2Page {
+		if page.IsDirty() != nil {
+			continue
+		}
+		delete(bp.PageID2Page, key)
+		bp.tableStats(page.PageID().TableID()).Evictions++
+		return nil
+	}
 	return nil
 }
 
+// FlushPages write the pages dirtied by txID to disk and mark them clean
+func (bp *BufferPool) FlushPages(txID *TxID) error {
+	return bp.flushPages(func(dirty *TxID) bool { return dirty.ID == txID.ID })
+}
+
+// TransactionComplete commit or abort the transaction, the dirty pages of txID are
+// written to disk if commit, or else they are discarded, and read from disk next time.
+// the changes of MVCC tables are completed by TxManager first, if the commit fails by
+// ErrWriteConflict or ErrSerializationFailure, the transaction is aborted and the error is returned
+func (bp *BufferPool) TransactionComplete(txID *TxID, commit bool) error {
+	err := DB.T().complete(txID, commit)
+	if err == ErrWriteConflict || err == ErrSerializationFailure {
+		commit = false
+	} else if err != nil {
+		return err
+	}
+	if commit {
+		return bp.FlushPages(txID)
+	}
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for key, page := range bp.PageID2Page {
+		if hp, ok := page.(*HeapPage); ok && hp.MVCC {
+			// undone and written by TxManager
+			continue
+		}
+		if dirty := page.IsDirty(); dirty != nil && dirty.ID == txID.ID {
+			delete(bp.PageID2Page, key)
+		}
+	}
+	txL.Info("abort tx", "tx_id", txID.ID)
+	return err
+}
+
+// FlushPage write the page to disk and mark it clean, if it is dirty in the BufferPool
+func (bp *BufferPool) FlushPage(pid PageID) error {
+	DB.T().latch.RLock()
+	files, err := bp.writeBackPages([]PageID{pid})
+	DB.T().latch.RUnlock()
+	if err != nil {
+		return err
+	}
+	return files.sync()
+}
+
+// FlushAllPages write all dirty pages to disk and mark them clean
+func (bp *BufferPool) FlushAllPages() error {
+	return bp.flushPages(func(dirty *TxID) bool { return true })
+}
+
+// flushPages write the matched pages, then sync every file once after bp.mu is released,
+// so the concurrent commits share the fsyncs
+func (bp *BufferPool) flushPages(match func(dirty *TxID) bool) error {
+	tm := DB.T()
+	tm.latch.RLock()
+	uncommitted := tm.uncommitted()
+	bp.mu.Lock()
+	files := make(dirtyFiles)
+	for _, page := range bp.PageID2Page {
+		dirty := page.IsDirty()
+		if dirty == nil || !match(dirty) {
+			continue
+		}
+		if err := bp.writeBack(page, files, uncommitted); err != nil {
+			bp.mu.Unlock()
+			tm.latch.RUnlock()
+			return err
+		}
+	}
+	bp.mu.Unlock()
+	tm.latch.RUnlock()
+	return files.sync()
+}
+
 // InsertTuple insert tuple to page
-func (bp *BufferPool) InsertTuple(txID *TxID, tableID string, tuple *Tuple) error {
+func (bp *BufferPool) InsertTuple(ctx context.Context, txID *TxID, tableID string, tuple *Tuple) error {
 	hf := DB.C().GetTableByID(tableID)
-	dirtyPages, err := hf.InsertTuple(txID, tuple)
+	dirtyPages, err := hf.InsertTuple(ctx, txID, tuple)
+	if err != nil {
+		return err
+	}
+	return bp.markDirty(ctx, txID, dirtyPages)
+}
+
+// DeleteTuple delete the tuple from the table where tuple.RecordID point to
+func (bp *BufferPool) DeleteTuple(ctx context.Context, txID *TxID, tuple *Tuple) error {
+	if tuple.RecordID == nil || tuple.RecordID.PID == nil {
+		return fmt.Errorf("tuple has no RecordID")
+	}
+	hf := DB.C().GetTableByID(tuple.RecordID.PID.TableID())
+	if hf == nil {
+		return fmt.Errorf("no table %v", tuple.RecordID.PID.TableID())
+	}
+	dirtyPages, err := hf.DeleteTuple(ctx, txID, tuple)
+	if err != nil {
+		return err
+	}
+	return bp.markDirty(ctx, txID, dirtyPages)
+}
+
+// UpdateTuple replace the old tuple with the new one, see DBFile.UpdateTuple
+func (bp *BufferPool) UpdateTuple(ctx context.Context, txID *TxID, old *Tuple, tuple *Tuple) error {
+	if old.RecordID == nil || old.RecordID.PID == nil {
+		return fmt.Errorf("tuple has no RecordID")
+	}
+	hf := DB.C().GetTableByID(old.RecordID.PID.TableID())
+	if hf == nil {
+		return fmt.Errorf("no table %v", old.RecordID.PID.TableID())
+	}
+	dirtyPages, err := hf.UpdateTuple(ctx, txID, old, tuple)
 	if err != nil {
 		return err
 	}
+	return bp.markDirty(ctx, txID, dirtyPages)
+}
+
+// markDirty mark the pages dirty by txID, and keep them in the BufferPool.
+// the pages of MVCC tables are skipped, they are kept by TxManager under its latch
+func (bp *BufferPool) markDirty(ctx context.Context, txID *TxID, dirtyPages []Page) (err error) {
 	for _, dirty := range dirtyPages {
-		dirty.MarkDirty(txID)
-		pid := dirty.PageID().ID()
-		if _, exists := bp.PageID2Page[pid]; !exists {
-			_, err = bp.GetPage(txID, dirty.PageID(), PermReadWrite)
-			if err != nil {
-				return err
-			}
+		if hp, ok := dirty.(*HeapPage); ok && hp.MVCC {
+			continue
+		}
+		if err = bp.keepDirty(ctx, txID, dirty); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepDirty mark the page dirty by txID, and keep it in the BufferPool
+func (bp *BufferPool) keepDirty(ctx context.Context, txID *TxID, dirty Page) error {
+	pid := dirty.PageID().ID()
+	bp.mu.Lock()
+	_, exists := bp.PageID2Page[pid]
+	bp.mu.Unlock()
+	if !exists {
+		if _, err := bp.GetPage(ctx, txID, dirty.PageID(), PermReadWrite); err != nil {
+			return err
 		}
-		bp.PageID2Page[pid] = dirty
 	}
+	bp.mu.Lock()
+	dirty.MarkDirty(txID)
+	bp.PageID2Page[pid] = dirty
+	bp.mu.Unlock()
 	return nil
 }
@@ -1,6 +1,7 @@
 package newdb
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -58,14 +59,43 @@ func TestBufferPool_GetPage(t *testing.T) {
 		TD:     dbFile.TupleDesc(),
 		Fields: []Field{NewIntField(1), NewIntField(3)},
 	}
-	err = DB.B().InsertTuple(txID, tableID, tuple)
+	err = DB.B().InsertTuple(context.Background(), txID, tableID, tuple)
 	require.NoError(t, err)
 	pid := NewHeapPageID(tableID, 0)
 	t.Logf("pid.ID(%v)", pid.ID())
-	page, err := DB.B().GetPage(txID, pid, PermReadOnly)
+	page, err := DB.B().GetPage(context.Background(), txID, pid, PermReadOnly)
 	require.NoError(t, err)
 	assert.NotNil(t, page)
 	assert.Equal(t, pid.ID(), page.PageID().ID())
 	heapPage := page.(*HeapPage)
 	assert.Equal(t, tuple, heapPage.Tuples[0])
 }
+
+func TestCatalog_LoadSchemaAllTypes(t *testing.T) {
+	tmpfile, err := TmpDataFile()
+	require.NoError(t, err)
+	var schema = strings.NewReader("[{\"filename\":\"" + tmpfile + "\",\"td\":[" +
+		"{\"name\":\"i\",\"type\":\"int\"},{\"name\":\"f\",\"type\":\"float\"},{\"name\":\"b\",\"type\":\"bool\"}," +
+		"{\"name\":\"d\",\"type\":\"date\"},{\"name\":\"ts\",\"type\":\"timestamp\"},{\"name\":\"price\",\"type\":\"decimal\"}]}]")
+	var catalog = NewCatalog()
+	tableIDs, err := catalog.LoadSchema(schema)
+	require.NoError(t, err)
+	td := catalog.GetTableByID(tableIDs[0]).TupleDesc()
+	assert.Equal(t, NewTupleDesc(
+		[]*Type{IntType, FloatType, BoolType, DateType, TimestampType, DecimalType},
+		[]string{"i", "f", "b", "d", "ts", "price"},
+	), td)
+	assert.Equal(t, 41, td.Size())
+
+	_, err = NewCatalog().LoadSchema(strings.NewReader("[{\"filename\":\"data/a.db\",\"td\":[{\"name\":\"x\",\"type\":\"inet\"}]}]"))
+	assert.Error(t, err)
+}
+
+func TestCatalog_LoadSchemaTableName(t *testing.T) {
+	tmpfile, err := TmpDataFile()
+	require.NoError(t, err)
+	var catalog = NewCatalog()
+	tableIDs, err := catalog.LoadSchema(strings.NewReader("[{\"filename\":\"" + tmpfile + "\",\"table_name\":\"users\",\"td\":[{\"name\":\"id\",\"type\":\"int\"}]}]"))
+	require.NoError(t, err)
+	assert.Equal(t, tableIDs[0], catalog.GetTableByName("users").ID())
+}
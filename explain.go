@@ -0,0 +1,216 @@
+package newdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UnknownRows the PlanNode.Rows if the num of tuples could not be estimated
+const UnknownRows = -1
+
+// PlanNode one node of the operator tree rendered by OpIterator.Explain
+type PlanNode struct {
+	// Operator the name of operator, eg: SeqScan
+	Operator string `json:"operator"`
+	// Detail the arguments of operator, eg: the table or predicate
+	Detail string `json:"detail,omitempty"`
+	// Rows the estimated num of output tuples, UnknownRows if no stats
+	Rows int `json:"rows"`
+	// Cost the estimated cost of the whole subtree, in the unit of TableStats
+	Cost     float64     `json:"cost"`
+	Children []*PlanNode `json:"children,omitempty"`
+	// Actual the runtime stats recorded by ExplainAnalyze, nil if not analyzed
+	Actual *ActualStats `json:"actual,omitempty"`
+
+	// stats the stats of the base table of the tuples of node
+	stats *TableStats
+	// statsFields the fields of base table in the tuples of node, nil if all fields
+	statsFields []int
+}
+
+// statsField the field of base table of the field of tuples
+func (n *PlanNode) statsField(field int) int {
+	if n.statsFields == nil {
+		return field
+	}
+	if field < 0 || field >= len(n.statsFields) {
+		return -1
+	}
+	return n.statsFields[field]
+}
+
+// ActualStats the runtime stats of one node, include the time and pages of its children
+type ActualStats struct {
+	Rows      int           `json:"rows"`
+	NextCalls int           `json:"next_calls"`
+	Pages     int           `json:"pages"`
+	Elapsed   time.Duration `json:"elapsed_ns"`
+	// Loops the num of Open and Rewind
+	Loops int `json:"loops"`
+}
+
+// cpuCost the cost to process rows tuples, 0 if unknown
+func cpuCost(rows int) float64 {
+	if rows == UnknownRows {
+		return 0
+	}
+	return float64(rows) * DefaultCPUCostPerTuple
+}
+
+func (n *PlanNode) String() string {
+	var buf bytes.Buffer
+	n.write(&buf, 0)
+	return buf.String()
+}
+
+func (n *PlanNode) write(buf *bytes.Buffer, depth int) {
+	if depth > 0 {
+		buf.WriteString(strings.Repeat("  ", depth-1))
+		buf.WriteString("-> ")
+	}
+	buf.WriteString(n.Operator)
+	if n.Detail != "" {
+		fmt.Fprintf(buf, " (%v)", n.Detail)
+	}
+	rows := "?"
+	if n.Rows != UnknownRows {
+		rows = fmt.Sprint(n.Rows)
+	}
+	fmt.Fprintf(buf, "  rows=%v cost=%.2f", rows, n.Cost)
+	if a := n.Actual; a != nil {
+		fmt.Fprintf(buf, "  actual rows=%v next=%v pages=%v loops=%v time=%v", a.Rows, a.NextCalls, a.Pages, a.Loops, a.Elapsed)
+	}
+	buf.WriteString("\n")
+	for _, child := range n.Children {
+		child.write(buf, depth+1)
+	}
+}
+
+// parentOp the operator with children, ExplainAnalyze wraps the children too
+type parentOp interface {
+	// children the pointers to the child fields
+	children() []*OpIterator
+}
+
+// pageReader the operator read pages from BufferPool
+type pageReader interface {
+	// PagesRead the num of pages read since created
+	PagesRead() int
+}
+
+var _ OpIterator = (*ExplainAnalyze)(nil)
+
+// ExplainAnalyze wrap the operator and all its children, record the actual rows, Next calls,
+// pages read and elapsed time of every node, Explain return the tree with the actual stats
+type ExplainAnalyze struct {
+	Child OpIterator
+
+	actual ActualStats
+	pages0 int
+}
+
+// NewExplainAnalyze wrap op, the children of op are replaced by ExplainAnalyze
+func NewExplainAnalyze(op OpIterator) *ExplainAnalyze {
+	if p, ok := op.(parentOp); ok {
+		for _, child := range p.children() {
+			if _, wrapped := (*child).(*ExplainAnalyze); !wrapped {
+				*child = NewExplainAnalyze(*child)
+			}
+		}
+	}
+	ret := &ExplainAnalyze{Child: op}
+	if r, ok := op.(pageReader); ok {
+		ret.pages0 = r.PagesRead()
+	}
+	return ret
+}
+
+// Run open and drain the operator, return the analyzed tree
+func (ea *ExplainAnalyze) Run(ctx context.Context) (*PlanNode, error) {
+	if err := ea.Open(ctx); err != nil {
+		return nil, err
+	}
+	defer ea.Close()
+	for ea.HasNext() {
+		ea.Next()
+		if err := ea.Error(); err != nil {
+			return nil, err
+		}
+	}
+	if err := ea.Error(); err != nil {
+		return nil, err
+	}
+	return ea.Explain(), nil
+}
+
+// Open open the child
+func (ea *ExplainAnalyze) Open(ctx context.Context) error {
+	start := time.Now()
+	defer func() { ea.actual.Elapsed += time.Since(start) }()
+	ea.actual.Loops++
+	return ea.Child.Open(ctx)
+}
+
+// Close close the child
+func (ea *ExplainAnalyze) Close() {
+	start := time.Now()
+	ea.Child.Close()
+	ea.actual.Elapsed += time.Since(start)
+}
+
+// HasNext hasNext of child
+func (ea *ExplainAnalyze) HasNext() bool {
+	start := time.Now()
+	ret := ea.Child.HasNext()
+	ea.actual.Elapsed += time.Since(start)
+	return ret
+}
+
+// Next next of child, the non-nil tuples are counted as rows
+func (ea *ExplainAnalyze) Next() *Tuple {
+	start := time.Now()
+	ret := ea.Child.Next()
+	ea.actual.Elapsed += time.Since(start)
+	ea.actual.NextCalls++
+	if ret != nil {
+		ea.actual.Rows++
+	}
+	return ret
+}
+
+// Rewind rewind the child
+func (ea *ExplainAnalyze) Rewind() error {
+	start := time.Now()
+	defer func() { ea.actual.Elapsed += time.Since(start) }()
+	ea.actual.Loops++
+	return ea.Child.Rewind()
+}
+
+// TupleDesc TupleDesc of child
+func (ea *ExplainAnalyze) TupleDesc() *TupleDesc {
+	return ea.Child.TupleDesc()
+}
+
+// Error error of child
+func (ea *ExplainAnalyze) Error() error {
+	return ea.Child.Error()
+}
+
+// Explain the tree of child with the actual stats, the pages include the pages of children
+func (ea *ExplainAnalyze) Explain() *PlanNode {
+	ret := ea.Child.Explain()
+	actual := ea.actual
+	if r, ok := ea.Child.(pageReader); ok {
+		actual.Pages = r.PagesRead() - ea.pages0
+	}
+	for _, child := range ret.Children {
+		if child.Actual != nil {
+			actual.Pages += child.Actual.Pages
+		}
+	}
+	ret.Actual = &actual
+	return ret
+}
@@ -0,0 +1,102 @@
+package newdb
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// explainTable a table of 1000 tuples (id, id % 10) loaded by BulkLoad
+func explainTable(t *testing.T) (string, *HeapFile) {
+	tableID, err := RandTable([]string{"int", "int"}, []string{"id", "mod"})
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	var tuples []*Tuple
+	for i := 0; i < 1000; i++ {
+		tuples = append(tuples, &Tuple{TD: hf.TD, Fields: []Field{NewIntField(int64(i)), NewIntField(int64(i % 10))}})
+	}
+	it := NewTupleIterator(hf.TD, tuples)
+	require.NoError(t, it.Open(context.Background()))
+	_, err = hf.BulkLoad(it)
+	require.NoError(t, err)
+	return tableID, hf
+}
+
+func TestExplain(t *testing.T) {
+	tableID, hf := explainTable(t)
+	filter := NewFilter(&Predicate{Field: 0, Op: OpLessThan, Operand: NewIntField(100)}, NewSeqScan(NewTxID(), tableID, "t"))
+
+	plan := filter.Explain()
+	assert.Equal(t, UnknownRows, plan.Rows, "never analyzed")
+	assert.Equal(t, UnknownRows, plan.Children[0].Rows)
+	assert.Equal(t, float64(hf.NumPagesInFile())*DefaultIOCostPerPage, plan.Cost)
+	assert.Contains(t, plan.String(), "rows=?")
+
+	_, err := DB.C().Analyze(context.Background(), NewTxID(), tableID)
+	require.NoError(t, err)
+	plan = filter.Explain()
+	require.Len(t, plan.Children, 1)
+	scan := plan.Children[0]
+	assert.Equal(t, "SeqScan", scan.Operator)
+	assert.Equal(t, 1000, scan.Rows)
+	assert.Equal(t, float64(hf.NumPagesInFile())*DefaultIOCostPerPage+1000, scan.Cost)
+	assert.Equal(t, "Filter", plan.Operator)
+	assert.Equal(t, "id < int(100)", plan.Detail)
+	assert.InDelta(t, 100, plan.Rows, 5)
+	assert.Equal(t, scan.Cost+1000, plan.Cost)
+	assert.Nil(t, plan.Actual)
+
+	lines := strings.Split(strings.TrimSpace(plan.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "Filter (id < int(100))  rows="), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "-> SeqScan (table="), lines[1])
+
+	insert := NewInsert(NewTxID(), NewTupleIterator(hf.TD, []*Tuple{nil, {TD: hf.TD, Fields: GetFields(2)}}), tableID)
+	plan = insert.Explain()
+	assert.Equal(t, 1, plan.Rows)
+	assert.Equal(t, 1, plan.Children[0].Rows, "nil tuple is skipped")
+	assert.Equal(t, 2.0, plan.Cost, "read and insert the child tuple")
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	tableID, hf := explainTable(t)
+	_, err := DB.C().Analyze(context.Background(), NewTxID(), tableID)
+	require.NoError(t, err)
+	filter := NewFilter(&Predicate{Field: 1, Op: OpEquals, Operand: NewIntField(3)}, NewSeqScan(NewTxID(), tableID, "t"))
+	analyze := NewExplainAnalyze(filter)
+	assert.IsType(t, &ExplainAnalyze{}, filter.Child, "the children are wrapped")
+
+	plan, err := analyze.Run(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, plan.Actual)
+	assert.Equal(t, 100, plan.Actual.Rows)
+	assert.Equal(t, 100, plan.Actual.NextCalls)
+	assert.Equal(t, 1, plan.Actual.Loops)
+	assert.True(t, plan.Actual.Elapsed > 0)
+	assert.InDelta(t, 100, plan.Rows, 5, "the estimate is kept")
+
+	scan := plan.Children[0]
+	require.NotNil(t, scan.Actual)
+	assert.Equal(t, 1000, scan.Actual.Rows)
+	assert.Equal(t, int(hf.NumPagesInFile()), scan.Actual.Pages)
+	assert.Equal(t, scan.Actual.Pages, plan.Actual.Pages, "the pages include the children")
+	assert.True(t, plan.Actual.Elapsed >= scan.Actual.Elapsed)
+	assert.Contains(t, plan.String(), "actual rows=100 next=100")
+
+	buf, err := json.Marshal(plan)
+	require.NoError(t, err)
+	var decoded PlanNode
+	require.NoError(t, json.Unmarshal(buf, &decoded))
+	assert.Equal(t, "Filter", decoded.Operator)
+	assert.Equal(t, 100, decoded.Actual.Rows)
+	assert.Equal(t, 1000, decoded.Children[0].Actual.Rows)
+
+	require.NoError(t, analyze.Open(context.Background()))
+	require.NoError(t, analyze.Rewind())
+	analyze.Close()
+	assert.Equal(t, 3, analyze.Explain().Actual.Loops)
+}
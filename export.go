@@ -0,0 +1,71 @@
+package newdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// jsonValue the value of field in json, the number and bool are kept, others are text by FormatField.
+// NaN and Inf are not json numbers, they are text too
+func jsonValue(field Field) (interface{}, error) {
+	switch f := field.(type) {
+	case *IntField:
+		return f.Val, nil
+	case *FloatField:
+		if math.IsNaN(f.Val) || math.IsInf(f.Val, 0) {
+			return FormatField(field)
+		}
+		return f.Val, nil
+	case *BoolField:
+		return f.Val, nil
+	}
+	return FormatField(field)
+}
+
+// ExportJSONLines write all tuples of the opened iterator as JSON Lines,
+// one json object per tuple, the keys are TdItem.Name
+func ExportJSONLines(it OpIterator, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	td := it.TupleDesc()
+	// json object with keys in TupleDesc order, encoding a map would sort the keys
+	keys := make([][]byte, len(td.TdItems))
+	for i, item := range td.TdItems {
+		key, err := json.Marshal(item.Name)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+	for it.HasNext() {
+		tuple := it.Next()
+		if err := it.Error(); err != nil {
+			return err
+		}
+		bw.WriteByte('{')
+		for i, field := range tuple.Fields {
+			val, err := jsonValue(field)
+			if err != nil {
+				return err
+			}
+			buf, err := json.Marshal(val)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			bw.Write(keys[i])
+			bw.WriteByte(':')
+			bw.Write(buf)
+		}
+		if _, err := bw.WriteString("}\n"); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,45 @@
+package newdb
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportJSONLines(t *testing.T) {
+	td := NewTupleDesc([]*Type{IntType, FloatType, BoolType, DateType, DecimalType}, []string{"id", "score", "ok", "day", "price"})
+	day := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	tuples := []*Tuple{
+		{TD: td, Fields: []Field{NewIntField(1), NewFloatField(0.5), NewBoolField(true), NewDateField(day), NewDecimalField(12345)}},
+		{TD: td, Fields: []Field{NewIntField(-2), NewFloatField(3), NewBoolField(false), NewDateField(day.AddDate(0, 0, 1)), NewDecimalField(-1)}},
+	}
+	it := NewTupleIterator(td, tuples)
+	require.NoError(t, it.Open(context.Background()))
+	var out strings.Builder
+	require.NoError(t, ExportJSONLines(it, &out))
+	assert.Equal(t, `{"id":1,"score":0.5,"ok":true,"day":"2019-10-01","price":"1.2345"}
+{"id":-2,"score":3,"ok":false,"day":"2019-10-02","price":"-0.0001"}
+`, out.String())
+}
+
+func TestExportJSONLines_NaNInf(t *testing.T) {
+	td := NewTupleDesc([]*Type{FloatType}, []string{"score"})
+	var tuples []*Tuple
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1.5} {
+		tuples = append(tuples, &Tuple{TD: td, Fields: []Field{NewFloatField(f)}})
+	}
+	it := NewTupleIterator(td, tuples)
+	require.NoError(t, it.Open(context.Background()))
+	var out strings.Builder
+	require.NoError(t, ExportJSONLines(it, &out))
+	assert.Equal(t, `{"score":"NaN"}
+{"score":"+Inf"}
+{"score":"-Inf"}
+{"score":1.5}
+`, out.String())
+}
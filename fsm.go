@@ -0,0 +1,166 @@
+package newdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/anydemo/newdb/pkg/bitset"
+)
+
+const (
+	// FSMFileSuffix the free space map of a HeapFile is stored in ${HeapFile}${FSMFileSuffix}
+	FSMFileSuffix = ".fsm"
+)
+
+// FreeSpaceMap persistent bitmap of the pages with free slots, one bit per page.
+//
+// file format:
+//
+// | bit of page 0-7 | bit of page 8-15 | ...
+//
+// The map is a hint: a page marked free may be full (the bit is cleared when found),
+// and a page marked full is not used until the map is rebuilt, when the HeapFile is opened.
+// Changes are written to file without sync.
+type FreeSpaceMap struct {
+	mu   sync.Mutex
+	file *os.File
+	bits bitset.Bytes
+	// hint all pages before hint are full
+	hint int
+}
+
+// OpenFreeSpaceMap open or create the free space map file
+func OpenFreeSpaceMap(path string) (*FreeSpaceMap, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := ioutil.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FreeSpaceMap{file: file, bits: bitset.Bytes(buf)}, nil
+}
+
+// Len the num of pages covered by the map
+func (fsm *FreeSpaceMap) Len() int {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	return len(fsm.bits) * 8
+}
+
+// Find find one page with free slot, return false if all pages are full
+func (fsm *FreeSpaceMap) Find() (int, bool) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	for i := fsm.hint >> 3; i < len(fsm.bits); i++ {
+		if fsm.bits[i] == 0 {
+			continue
+		}
+		for j := uint(0); j < 8; j++ {
+			if page := i<<3 + int(j); fsm.bits.Get(uint(page)) {
+				fsm.hint = page
+				return page, true
+			}
+		}
+	}
+	fsm.hint = len(fsm.bits) << 3
+	return 0, false
+}
+
+// Get whether the page has free slot
+func (fsm *FreeSpaceMap) Get(page int) bool {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	return page>>3 < len(fsm.bits) && fsm.bits.Get(uint(page))
+}
+
+// Set mark whether the page has free slot, and write the changed byte to file
+func (fsm *FreeSpaceMap) Set(page int, free bool) error {
+	if page < 0 {
+		return fmt.Errorf("invalid page %v", page)
+	}
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	if page>>3 >= len(fsm.bits) {
+		if !free {
+			return nil
+		}
+		fsm.bits.Grow(uint(page + 1))
+	}
+	if fsm.bits.Get(uint(page)) == free {
+		return nil
+	}
+	fsm.bits.SetBool(uint(page), free)
+	if free && page < fsm.hint {
+		fsm.hint = page
+	}
+	_, err := fsm.file.WriteAt(fsm.bits[page>>3:page>>3+1], int64(page>>3))
+	return err
+}
+
+// Reset replace the whole map with bits, and write it to file
+func (fsm *FreeSpaceMap) Reset(bits bitset.Bytes) error {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	fsm.bits = bits
+	fsm.hint = 0
+	if err := fsm.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := fsm.file.WriteAt(bits, 0)
+	return err
+}
+
+// Close close the file
+func (fsm *FreeSpaceMap) Close() error {
+	return fsm.file.Close()
+}
+
+// FreeSpaceMap get the free space map of hf, it is opened by the first caller and rebuilt from the pages,
+// as the pages written before a crash may be marked full
+func (hf *HeapFile) FreeSpaceMap() (*FreeSpaceMap, error) {
+	hf.fsmMu.Lock()
+	defer hf.fsmMu.Unlock()
+	if hf.fsm != nil {
+		return hf.fsm, nil
+	}
+	fsm, err := OpenFreeSpaceMap(hf.File.Name() + FSMFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if err = hf.rebuildFreeSpaceMap(fsm); err != nil {
+		fsm.Close()
+		return nil, err
+	}
+	hf.fsm = fsm
+	return fsm, nil
+}
+
+// rebuildFreeSpaceMap scan the used slots of all pages, and reset the map if it is different.
+// the pages not in BufferPool are read without being cached
+func (hf *HeapFile) rebuildFreeSpaceMap(fsm *FreeSpaceMap) error {
+	numPages := hf.NumPagesInFile()
+	bits := bitset.NewBytes(uint(numPages))
+	perPage := hf.layout().NumOfTuples()
+	for i := 0; int64(i) < numPages; i++ {
+		tuples, err := DB.B().getTuples(context.Background(), hf, NewHeapPageID(hf.ID(), i), &TupleDesc{}, []int{})
+		if err != nil {
+			return err
+		}
+		bits.SetBool(uint(i), len(tuples) < perPage)
+	}
+	fsm.mu.Lock()
+	same := bytes.Equal(bits, fsm.bits)
+	fsm.mu.Unlock()
+	if same {
+		return nil
+	}
+	hfLog.Info("rebuild free space map", "id", hf.ID(), "pages", numPages)
+	return fsm.Reset(bits)
+}
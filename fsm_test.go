@@ -0,0 +1,128 @@
+package newdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeSpaceMap(t *testing.T) {
+	path := fmt.Sprintf("data/tmp-%v.fsm", RandString(10))
+	defer os.Remove(path)
+	fsm, err := OpenFreeSpaceMap(path)
+	require.NoError(t, err)
+	_, ok := fsm.Find()
+	assert.False(t, ok, "empty map")
+
+	require.NoError(t, fsm.Set(3, false))
+	assert.Equal(t, 0, fsm.Len(), "mark full does not grow the map")
+	require.NoError(t, fsm.Set(10, true))
+	require.NoError(t, fsm.Set(12, true))
+	assert.Equal(t, 16, fsm.Len())
+	page, ok := fsm.Find()
+	require.True(t, ok)
+	assert.Equal(t, 10, page)
+	require.NoError(t, fsm.Set(10, false))
+	page, ok = fsm.Find()
+	require.True(t, ok)
+	assert.Equal(t, 12, page)
+	require.NoError(t, fsm.Set(2, true))
+	page, ok = fsm.Find()
+	require.True(t, ok)
+	assert.Equal(t, 2, page, "hint moves back")
+	assert.Error(t, fsm.Set(-1, true))
+	require.NoError(t, fsm.Close())
+
+	fsm, err = OpenFreeSpaceMap(path)
+	require.NoError(t, err)
+	defer fsm.Close()
+	assert.True(t, fsm.Get(2))
+	assert.False(t, fsm.Get(10))
+	assert.True(t, fsm.Get(12))
+	assert.False(t, fsm.Get(100))
+}
+
+func TestHeapFile_InsertTupleWithFreeSpaceMap(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	txID := NewTxID()
+	perPage := TuplesPerPage(hf.TupleDesc())
+	var tuples []*Tuple
+	for i := 0; i < perPage+1; i++ {
+		tuple := &Tuple{TD: hf.TupleDesc(), Fields: GetFields(2)}
+		require.NoError(t, DB.B().InsertTuple(context.Background(), txID, tableID, tuple))
+		tuples = append(tuples, tuple)
+	}
+	assert.Equal(t, int64(2), hf.NumPagesInFile())
+	fsm, err := hf.FreeSpaceMap()
+	require.NoError(t, err)
+	assert.False(t, fsm.Get(0), "page 0 is full")
+	assert.True(t, fsm.Get(1))
+
+	require.NoError(t, DB.B().DeleteTuple(context.Background(), txID, tuples[5]))
+	assert.True(t, fsm.Get(0), "page 0 has free slot after delete")
+	tuple := &Tuple{TD: hf.TupleDesc(), Fields: GetFields(2)}
+	require.NoError(t, DB.B().InsertTuple(context.Background(), txID, tableID, tuple))
+	assert.Equal(t, NewRecordID(NewHeapPageID(tableID, 0), 5), tuple.RecordID)
+	assert.False(t, fsm.Get(0))
+
+	// the stale hint of the full page, and the tuple reused from a scan of it
+	require.NoError(t, fsm.Set(0, true))
+	reused := &Tuple{TD: hf.TupleDesc(), Fields: GetFields(2), RecordID: tuples[0].RecordID}
+	require.NoError(t, DB.B().InsertTuple(context.Background(), txID, tableID, reused))
+	assert.Equal(t, NewRecordID(NewHeapPageID(tableID, 1), 1), reused.RecordID)
+	assert.False(t, fsm.Get(0))
+
+	// rebuild when the map is lost
+	require.NoError(t, fsm.Close())
+	require.NoError(t, os.Remove(hf.File.Name()+FSMFileSuffix))
+	hf.fsm = nil
+	fsm, err = hf.FreeSpaceMap()
+	require.NoError(t, err)
+	assert.Equal(t, 8, fsm.Len())
+	page, ok := fsm.Find()
+	require.True(t, ok)
+	assert.Equal(t, 1, page)
+}
+
+func TestHeapFile_FreeSpaceMapOpen(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	perPage := TuplesPerPage(hf.TupleDesc())
+	it := NewMockScan(0, 2*perPage+1, 2)
+	require.NoError(t, it.Open(context.Background()))
+	_, err = hf.BulkLoad(it)
+	require.NoError(t, err)
+	fsm, err := hf.FreeSpaceMap()
+	require.NoError(t, err)
+	// the page written before a crash, and not marked free
+	require.NoError(t, fsm.Set(2, false))
+	require.NoError(t, fsm.Close())
+
+	reopened, err := openTmpHeapFile(t, hf.File.Name(), hf.TD)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	maps := make([]*FreeSpaceMap, 8)
+	for i := range maps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			maps[i], _ = reopened.FreeSpaceMap()
+		}(i)
+	}
+	wg.Wait()
+	for _, m := range maps {
+		assert.True(t, m == maps[0], "opened once")
+	}
+	require.NotNil(t, maps[0])
+	assert.False(t, maps[0].Get(0))
+	assert.False(t, maps[0].Get(1))
+	assert.True(t, maps[0].Get(2), "rebuilt when opened")
+}
@@ -0,0 +1,161 @@
+package newdb
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// groupSync group the concurrent syncs of one file into one fsync.
+// only one fsync is running at a time, the callers arrived meanwhile wait for the next one,
+// which starts when the batch is full, or the first of them has waited for the delay
+type groupSync struct {
+	file *os.File
+	// syncs the num of fsync
+	syncs int64
+
+	mu      sync.Mutex
+	pending []chan error
+	syncing bool
+	// due the delay of the pending callers passed
+	due   bool
+	timer *time.Timer
+	// gen increased by every fsync, the timer of the earlier batch is ignored
+	gen int
+}
+
+func newGroupSync(file *os.File) *groupSync {
+	return &groupSync{file: file}
+}
+
+// Sync wait for a fsync started after the call, at most batch callers share one fsync,
+// 0 for no limit, the others wait for the next one, and the first caller waits for delay
+// at most before the fsync starts
+func (g *groupSync) Sync(delay time.Duration, batch int) error {
+	ch := make(chan error, 1)
+	g.mu.Lock()
+	g.pending = append(g.pending, ch)
+	g.schedule(delay, batch)
+	g.mu.Unlock()
+	return <-ch
+}
+
+// schedule start the fsync of the pending callers if ready, or wait for the delay, mu must be held
+func (g *groupSync) schedule(delay time.Duration, batch int) {
+	if g.syncing || len(g.pending) == 0 {
+		return
+	}
+	if delay <= 0 || g.due || batch > 0 && len(g.pending) >= batch {
+		n := len(g.pending)
+		if batch > 0 && n > batch {
+			n = batch
+		}
+		waiters := g.pending[:n:n]
+		// the rest arrived while the last fsync was running, they start the next one at once
+		g.pending = append([]chan error(nil), g.pending[n:]...)
+		g.syncing, g.due = true, len(g.pending) > 0
+		if g.timer != nil {
+			g.timer.Stop()
+			g.timer = nil
+		}
+		g.gen++
+		go g.run(waiters, delay, batch)
+		return
+	}
+	if g.timer == nil {
+		gen := g.gen
+		g.timer = time.AfterFunc(delay, func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			if gen != g.gen {
+				return
+			}
+			g.timer, g.due = nil, true
+			g.schedule(delay, batch)
+		})
+	}
+}
+
+func (g *groupSync) run(waiters []chan error, delay time.Duration, batch int) {
+	err := g.file.Sync()
+	atomic.AddInt64(&g.syncs, 1)
+	for _, ch := range waiters {
+		ch <- err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.syncing = false
+	g.schedule(delay, batch)
+}
+
+// Sync sync the file, the concurrent syncs are grouped by Options.GroupCommitDelay and GroupCommitBatch
+func (hf *HeapFile) Sync() error {
+	if hf.group == nil || DB.Options == nil {
+		return hf.File.Sync()
+	}
+	return hf.group.Sync(DB.Options.GroupCommitDelay, DB.Options.GroupCommitBatch)
+}
+
+// dirtyFiles the files written without sync
+type dirtyFiles map[*HeapFile]bool
+
+// sync the files, the commits of other transactions share the fsyncs
+func (files dirtyFiles) sync() error {
+	for hf := range files {
+		if err := hf.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBack write the dirty page and mark it clean, bp.mu must be held.
+// the HeapFile is not synced, it is added to files.
+// the page of MVCC table is written without the changes of uncommitted, see HeapPage.committedImage,
+// and it is kept dirty if any is left out
+func (bp *BufferPool) writeBack(page Page, files dirtyFiles, uncommitted map[uint64]bool) error {
+	dbFile := DB.C().GetTableByID(page.PageID().TableID())
+	var err error
+	partial := false
+	if hf, ok := dbFile.(*HeapFile); ok {
+		image := page
+		if hp, ok := page.(*HeapPage); ok && hp.MVCC {
+			image, partial = hp.committedImage(uncommitted)
+			if err = hf.reserveTxID(atomic.LoadUint64(&atomicTxID)); err != nil {
+				return err
+			}
+		}
+		err = hf.writePage(image)
+		files[hf] = true
+	} else {
+		err = dbFile.WritePage(page)
+	}
+	if err != nil {
+		return err
+	}
+	if !partial {
+		page.MarkDirty(nil)
+	}
+	bp.tableStats(page.PageID().TableID()).DirtyWrites++
+	return nil
+}
+
+// writeBackPages write the pages dirty in the BufferPool without sync, return the files to sync.
+// the latch of TxManager must be held, so no transaction completes meanwhile
+func (bp *BufferPool) writeBackPages(pids []PageID) (dirtyFiles, error) {
+	uncommitted := DB.T().uncommitted()
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	files := make(dirtyFiles)
+	for _, pid := range pids {
+		page, ok := bp.PageID2Page[pid.ID()]
+		if !ok || page.IsDirty() == nil {
+			continue
+		}
+		if err := bp.writeBack(page, files, uncommitted); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
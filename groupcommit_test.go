@@ -0,0 +1,137 @@
+package newdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tmpGroupSync(t testing.TB) *groupSync {
+	name, err := TmpDataFile()
+	require.NoError(t, err)
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	return newGroupSync(f)
+}
+
+// concurrentSyncs call Sync in n goroutines at once
+func concurrentSyncs(t *testing.T, g *groupSync, n int, delay time.Duration, batch int) {
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- g.Sync(delay, batch)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestGroupSync(t *testing.T) {
+	g := tmpGroupSync(t)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, g.Sync(0, 0))
+	}
+	assert.Equal(t, int64(3), atomic.LoadInt64(&g.syncs), "one fsync per sync without concurrency")
+
+	g = tmpGroupSync(t)
+	concurrentSyncs(t, g, 16, 100*time.Millisecond, 0)
+	assert.True(t, atomic.LoadInt64(&g.syncs) < 16, "syncs %v", g.syncs)
+
+	g = tmpGroupSync(t)
+	start := time.Now()
+	concurrentSyncs(t, g, 8, time.Hour, 4)
+	assert.True(t, time.Since(start) < time.Minute, "the full batches do not wait for the delay")
+	assert.Equal(t, int64(2), atomic.LoadInt64(&g.syncs))
+}
+
+func TestGroupSync_BatchLimit(t *testing.T) {
+	g := tmpGroupSync(t)
+	// the callers arrive while a fsync is running
+	g.mu.Lock()
+	g.syncing = true
+	g.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		concurrentSyncs(t, g, 10, time.Hour, 4)
+	}()
+	for {
+		g.mu.Lock()
+		n := len(g.pending)
+		g.mu.Unlock()
+		if n == 10 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	g.mu.Lock()
+	g.syncing = false
+	g.schedule(time.Hour, 4)
+	g.mu.Unlock()
+	<-done
+	assert.True(t, time.Since(start) < time.Minute, "the rest do not wait for the delay")
+	assert.Equal(t, int64(3), atomic.LoadInt64(&g.syncs), "at most 4 callers share one fsync")
+}
+
+func TestOptions_GroupCommit(t *testing.T) {
+	opts := DefaultOptions()
+	opts.GroupCommitDelay = time.Millisecond
+	opts.GroupCommitBatch = 8
+	assert.NoError(t, opts.Validate())
+	opts.GroupCommitDelay = -1
+	assert.Error(t, opts.Validate())
+	opts.GroupCommitDelay, opts.GroupCommitBatch = 0, -1
+	assert.Error(t, opts.Validate())
+}
+
+// BenchmarkGroupCommit the commits of one tuple to a MVCC table by the concurrent transactions,
+// the ns/op decreases with the concurrency as the commits share the fsyncs
+func BenchmarkGroupCommit(b *testing.B) {
+	name, err := TmpDataFile()
+	require.NoError(b, err)
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(b, err)
+	hf, err := NewMVCCHeapFile(f, GetTupleDesc(1, "v"))
+	require.NoError(b, err)
+	DB.C().AddTable(hf, name)
+	defer func(delay time.Duration) { DB.Options.GroupCommitDelay = delay }(DB.Options.GroupCommitDelay)
+
+	commit := func(pb *testing.PB) {
+		for pb.Next() {
+			tx := NewTx()
+			err := DB.B().InsertTuple(context.Background(), tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(1)}})
+			if err == nil {
+				err = tx.Commit()
+			}
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	}
+	for _, delay := range []time.Duration{0, 500 * time.Microsecond} {
+		for _, concurrency := range []int{1, 4, 16, 64} {
+			b.Run(fmt.Sprintf("delay=%v/concurrency=%v", delay, concurrency), func(b *testing.B) {
+				DB.Options.GroupCommitDelay = delay
+				syncs := atomic.LoadInt64(&hf.group.syncs)
+				b.SetParallelism(concurrency)
+				b.RunParallel(commit)
+				b.Logf("%v commits, %v fsyncs", b.N, atomic.LoadInt64(&hf.group.syncs)-syncs)
+			})
+		}
+	}
+}
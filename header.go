@@ -0,0 +1,179 @@
+package newdb
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// HeapFileMagic the magic number at the beginning of every HeapFile
+	HeapFileMagic = "NEWDBHF\x00"
+	// HeapFileVersion the current format version of HeapFile, version 2 add the flags, version 3 add the TxID
+	HeapFileVersion uint32 = 3
+	// HeapFileHeaderSize the size of the meaningful bytes in header page
+	HeapFileHeaderSize = len(HeapFileMagic) + 4 + 4 + sha1.Size + sha1.Size + 4 + 8
+	// HeaderFlagMVCC the tuples of HeapFile have the version header, see TupleVersionSize
+	HeaderFlagMVCC uint32 = 1
+	// MinPageSize the min page size of Options.PageSize
+	MinPageSize = 512
+	// TxIDReserve the num of TxIDs reserved by one write of the header, see HeapFile.reserveTxID
+	TxIDReserve = 1 << 16
+)
+
+// HeapFileHeader the header page of HeapFile, the first page of the file
+//
+// format:
+//
+// | magic 8B | version 4B | page size 4B | table id 20B | schema fingerprint 20B | flags 4B | txid 8B | padding to page size |
+//
+// the flags of version 1 and the txid of version 1 and 2 are in the zero padding, so they are 0
+type HeapFileHeader struct {
+	Magic    [8]byte
+	Version  uint32
+	PageSize uint32
+	// TableID sha1 of the file name when the file is created, the file may be renamed later
+	TableID [sha1.Size]byte
+	// Schema the SchemaFingerprint of the TupleDesc
+	Schema [sha1.Size]byte
+	// Flags the bits of HeaderFlagMVCC
+	Flags uint32
+	// TxID the high-water mark of the TxIDs in the MVCC table, the versions are created and deleted by smaller ones
+	TxID uint64
+}
+
+// ErrBadHeader the header of HeapFile is invalid, or not match the database
+type ErrBadHeader struct {
+	File   string
+	Reason string
+}
+
+func (e ErrBadHeader) Error() string {
+	return fmt.Sprintf("bad header of %v: %v", e.File, e.Reason)
+}
+
+// SchemaFingerprint sha1 of the TupleDesc, the names and types are included
+func SchemaFingerprint(td *TupleDesc) [sha1.Size]byte {
+	return sha1.Sum([]byte(td.String()))
+}
+
+// NewHeapFileHeader create header for the file with the TupleDesc
+func NewHeapFileHeader(fileName string, td *TupleDesc, pageSize int) *HeapFileHeader {
+	ret := &HeapFileHeader{
+		Version:  HeapFileVersion,
+		PageSize: uint32(pageSize),
+		TableID:  sha1.Sum([]byte(fileName)),
+		Schema:   SchemaFingerprint(td),
+	}
+	copy(ret.Magic[:], HeapFileMagic)
+	return ret
+}
+
+// MarshalBinary implement encoding.BinaryMarshaler, only the HeapFileHeaderSize bytes
+func (h HeapFileHeader) MarshalBinary() ([]byte, error) {
+	buffer := bytes.NewBuffer(make([]byte, 0, HeapFileHeaderSize))
+	err := binary.Write(buffer, DefaultOrder, h)
+	return buffer.Bytes(), err
+}
+
+// UnmarshalBinary implement encoding.BinaryUnmarshaler
+func (h *HeapFileHeader) UnmarshalBinary(data []byte) error {
+	if len(data) < HeapFileHeaderSize {
+		return fmt.Errorf("header want %v bytes, get %v", HeapFileHeaderSize, len(data))
+	}
+	return binary.Read(bytes.NewReader(data), DefaultOrder, h)
+}
+
+// ReadHeapFileHeader read the header at the beginning of r
+func ReadHeapFileHeader(r io.ReaderAt) (*HeapFileHeader, error) {
+	buf := make([]byte, HeapFileHeaderSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, err
+	}
+	ret := &HeapFileHeader{}
+	return ret, ret.UnmarshalBinary(buf)
+}
+
+// Validate check the header is a HeapFile header of the supported version,
+// with the pageSize and the TupleDesc
+func (h HeapFileHeader) Validate(fileName string, td *TupleDesc, pageSize int) error {
+	if string(h.Magic[:]) != HeapFileMagic {
+		return ErrBadHeader{File: fileName, Reason: fmt.Sprintf("bad magic %q, not a newdb heap file", h.Magic[:])}
+	}
+	if h.Version == 0 || h.Version > HeapFileVersion {
+		return ErrBadHeader{File: fileName, Reason: fmt.Sprintf("unsupported format version %v, support <= %v", h.Version, HeapFileVersion)}
+	}
+	if int(h.PageSize) != pageSize {
+		return ErrBadHeader{File: fileName, Reason: fmt.Sprintf("file page size %v, database page size %v", h.PageSize, pageSize)}
+	}
+	if td != nil && h.Schema != SchemaFingerprint(td) {
+		return ErrBadHeader{File: fileName, Reason: fmt.Sprintf("schema fingerprint %x not match %v", h.Schema, td)}
+	}
+	return nil
+}
+
+// initHeader write the header to the empty file, or read and validate the header
+func (hf *HeapFile) initHeader() error {
+	info, err := hf.File.Stat()
+	if err != nil {
+		return err
+	}
+	pageSize := DB.B().PageSize()
+	if info.Size() == 0 {
+		hf.Header = NewHeapFileHeader(hf.File.Name(), hf.TD, pageSize)
+		if hf.MVCC {
+			hf.Header.Flags |= HeaderFlagMVCC
+		}
+		buf, err := hf.Header.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		page := make([]byte, pageSize)
+		copy(page, buf)
+		if _, err = hf.File.WriteAt(page, 0); err != nil {
+			return err
+		}
+		return hf.File.Sync()
+	}
+	if info.Size() < int64(HeapFileHeaderSize) {
+		return ErrBadHeader{File: hf.File.Name(), Reason: fmt.Sprintf("file size %v is smaller than header", info.Size())}
+	}
+	hf.Header, err = ReadHeapFileHeader(hf.File)
+	if err != nil {
+		return err
+	}
+	if err = hf.Header.Validate(hf.File.Name(), hf.TD, pageSize); err != nil {
+		return err
+	}
+	if mvcc := hf.Header.Flags&HeaderFlagMVCC != 0; mvcc != hf.MVCC {
+		return ErrBadHeader{File: hf.File.Name(), Reason: fmt.Sprintf("file mvcc %v, schema mvcc %v", mvcc, hf.MVCC)}
+	}
+	// the new TxIDs are greater than the ones in the file
+	advanceTxID(hf.Header.TxID)
+	return nil
+}
+
+// reserveTxID raise the TxID high-water mark in header over id, and sync it, before the versions
+// created or deleted by the TxIDs up to id are written, so the TxIDs of the next runs start over them.
+// TxIDReserve TxIDs are reserved at once, so the header is rarely written. bp.mu must be held
+func (hf *HeapFile) reserveTxID(id uint64) error {
+	if id < hf.Header.TxID {
+		return nil
+	}
+	header := *hf.Header
+	header.TxID = id + TxIDReserve
+	buf, err := header.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err = hf.File.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	if err = hf.File.Sync(); err != nil {
+		return err
+	}
+	hf.Header.TxID = header.TxID
+	return nil
+}
@@ -0,0 +1,92 @@
+package newdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTmpHeapFile(t *testing.T, name string, td *TupleDesc) (*HeapFile, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	return NewHeapFile(f, td)
+}
+
+func TestNewHeapFile_Header(t *testing.T) {
+	name, err := TmpDataFile()
+	require.NoError(t, err)
+	td := GetTupleDesc(2, "h")
+	hf, err := openTmpHeapFile(t, name, td)
+	require.NoError(t, err)
+	assert.Equal(t, HeapFileVersion, hf.Header.Version)
+	assert.Equal(t, uint32(DB.B().PageSize()), hf.Header.PageSize)
+	assert.Equal(t, int64(0), hf.NumPagesInFile())
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(DB.B().PageSize()), info.Size(), "only the header page")
+
+	hf, err = openTmpHeapFile(t, name, td)
+	require.NoError(t, err, "reopen with the same schema")
+	header, err := ReadHeapFileHeader(hf.File)
+	require.NoError(t, err)
+	assert.Equal(t, NewHeapFileHeader(name, td, DB.B().PageSize()), header)
+
+	_, err = openTmpHeapFile(t, name, GetTupleDesc(3, "h"))
+	require.Error(t, err)
+	assert.IsType(t, ErrBadHeader{}, err)
+	assert.Contains(t, err.Error(), "schema fingerprint")
+}
+
+func TestNewHeapFile_BadHeader(t *testing.T) {
+	td := GetTupleDesc(1, "h")
+	var tests = []struct {
+		name   string
+		modify func(h *HeapFileHeader)
+		reason string
+	}{
+		{"magic", func(h *HeapFileHeader) { copy(h.Magic[:], "SQLite f") }, "bad magic"},
+		{"version", func(h *HeapFileHeader) { h.Version = HeapFileVersion + 1 }, "unsupported format version"},
+		{"page_size", func(h *HeapFileHeader) { h.PageSize = 16384 }, "page size 16384"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, err := TmpDataFile()
+			require.NoError(t, err)
+			header := NewHeapFileHeader(name, td, DB.B().PageSize())
+			test.modify(header)
+			buf, err := header.MarshalBinary()
+			require.NoError(t, err)
+			assert.Len(t, buf, HeapFileHeaderSize)
+			f, err := os.OpenFile(name, os.O_RDWR, 0666)
+			require.NoError(t, err)
+			_, err = f.Write(buf)
+			require.NoError(t, err)
+			_, err = NewHeapFile(f, td)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.reason)
+		})
+	}
+
+	name, err := TmpDataFile()
+	require.NoError(t, err)
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("short"))
+	require.NoError(t, err)
+	_, err = NewHeapFile(f, td)
+	assert.IsType(t, ErrBadHeader{}, err)
+}
+
+func TestNewDatabaseWithOptions(t *testing.T) {
+	db, err := NewDatabaseWithOptions(&Options{PageSize: 8192, PageNum: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 8192, db.B().PageSize())
+	assert.Equal(t, DefaultPageSize, DefaultOptions().PageSize)
+
+	_, err = NewDatabaseWithOptions(&Options{PageSize: 100, PageNum: 10})
+	assert.Error(t, err)
+	_, err = NewDatabaseWithOptions(&Options{PageSize: 4096})
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package newdb
+
+import "fmt"
+
+// IntHistogram the equi-width histogram of int64 values,
+// the values are in [Min, Max], and divided into len(Buckets) buckets of the same width
+type IntHistogram struct {
+	Min     int64   `json:"min"`
+	Max     int64   `json:"max"`
+	Buckets []int64 `json:"buckets"`
+	Total   int64   `json:"total"`
+}
+
+// NewIntHistogram new histogram with buckets in [min, max], the buckets is no more than max-min+1
+func NewIntHistogram(buckets int, min, max int64) *IntHistogram {
+	if buckets <= 0 {
+		buckets = 1
+	}
+	if span := float64(max) - float64(min) + 1; span < float64(buckets) {
+		buckets = int(span)
+	}
+	return &IntHistogram{Min: min, Max: max, Buckets: make([]int64, buckets)}
+}
+
+// width the width of every bucket, in float64 because max-min could overflow int64
+func (h *IntHistogram) width() float64 {
+	return (float64(h.Max) - float64(h.Min) + 1) / float64(len(h.Buckets))
+}
+
+// bucket the index of bucket where v is in, v must be in [Min, Max]
+func (h *IntHistogram) bucket(v int64) int {
+	b := int((float64(v) - float64(h.Min)) / h.width())
+	if b >= len(h.Buckets) {
+		b = len(h.Buckets) - 1
+	}
+	return b
+}
+
+// AddValue add v into histogram, v out of [Min, Max] is counted in the edge bucket,
+// as the table may be changed after the range is computed
+func (h *IntHistogram) AddValue(v int64) {
+	if v < h.Min {
+		v = h.Min
+	} else if v > h.Max {
+		v = h.Max
+	}
+	h.Buckets[h.bucket(v)]++
+	h.Total++
+}
+
+// EstimateSelectivity the estimated fraction of values satisfy `value op v`
+func (h *IntHistogram) EstimateSelectivity(op Op, v int64) float64 {
+	switch op {
+	case OpEquals:
+		return h.selectivityEq(v)
+	case OpNotEquals:
+		return 1 - h.selectivityEq(v)
+	case OpGreaterThan:
+		return h.selectivityGt(v)
+	case OpGreaterThanOrEq:
+		return clamp01(h.selectivityGt(v) + h.selectivityEq(v))
+	case OpLessThan:
+		return clamp01(1 - h.selectivityGt(v) - h.selectivityEq(v))
+	case OpLessThanOrEq:
+		return clamp01(1 - h.selectivityGt(v))
+	}
+	return DefaultSelectivity
+}
+
+func (h *IntHistogram) selectivityEq(v int64) float64 {
+	if h.Total == 0 || v < h.Min || v > h.Max {
+		return 0
+	}
+	width := h.width()
+	if width < 1 {
+		width = 1
+	}
+	return clamp01(float64(h.Buckets[h.bucket(v)]) / width / float64(h.Total))
+}
+
+func (h *IntHistogram) selectivityGt(v int64) float64 {
+	if h.Total == 0 || v >= h.Max {
+		return 0
+	}
+	if v < h.Min {
+		return 1
+	}
+	b := h.bucket(v)
+	width := h.width()
+	right := float64(h.Min) + float64(b+1)*width
+	// the part of bucket b greater than v
+	frac := (right - float64(v) - 1) / width
+	count := float64(h.Buckets[b]) * clamp01(frac)
+	for _, n := range h.Buckets[b+1:] {
+		count += float64(n)
+	}
+	return clamp01(count / float64(h.Total))
+}
+
+// AvgSelectivity the average selectivity of equality of the values in histogram
+func (h *IntHistogram) AvgSelectivity() float64 {
+	if h.Total == 0 {
+		return 0
+	}
+	return clamp01(1 / (float64(h.Max) - float64(h.Min) + 1))
+}
+
+func (h *IntHistogram) String() string {
+	return fmt.Sprintf("IntHistogram[%v, %v] buckets=%v total=%v", h.Min, h.Max, h.Buckets, h.Total)
+}
+
+func clamp01(f float64) float64 {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
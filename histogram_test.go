@@ -0,0 +1,58 @@
+package newdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntHistogram_EstimateSelectivity(t *testing.T) {
+	h := NewIntHistogram(10, 1, 100)
+	for v := int64(1); v <= 100; v++ {
+		h.AddValue(v)
+	}
+	assert.Equal(t, int64(100), h.Total)
+
+	assert.InDelta(t, 0.01, h.EstimateSelectivity(OpEquals, 50), 0.001)
+	assert.InDelta(t, 0.99, h.EstimateSelectivity(OpNotEquals, 50), 0.001)
+	assert.InDelta(t, 0.5, h.EstimateSelectivity(OpGreaterThan, 50), 0.001)
+	assert.InDelta(t, 0.51, h.EstimateSelectivity(OpGreaterThanOrEq, 50), 0.001)
+	assert.InDelta(t, 0.49, h.EstimateSelectivity(OpLessThan, 50), 0.001)
+	assert.InDelta(t, 0.5, h.EstimateSelectivity(OpLessThanOrEq, 50), 0.001)
+
+	assert.Equal(t, 0.0, h.EstimateSelectivity(OpEquals, 0))
+	assert.Equal(t, 1.0, h.EstimateSelectivity(OpGreaterThan, 0))
+	assert.Equal(t, 0.0, h.EstimateSelectivity(OpLessThan, 0))
+	assert.Equal(t, 0.0, h.EstimateSelectivity(OpGreaterThan, 100))
+	assert.Equal(t, 1.0, h.EstimateSelectivity(OpLessThanOrEq, 100))
+	assert.Equal(t, DefaultSelectivity, h.EstimateSelectivity(OpLike, 1))
+	assert.InDelta(t, 0.01, h.AvgSelectivity(), 0.001)
+}
+
+func TestIntHistogram_Skew(t *testing.T) {
+	h := NewIntHistogram(100, 0, 3)
+	assert.Len(t, h.Buckets, 4, "no more buckets than values")
+	for i := 0; i < 90; i++ {
+		h.AddValue(0)
+	}
+	for i := 0; i < 10; i++ {
+		h.AddValue(3)
+	}
+	assert.InDelta(t, 0.9, h.EstimateSelectivity(OpEquals, 0), 0.001)
+	assert.InDelta(t, 0.1, h.EstimateSelectivity(OpGreaterThan, 0), 0.001)
+	assert.InDelta(t, 0.0, h.EstimateSelectivity(OpEquals, 1), 0.001)
+
+	wide := NewIntHistogram(10, -1<<62, 1<<62)
+	wide.AddValue(0)
+	assert.InDelta(t, 1.0, wide.EstimateSelectivity(OpGreaterThan, -1<<62), 0.001)
+}
+
+func TestIntHistogram_OutOfRange(t *testing.T) {
+	h := NewIntHistogram(10, 1, 100)
+	h.AddValue(-5)
+	h.AddValue(101)
+	h.AddValue(1 << 62)
+	assert.Equal(t, int64(3), h.Total)
+	assert.Equal(t, int64(1), h.Buckets[0])
+	assert.Equal(t, int64(2), h.Buckets[9])
+}
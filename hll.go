@@ -0,0 +1,91 @@
+package newdb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// DefaultHLLPrecision the default precision of HyperLogLog, 2^12 registers, about 1.6% standard error
+const DefaultHLLPrecision = 12
+
+// HyperLogLog the sketch to estimate the num of distinct values
+type HyperLogLog struct {
+	Precision uint8 `json:"precision"`
+	// Registers the max rank of the hashes in each register
+	Registers []byte `json:"registers"`
+}
+
+// NewHyperLogLog new HyperLogLog with 2^precision registers, precision is in [4, 16]
+func NewHyperLogLog(precision uint8) (*HyperLogLog, error) {
+	if precision < 4 || precision > 16 {
+		return nil, fmt.Errorf("precision %v out of range [4, 16]", precision)
+	}
+	return &HyperLogLog{Precision: precision, Registers: make([]byte, 1<<precision)}, nil
+}
+
+// AddHash add the 64 bits hash of a value
+func (hll *HyperLogLog) AddHash(hash uint64) {
+	index := hash >> (64 - hll.Precision)
+	// the rank is the position of the first 1 bit in the rest bits, start from 1
+	rank := byte(bits.LeadingZeros64(hash<<hll.Precision|1<<(hll.Precision-1)) + 1)
+	if rank > hll.Registers[index] {
+		hll.Registers[index] = rank
+	}
+}
+
+// AddField add the field by the hash of its binary
+func (hll *HyperLogLog) AddField(field Field) error {
+	buf, err := field.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	h := fnv.New64a()
+	h.Write(buf)
+	hll.AddHash(mix64(h.Sum64()))
+	return nil
+}
+
+// mix64 the finalizer of murmur3, spread the bits of fnv, which is weak in the high bits for short input
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// Estimate the estimated num of distinct values
+func (hll *HyperLogLog) Estimate() uint64 {
+	m := float64(len(hll.Registers))
+	var sum float64
+	var zeros int
+	for _, r := range hll.Registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// small range correction by linear counting
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Merge merge other into hll, the precision must be the same
+func (hll *HyperLogLog) Merge(other *HyperLogLog) error {
+	if hll.Precision != other.Precision {
+		return fmt.Errorf("can not merge HyperLogLog of precision %v into %v", other.Precision, hll.Precision)
+	}
+	for i, r := range other.Registers {
+		if r > hll.Registers[i] {
+			hll.Registers[i] = r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package newdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHyperLogLog_Estimate(t *testing.T) {
+	_, err := NewHyperLogLog(3)
+	assert.Error(t, err)
+
+	hll, err := NewHyperLogLog(DefaultHLLPrecision)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), hll.Estimate())
+	for _, n := range []int{10, 1000, 100000} {
+		hll, err = NewHyperLogLog(DefaultHLLPrecision)
+		require.NoError(t, err)
+		for i := 0; i < n; i++ {
+			// every value is added twice
+			require.NoError(t, hll.AddField(NewIntField(int64(i))))
+			require.NoError(t, hll.AddField(NewIntField(int64(i))))
+		}
+		assert.InEpsilon(t, n, hll.Estimate(), 0.05, "n=%v", n)
+	}
+}
+
+func TestHyperLogLog_Merge(t *testing.T) {
+	a, err := NewHyperLogLog(10)
+	require.NoError(t, err)
+	b, err := NewHyperLogLog(10)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, a.AddField(NewIntField(int64(i))))
+		require.NoError(t, b.AddField(NewIntField(int64(i+500))))
+	}
+	require.NoError(t, a.Merge(b))
+	assert.InEpsilon(t, 1500, a.Estimate(), 0.1)
+
+	c, err := NewHyperLogLog(11)
+	require.NoError(t, err)
+	assert.Error(t, a.Merge(c))
+}
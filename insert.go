@@ -0,0 +1,126 @@
+package newdb
+
+import (
+	"context"
+	"fmt"
+)
+
+var _ OpIterator = (*Insert)(nil)
+
+// Insert insert every tuple read from the child into the table,
+// and return one tuple with the number of inserted tuples
+type Insert struct {
+	TxID    *TxID
+	Child   OpIterator
+	TableID string
+
+	td   *TupleDesc
+	ctx  context.Context
+	open bool
+	done bool
+
+	Err error
+}
+
+// NewInsert create new Insert, the field types of child must be the same as the table
+func NewInsert(txID *TxID, child OpIterator, tableID string) *Insert {
+	ret := &Insert{TxID: txID, Child: child, TableID: tableID}
+	dbFile := DB.C().GetTableByID(tableID)
+	if dbFile == nil {
+		ret.Err = fmt.Errorf("no table %v", tableID)
+		return ret
+	}
+	ret.td = dbFile.TupleDesc()
+	if !ret.td.EqualTypes(child.TupleDesc()) {
+		ret.Err = fmt.Errorf("child TupleDesc %v not match table %v", child.TupleDesc(), ret.td)
+	}
+	return ret
+}
+
+// Open open the child
+func (in *Insert) Open(ctx context.Context) error {
+	if in.Err != nil {
+		return in.Err
+	}
+	in.ctx = ctx
+	if in.Err = in.Child.Open(ctx); in.Err != nil {
+		return in.Err
+	}
+	in.open = true
+	in.done = false
+	return nil
+}
+
+// Close close the child
+func (in *Insert) Close() {
+	in.Child.Close()
+	in.open = false
+}
+
+// HasNext the count tuple is only returned once
+func (in *Insert) HasNext() bool {
+	if !in.open {
+		in.Err = fmt.Errorf("Operator not yet open")
+		return false
+	}
+	return !in.done
+}
+
+// Next do the insert, and return the count tuple
+func (in *Insert) Next() *Tuple {
+	if !in.HasNext() {
+		if in.Err == nil {
+			in.Err = fmt.Errorf("no such element")
+		}
+		return nil
+	}
+	in.done = true
+	var count int64
+	for in.Child.HasNext() {
+		child := in.Child.Next()
+		if in.Err = in.Child.Error(); in.Err != nil {
+			abortIfDone(in.ctx, in.TxID)
+			return nil
+		}
+		tuple := &Tuple{TD: in.td, Fields: child.Fields}
+		if in.Err = DB.B().InsertTuple(in.ctx, in.TxID, in.TableID, tuple); in.Err != nil {
+			abortIfDone(in.ctx, in.TxID)
+			return nil
+		}
+		count++
+	}
+	if in.Err = in.Child.Error(); in.Err != nil {
+		abortIfDone(in.ctx, in.TxID)
+		return nil
+	}
+	return &Tuple{TD: CountTupleDesc(), Fields: []Field{NewIntField(count)}}
+}
+
+// Rewind rewind the child, the tuples could be inserted again
+func (in *Insert) Rewind() error {
+	if in.Err = in.Child.Rewind(); in.Err != nil {
+		return in.Err
+	}
+	in.done = false
+	return nil
+}
+
+// TupleDesc the count TupleDesc
+func (in *Insert) TupleDesc() *TupleDesc {
+	return CountTupleDesc()
+}
+
+// Explain one count tuple, the cost is to read the child
+func (in *Insert) Explain() *PlanNode {
+	child := in.Child.Explain()
+	return &PlanNode{Operator: "Insert", Detail: fmt.Sprintf("table=%v", in.TableID), Rows: 1, Cost: child.Cost + cpuCost(child.Rows), Children: []*PlanNode{child}}
+}
+
+func (in *Insert) children() []*OpIterator {
+	return []*OpIterator{&in.Child}
+}
+
+// Error return error
+func (in *Insert) Error() error {
+	return in.Err
+}
@@ -0,0 +1,100 @@
+package newdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsert(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	txID := NewTxID()
+	insert := NewInsert(txID, NewMockScan(0, 10, 2), tableID)
+	require.NoError(t, insert.Error())
+	assert.Equal(t, CountTupleDesc(), insert.TupleDesc())
+	require.NoError(t, insert.Open(context.Background()))
+	require.True(t, insert.HasNext())
+	count := insert.Next()
+	require.NoError(t, insert.Error())
+	assert.Equal(t, "int(10)", count.String())
+	assert.False(t, insert.HasNext())
+	insert.Close()
+
+	scan := NewSeqScan(txID, tableID, "t")
+	require.NoError(t, scan.Open(context.Background()))
+	var i int64
+	for scan.HasNext() {
+		tuple := scan.Next()
+		require.NotNil(t, tuple)
+		assert.Equal(t, NewIntField(i), tuple.Fields[0])
+		assert.Equal(t, DB.C().GetTableByID(tableID).TupleDesc(), tuple.TD)
+		i++
+	}
+	assert.Equal(t, int64(10), i)
+}
+
+func TestInsert_TupleDescNotMatch(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	insert := NewInsert(NewTxID(), NewMockScan(0, 10, 3), tableID)
+	assert.Error(t, insert.Error())
+	assert.Error(t, insert.Open(context.Background()))
+
+	insert = NewInsert(NewTxID(), NewMockScan(0, 10, 2), "no-such-table")
+	assert.Error(t, insert.Open(context.Background()))
+}
+
+// cancelAfter cancel the ctx after n tuples are read
+type cancelAfter struct {
+	OpIterator
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfter) Next() *Tuple {
+	if c.n--; c.n == 0 {
+		c.cancel()
+	}
+	return c.OpIterator.Next()
+}
+
+func TestInsert_CanceledAbort(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	txID := NewTxID()
+	ctx, cancel := context.WithCancel(context.Background())
+	insert := NewInsert(txID, &cancelAfter{OpIterator: NewMockScan(0, 1000, 2), n: 10, cancel: cancel}, tableID)
+	require.NoError(t, insert.Open(ctx))
+	assert.Nil(t, insert.Next())
+	assert.Equal(t, context.Canceled, insert.Error())
+
+	// the dirty pages of txID are discarded
+	for _, page := range DB.B().PageID2Page {
+		if dirty := page.IsDirty(); dirty != nil {
+			assert.NotEqual(t, txID.ID, dirty.ID)
+		}
+	}
+	scan := NewSeqScan(NewTxID(), tableID, "t")
+	require.NoError(t, scan.Open(context.Background()))
+	assert.False(t, scan.HasNext())
+	assert.NoError(t, scan.Error())
+}
+
+func TestBufferPool_TransactionComplete(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	txID := NewTxID()
+	td := DB.C().GetTableByID(tableID).TupleDesc()
+	require.NoError(t, DB.B().InsertTuple(context.Background(), txID, tableID, &Tuple{TD: td, Fields: GetFields(2)}))
+	require.NoError(t, DB.B().TransactionComplete(txID, true))
+	page, err := DB.B().GetPage(context.Background(), NewTxID(), NewHeapPageID(tableID, 0), PermReadOnly)
+	require.NoError(t, err)
+	assert.Nil(t, page.IsDirty())
+
+	inspect, err := InspectPage(DB.C().GetTableByID(tableID).(*HeapFile), 0)
+	require.NoError(t, err)
+	assert.Len(t, inspect.Tuples, 1, "committed to disk")
+}
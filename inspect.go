@@ -0,0 +1,108 @@
+package newdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anydemo/newdb/pkg/bitset"
+)
+
+// InspectedTuple one occupied slot of the page
+type InspectedTuple struct {
+	Slot   int      `json:"slot"`
+	Fields []string `json:"fields"`
+	Err    string   `json:"err,omitempty"`
+	// Xmin Xmax the version of MVCC table
+	Xmin uint64 `json:"xmin,omitempty"`
+	Xmax uint64 `json:"xmax,omitempty"`
+}
+
+// PageInspection the decoded content of one HeapPage, for debugging
+type PageInspection struct {
+	File       string `json:"file"`
+	Page       int    `json:"page"`
+	LSN        uint64 `json:"lsn"`
+	Checksum   uint32 `json:"checksum"`
+	ChecksumOK bool   `json:"checksum_ok"`
+	// Header the header bitset, see bitset.Bytes.String
+	Header    string           `json:"header"`
+	Slots     int              `json:"slots"`
+	Tuples    []InspectedTuple `json:"tuples"`
+	FreeSlots int              `json:"free_slots"`
+	// FreeBytes the bytes of the free slots and the unused tail of page
+	FreeBytes int `json:"free_bytes"`
+}
+
+// InspectPage read the page from file directly, and decode it even if the checksum is not match
+func InspectPage(hf *HeapFile, pageNum int) (*PageInspection, error) {
+	if pageNum < 0 || int64(pageNum) >= hf.NumPagesInFile() {
+		return nil, fmt.Errorf("page %v out of range [0, %v)", pageNum, hf.NumPagesInFile())
+	}
+	pageSize := DB.B().PageSize()
+	buf := make([]byte, pageSize)
+	n, err := hf.File.ReadAt(buf, hf.pageOffset(pageNum))
+	if err != nil && !(err == io.EOF && n > 0) {
+		return nil, err
+	}
+	layout := hf.layout()
+	numSlots, tupleSize := layout.NumOfTuples(), layout.TupleSize()
+	head := bitset.Bytes(buf[PageReservedSize : PageReservedSize+layout.HeaderSize()])
+	ret := &PageInspection{
+		File:       hf.File.Name(),
+		Page:       pageNum,
+		LSN:        DefaultOrder.Uint64(buf[PageChecksumSize:PageReservedSize]),
+		Checksum:   DefaultOrder.Uint32(buf),
+		ChecksumOK: VerifyPageChecksum(NewHeapPageID(hf.ID(), pageNum), buf) == nil,
+		Header:     head.String(),
+		Slots:      numSlots,
+		FreeBytes:  pageSize - PageReservedSize - layout.HeaderSize() - numSlots*tupleSize,
+	}
+	tuplesStart := PageReservedSize + layout.HeaderSize()
+	for i := 0; i < numSlots; i++ {
+		if !head.Get(uint(i)) {
+			ret.FreeSlots++
+			ret.FreeBytes += tupleSize
+			continue
+		}
+		tuple := InspectedTuple{Slot: i}
+		slot := buf[tuplesStart+i*tupleSize : tuplesStart+(i+1)*tupleSize]
+		if hf.MVCC {
+			tuple.Xmin, tuple.Xmax = DefaultOrder.Uint64(slot), DefaultOrder.Uint64(slot[8:])
+			slot = slot[TupleVersionSize:]
+		}
+		r := bytes.NewReader(slot)
+		for _, item := range hf.TD.TdItems {
+			field, err := item.Type.Parse(r)
+			if err != nil {
+				tuple.Err = err.Error()
+				break
+			}
+			tuple.Fields = append(tuple.Fields, field.String())
+		}
+		ret.Tuples = append(ret.Tuples, tuple)
+	}
+	return ret, nil
+}
+
+// WriteTo write the readable inspection
+func (p *PageInspection) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	checksum := "ok"
+	if !p.ChecksumOK {
+		checksum = "BAD"
+	}
+	fmt.Fprintf(&buf, "%v page %v\n", p.File, p.Page)
+	fmt.Fprintf(&buf, "  lsn: %v  checksum: %08x (%v)\n", p.LSN, p.Checksum, checksum)
+	fmt.Fprintf(&buf, "  header: %v\n", p.Header)
+	fmt.Fprintf(&buf, "  slots: %v  used: %v  free: %v  free bytes: %v\n", p.Slots, len(p.Tuples), p.FreeSlots, p.FreeBytes)
+	for _, tuple := range p.Tuples {
+		line := strings.Join(tuple.Fields, "\t")
+		if tuple.Err != "" {
+			line += "\terr: " + tuple.Err
+		}
+		fmt.Fprintf(&buf, "  [%v]\t%v\n", tuple.Slot, line)
+	}
+	return buf.WriteTo(w)
+}
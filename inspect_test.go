@@ -0,0 +1,45 @@
+package newdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectPage(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	scan := NewMockScan(0, 3, 2)
+	require.NoError(t, scan.Open(context.Background()))
+	_, err = hf.BulkLoad(scan)
+	require.NoError(t, err)
+
+	p, err := InspectPage(hf, 0)
+	require.NoError(t, err)
+	assert.True(t, p.ChecksumOK)
+	assert.Equal(t, TuplesPerPage(hf.TupleDesc()), p.Slots)
+	assert.Equal(t, p.Slots-3, p.FreeSlots)
+	assert.True(t, strings.HasPrefix(p.Header, "[7 0"), p.Header)
+	assert.Equal(t, []InspectedTuple{
+		{Slot: 0, Fields: []string{"int(0)", "int(0)"}},
+		{Slot: 1, Fields: []string{"int(1)", "int(1)"}},
+		{Slot: 2, Fields: []string{"int(2)", "int(2)"}},
+	}, p.Tuples)
+	used := PageReservedSize + HeapPage{TD: hf.TupleDesc()}.HeaderSize() + 3*hf.TupleDesc().Size()
+	assert.Equal(t, DB.B().PageSize()-used, p.FreeBytes)
+
+	var out strings.Builder
+	_, err = p.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "(ok)")
+	assert.Contains(t, out.String(), "[1]\tint(1)\tint(1)")
+
+	_, err = InspectPage(hf, 1)
+	assert.Error(t, err)
+	_, err = InspectPage(hf, -1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+package newdb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Level the log level
+type Level int32
+
+const (
+	// LevelDebug debug
+	LevelDebug Level = iota
+	// LevelInfo info
+	LevelInfo
+	// LevelWarn warn
+	LevelWarn
+	// LevelError error
+	LevelError
+	// LevelOff nothing is logged
+	LevelOff
+)
+
+// the subsystems of log
+const (
+	LogDB       = "db"
+	LogTx       = "tx"
+	LogHeapFile = "heapfile"
+)
+
+// DefaultLogLevel the initial level of the subsystems, only the warnings and errors are logged
+var DefaultLogLevel = LevelWarn
+
+var levelNames = []string{"debug", "info", "warn", "error", "off"}
+
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parse the name of level, case insensitive
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %v", name)
+}
+
+// Logger the pluggable logger, kv is the alternating keys and values of fields.
+// Log is only called when level is enabled for the subsystem
+type Logger interface {
+	Log(level Level, subsystem string, msg string, kv []interface{})
+}
+
+// LoggerFunc adapt the func to Logger
+type LoggerFunc func(level Level, subsystem string, msg string, kv []interface{})
+
+// Log call f
+func (f LoggerFunc) Log(level Level, subsystem string, msg string, kv []interface{}) {
+	f(level, subsystem, msg, kv)
+}
+
+// NopLogger discard all logs
+var NopLogger Logger = LoggerFunc(func(Level, string, string, []interface{}) {})
+
+type logrusLogger struct {
+	l *logrus.Logger
+}
+
+// NewLogrusLogger write the logs by l, the subsystem is the field "name"
+func NewLogrusLogger(l *logrus.Logger) Logger {
+	return logrusLogger{l: l}
+}
+
+func (ll logrusLogger) Log(level Level, subsystem string, msg string, kv []interface{}) {
+	fields := make(logrus.Fields, len(kv)/2+1)
+	fields["name"] = subsystem
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	entry := ll.l.WithFields(fields)
+	switch level {
+	case LevelDebug:
+		entry.Debug(msg)
+	case LevelInfo:
+		entry.Info(msg)
+	case LevelWarn:
+		entry.Warn(msg)
+	default:
+		entry.Error(msg)
+	}
+}
+
+func newDefaultLogger() Logger {
+	l := logrus.New()
+	// the level is filtered by subsystemLogger
+	l.SetLevel(logrus.DebugLevel)
+	return NewLogrusLogger(l)
+}
+
+var (
+	defaultLogger = newDefaultLogger()
+	// logger the Logger set by SetLogger, type is loggerHolder
+	logger atomic.Value
+)
+
+type loggerHolder struct{ Logger }
+
+func currentLogger() Logger {
+	if holder, ok := logger.Load().(loggerHolder); ok {
+		return holder.Logger
+	}
+	return defaultLogger
+}
+
+var (
+	subsystemsMu sync.Mutex
+	subsystems   = make(map[string]*subsystemLogger)
+)
+
+// subsystemLogger the logger of one subsystem, the level is checked before any field is formatted
+type subsystemLogger struct {
+	name  string
+	level int32
+}
+
+func newSubsystemLogger(name string) *subsystemLogger {
+	subsystemsMu.Lock()
+	defer subsystemsMu.Unlock()
+	if l, ok := subsystems[name]; ok {
+		return l
+	}
+	l := &subsystemLogger{name: name, level: int32(DefaultLogLevel)}
+	subsystems[name] = l
+	return l
+}
+
+// Enabled the level is logged, check it before building the expensive fields
+func (l *subsystemLogger) Enabled(level Level) bool {
+	return level >= Level(atomic.LoadInt32(&l.level))
+}
+
+func (l *subsystemLogger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	currentLogger().Log(level, l.name, msg, kv)
+}
+
+// Debug log at LevelDebug
+func (l *subsystemLogger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+
+// Info log at LevelInfo
+func (l *subsystemLogger) Info(msg string, kv ...interface{}) { l.log(LevelInfo, msg, kv) }
+
+// Warn log at LevelWarn
+func (l *subsystemLogger) Warn(msg string, kv ...interface{}) { l.log(LevelWarn, msg, kv) }
+
+// Error log at LevelError
+func (l *subsystemLogger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+// SetLogger replace the Logger of all subsystems, nil is NopLogger
+func SetLogger(l Logger) {
+	if l == nil {
+		l = NopLogger
+	}
+	logger.Store(loggerHolder{l})
+}
+
+// SetLogLevel set the level of subsystem, see LogDB, LogTx and LogHeapFile
+func SetLogLevel(subsystem string, level Level) {
+	atomic.StoreInt32(&newSubsystemLogger(subsystem).level, int32(level))
+}
+
+// configureLogging apply the logger and levels of opts to the process,
+// the levels of the subsystems not in opts.LogLevels are kept
+func configureLogging(opts *Options) {
+	if opts.Logger != nil {
+		SetLogger(opts.Logger)
+	}
+	for name, level := range opts.LogLevels {
+		SetLogLevel(name, level)
+	}
+}
@@ -0,0 +1,62 @@
+package newdb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError, LevelOff} {
+		parsed, err := ParseLevel(level.String())
+		require.NoError(t, err)
+		assert.Equal(t, level, parsed)
+	}
+	level, err := ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestOptions_Logger(t *testing.T) {
+	var logs []string
+	opts := DefaultOptions()
+	opts.Logger = LoggerFunc(func(level Level, subsystem string, msg string, kv []interface{}) {
+		logs = append(logs, fmt.Sprintf("%v %v %v %v", level, subsystem, msg, kv))
+	})
+	opts.LogLevels = map[string]Level{LogTx: LevelDebug, LogHeapFile: LevelOff}
+	SetLogLevel(LogDB, LevelInfo)
+	_, err := NewDatabaseWithOptions(opts)
+	require.NoError(t, err)
+	defer func() {
+		SetLogger(defaultLogger)
+		for _, name := range []string{LogDB, LogTx, LogHeapFile} {
+			SetLogLevel(name, DefaultLogLevel)
+		}
+	}()
+
+	assert.True(t, txL.Enabled(LevelDebug))
+	assert.False(t, hfLog.Enabled(LevelError))
+	assert.True(t, dbL.Enabled(LevelInfo), "the level set by the embedder is kept")
+	assert.False(t, dbL.Enabled(LevelDebug))
+
+	_, err = NewDatabaseWithOptions(DefaultOptions())
+	require.NoError(t, err)
+	assert.True(t, txL.Enabled(LevelDebug), "not reset by another Database")
+
+	txID := NewTxID()
+	hfLog.Error("not logged")
+	dbL.Debug("not logged")
+	dbL.Info("logged", "k", 1)
+	assert.Equal(t, []string{
+		fmt.Sprintf("debug tx start tx [tx_id %v]", txID.ID),
+		"info db logged [k 1]",
+	}, logs)
+
+	SetLogger(nil)
+	dbL.Error("discard")
+	assert.Len(t, logs, 2)
+}
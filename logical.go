@@ -0,0 +1,467 @@
+package newdb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ColumnRef reference the column Name of the table Alias in the logical plan
+type ColumnRef struct {
+	Table string
+	Name  string
+}
+
+func (c ColumnRef) String() string {
+	return c.Table + "." + c.Name
+}
+
+func (ColumnRef) scalar() {}
+
+func (ConstExpr) scalar() {}
+
+// Scalar the operand of Compare, ColumnRef or ConstExpr
+type Scalar interface {
+	fmt.Stringer
+	scalar()
+}
+
+// Cond the boolean condition of LogicalFilter and LogicalJoin
+type Cond interface {
+	fmt.Stringer
+	// columns the columns referenced by the condition
+	columns() []ColumnRef
+}
+
+var (
+	_ Cond = BoolConst(true)
+	_ Cond = (*Compare)(nil)
+	_ Cond = And(nil)
+	_ Cond = Or(nil)
+	_ Cond = (*Not)(nil)
+)
+
+// BoolConst the constant TRUE or FALSE
+type BoolConst bool
+
+func (b BoolConst) String() string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (BoolConst) columns() []ColumnRef { return nil }
+
+// Compare `Left Op Right`
+type Compare struct {
+	Left  Scalar
+	Op    Op
+	Right Scalar
+}
+
+func (c *Compare) String() string {
+	return fmt.Sprintf("%v %v %v", c.Left, c.Op, c.Right)
+}
+
+func (c *Compare) columns() (ret []ColumnRef) {
+	for _, s := range []Scalar{c.Left, c.Right} {
+		if col, ok := s.(ColumnRef); ok {
+			ret = append(ret, col)
+		}
+	}
+	return
+}
+
+// And the conjunction, TRUE if empty
+type And []Cond
+
+func (a And) String() string {
+	return joinConds([]Cond(a), " AND ", "TRUE")
+}
+
+func (a And) columns() []ColumnRef {
+	return condsColumns([]Cond(a))
+}
+
+// Or the disjunction, FALSE if empty
+type Or []Cond
+
+func (o Or) String() string {
+	return joinConds([]Cond(o), " OR ", "FALSE")
+}
+
+func (o Or) columns() []ColumnRef {
+	return condsColumns([]Cond(o))
+}
+
+// Not the negation
+type Not struct {
+	Cond Cond
+}
+
+func (n *Not) String() string {
+	return fmt.Sprintf("NOT %v", n.Cond)
+}
+
+func (n *Not) columns() []ColumnRef {
+	return n.Cond.columns()
+}
+
+func joinConds(conds []Cond, sep, empty string) string {
+	if len(conds) == 0 {
+		return empty
+	}
+	var ret []string
+	for _, c := range conds {
+		ret = append(ret, c.String())
+	}
+	return "(" + strings.Join(ret, sep) + ")"
+}
+
+func condsColumns(conds []Cond) (ret []ColumnRef) {
+	for _, c := range conds {
+		ret = append(ret, c.columns()...)
+	}
+	return
+}
+
+// conjuncts split the cond by AND, nil cond is TRUE
+func conjuncts(cond Cond) []Cond {
+	switch c := cond.(type) {
+	case nil:
+		return nil
+	case And:
+		var ret []Cond
+		for _, sub := range c {
+			ret = append(ret, conjuncts(sub)...)
+		}
+		return ret
+	}
+	return []Cond{cond}
+}
+
+// conjunction the AND of conds, nil if no conds
+func conjunction(conds []Cond) Cond {
+	switch len(conds) {
+	case 0:
+		return nil
+	case 1:
+		return conds[0]
+	}
+	return And(conds)
+}
+
+// LogicalPlan the node of logical plan, see Rewrite and BuildPlan.
+// The nodes are immutable, the rules return the new nodes
+type LogicalPlan interface {
+	fmt.Stringer
+	// Columns the output columns
+	Columns() []ColumnRef
+	// TupleDesc the output TupleDesc, in the order of Columns
+	TupleDesc() *TupleDesc
+	Children() []LogicalPlan
+	// WithChildren the copy of node with the children replaced
+	WithChildren(children []LogicalPlan) LogicalPlan
+}
+
+var (
+	_ LogicalPlan = (*LogicalScan)(nil)
+	_ LogicalPlan = (*LogicalFilter)(nil)
+	_ LogicalPlan = (*LogicalJoin)(nil)
+	_ LogicalPlan = (*LogicalProject)(nil)
+	_ LogicalPlan = (*LogicalEmpty)(nil)
+)
+
+// LogicalScan scan the table as Alias
+type LogicalScan struct {
+	TableID string
+	Alias   string
+	// Fields the fields of table read by scan, nil for all
+	Fields []int
+
+	td *TupleDesc
+}
+
+// NewLogicalScan new LogicalScan of all fields
+func NewLogicalScan(tableID, alias string) (*LogicalScan, error) {
+	dbFile := DB.C().GetTableByID(tableID)
+	if dbFile == nil {
+		return nil, fmt.Errorf("no table %v", tableID)
+	}
+	return &LogicalScan{TableID: tableID, Alias: alias, td: dbFile.TupleDesc()}, nil
+}
+
+// fields the Fields, all fields of table if nil
+func (s *LogicalScan) fields() []int {
+	if s.Fields != nil {
+		return s.Fields
+	}
+	ret := make([]int, len(s.td.TdItems))
+	for i := range ret {
+		ret[i] = i
+	}
+	return ret
+}
+
+// Columns the Fields of table as Alias
+func (s *LogicalScan) Columns() (ret []ColumnRef) {
+	for _, f := range s.fields() {
+		ret = append(ret, ColumnRef{Table: s.Alias, Name: s.td.TdItems[f].Name})
+	}
+	return
+}
+
+// TupleDesc the TupleDesc of Fields
+func (s *LogicalScan) TupleDesc() *TupleDesc {
+	td, _ := projectTupleDesc(s.td, s.fields())
+	return td
+}
+
+// Children no children
+func (s *LogicalScan) Children() []LogicalPlan { return nil }
+
+// WithChildren scan has no children
+func (s *LogicalScan) WithChildren([]LogicalPlan) LogicalPlan { return s }
+
+func (s *LogicalScan) String() string {
+	if s.Fields != nil {
+		return fmt.Sprintf("Scan(%v AS %v fields=%v)", s.TableID, s.Alias, s.Fields)
+	}
+	return fmt.Sprintf("Scan(%v AS %v)", s.TableID, s.Alias)
+}
+
+// LogicalFilter the tuples of Child satisfy Cond
+type LogicalFilter struct {
+	Cond  Cond
+	Child LogicalPlan
+}
+
+// Columns the columns of child
+func (f *LogicalFilter) Columns() []ColumnRef { return f.Child.Columns() }
+
+// TupleDesc the TupleDesc of child
+func (f *LogicalFilter) TupleDesc() *TupleDesc { return f.Child.TupleDesc() }
+
+// Children the child
+func (f *LogicalFilter) Children() []LogicalPlan { return []LogicalPlan{f.Child} }
+
+// WithChildren new filter of the child
+func (f *LogicalFilter) WithChildren(children []LogicalPlan) LogicalPlan {
+	return &LogicalFilter{Cond: f.Cond, Child: children[0]}
+}
+
+func (f *LogicalFilter) String() string {
+	return fmt.Sprintf("Filter(%v)", f.Cond)
+}
+
+// LogicalJoin the inner join of Left and Right on Cond, nil Cond is the cross join
+type LogicalJoin struct {
+	Left  LogicalPlan
+	Right LogicalPlan
+	Cond  Cond
+}
+
+// Columns the columns of left and then right
+func (j *LogicalJoin) Columns() []ColumnRef {
+	return append(append([]ColumnRef{}, j.Left.Columns()...), j.Right.Columns()...)
+}
+
+// TupleDesc the merged TupleDesc of left and right
+func (j *LogicalJoin) TupleDesc() *TupleDesc {
+	left, right := j.Left.TupleDesc(), j.Right.TupleDesc()
+	return &TupleDesc{TdItems: append(append([]TdItem{}, left.TdItems...), right.TdItems...)}
+}
+
+// Children left and right
+func (j *LogicalJoin) Children() []LogicalPlan { return []LogicalPlan{j.Left, j.Right} }
+
+// WithChildren new join of the children
+func (j *LogicalJoin) WithChildren(children []LogicalPlan) LogicalPlan {
+	return &LogicalJoin{Left: children[0], Right: children[1], Cond: j.Cond}
+}
+
+func (j *LogicalJoin) String() string {
+	if j.Cond == nil {
+		return "Join(cross)"
+	}
+	return fmt.Sprintf("Join(%v)", j.Cond)
+}
+
+// LogicalProject the Cols of child
+type LogicalProject struct {
+	Cols  []ColumnRef
+	Child LogicalPlan
+}
+
+// Columns the Cols
+func (p *LogicalProject) Columns() []ColumnRef { return p.Cols }
+
+// TupleDesc the TupleDesc of Cols, nil if any column is not in child
+func (p *LogicalProject) TupleDesc() *TupleDesc {
+	fields, err := columnIndexes(p.Child.Columns(), p.Cols)
+	if err != nil {
+		return nil
+	}
+	td, _ := projectTupleDesc(p.Child.TupleDesc(), fields)
+	return td
+}
+
+// Children the child
+func (p *LogicalProject) Children() []LogicalPlan { return []LogicalPlan{p.Child} }
+
+// WithChildren new project of the child
+func (p *LogicalProject) WithChildren(children []LogicalPlan) LogicalPlan {
+	return &LogicalProject{Cols: p.Cols, Child: children[0]}
+}
+
+func (p *LogicalProject) String() string {
+	var cols []string
+	for _, c := range p.Cols {
+		cols = append(cols, c.String())
+	}
+	return fmt.Sprintf("Project(%v)", strings.Join(cols, ", "))
+}
+
+// LogicalEmpty no tuples, the result of the always-false filter
+type LogicalEmpty struct {
+	Cols []ColumnRef
+	TD   *TupleDesc
+}
+
+// Columns the Cols
+func (e *LogicalEmpty) Columns() []ColumnRef { return e.Cols }
+
+// TupleDesc the TD
+func (e *LogicalEmpty) TupleDesc() *TupleDesc { return e.TD }
+
+// Children no children
+func (e *LogicalEmpty) Children() []LogicalPlan { return nil }
+
+// WithChildren empty has no children
+func (e *LogicalEmpty) WithChildren([]LogicalPlan) LogicalPlan { return e }
+
+func (e *LogicalEmpty) String() string {
+	return "Empty"
+}
+
+// emptyOf the empty plan of the columns of plan
+func emptyOf(plan LogicalPlan) *LogicalEmpty {
+	return &LogicalEmpty{Cols: plan.Columns(), TD: plan.TupleDesc()}
+}
+
+// FormatPlan the tree of logical plan, one node per line
+func FormatPlan(plan LogicalPlan) string {
+	var buf bytes.Buffer
+	formatPlan(&buf, plan, 0)
+	return buf.String()
+}
+
+func formatPlan(buf *bytes.Buffer, plan LogicalPlan, depth int) {
+	if depth > 0 {
+		buf.WriteString(strings.Repeat("  ", depth-1))
+		buf.WriteString("-> ")
+	}
+	buf.WriteString(plan.String())
+	buf.WriteString("\n")
+	for _, child := range plan.Children() {
+		formatPlan(buf, child, depth+1)
+	}
+}
+
+// columnIndexes the indexes of cols in columns
+func columnIndexes(columns []ColumnRef, cols []ColumnRef) ([]int, error) {
+	var ret []int
+	for _, col := range cols {
+		i := columnIndex(columns, col)
+		if i < 0 {
+			return nil, fmt.Errorf("no column %v", col)
+		}
+		ret = append(ret, i)
+	}
+	return ret, nil
+}
+
+func columnIndex(columns []ColumnRef, col ColumnRef) int {
+	for i, c := range columns {
+		if c == col {
+			return i
+		}
+	}
+	return -1
+}
+
+// BuildPlan build the OpIterator of logical plan, the conditions of filters must be
+// the conjunction of `column op constant`, join is not supported yet
+func BuildPlan(txID *TxID, plan LogicalPlan) (OpIterator, error) {
+	switch p := plan.(type) {
+	case *LogicalScan:
+		scan := NewSeqScan(txID, p.TableID, p.Alias)
+		if scan.Err != nil {
+			return nil, scan.Err
+		}
+		if p.Fields != nil {
+			if err := scan.SelectFields(p.Fields); err != nil {
+				return nil, err
+			}
+		}
+		return scan, nil
+	case *LogicalFilter:
+		child, err := BuildPlan(txID, p.Child)
+		if err != nil {
+			return nil, err
+		}
+		columns := p.Child.Columns()
+		for _, cond := range conjuncts(p.Cond) {
+			if b, ok := cond.(BoolConst); ok {
+				if !b {
+					return NewTupleIterator(child.TupleDesc(), nil), nil
+				}
+				continue
+			}
+			pred, err := predicateOf(columns, cond)
+			if err != nil {
+				return nil, err
+			}
+			child = NewFilter(pred, child)
+		}
+		return child, nil
+	case *LogicalProject:
+		child, err := BuildPlan(txID, p.Child)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := columnIndexes(p.Child.Columns(), p.Cols)
+		if err != nil {
+			return nil, err
+		}
+		return NewProject(fields, child), nil
+	case *LogicalEmpty:
+		return NewTupleIterator(p.TD, nil), nil
+	}
+	return nil, fmt.Errorf("can not build %v, no physical operator", plan)
+}
+
+// predicateOf the Predicate of `column op constant` or `constant op column`
+func predicateOf(columns []ColumnRef, cond Cond) (*Predicate, error) {
+	c, ok := cond.(*Compare)
+	if !ok {
+		return nil, fmt.Errorf("can not build condition %v", cond)
+	}
+	col, ok1 := c.Left.(ColumnRef)
+	val, ok2 := c.Right.(ConstExpr)
+	op := c.Op
+	if !ok1 || !ok2 {
+		col, ok1 = c.Right.(ColumnRef)
+		val, ok2 = c.Left.(ConstExpr)
+		op = op.reverse()
+	}
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("can not build condition %v, only column op constant", cond)
+	}
+	i := columnIndex(columns, col)
+	if i < 0 {
+		return nil, fmt.Errorf("no column %v", col)
+	}
+	return &Predicate{Field: i, Op: op, Operand: val.Val}, nil
+}
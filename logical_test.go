@@ -0,0 +1,87 @@
+package newdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// drain all tuples of it as strings
+func drain(t *testing.T, it OpIterator) (ret []string) {
+	require.NoError(t, it.Open(context.Background()))
+	defer it.Close()
+	for it.HasNext() {
+		tuple := it.Next()
+		require.NoError(t, it.Error())
+		ret = append(ret, tuple.String())
+	}
+	require.NoError(t, it.Error())
+	return
+}
+
+func TestBuildPlan(t *testing.T) {
+	scan := rewriteScan(t, "a")
+	hf := DB.C().GetTableByID(scan.TableID).(*HeapFile)
+	var tuples []*Tuple
+	for i := 0; i < 100; i++ {
+		tuples = append(tuples, &Tuple{TD: hf.TD, Fields: []Field{NewIntField(int64(i)), NewIntField(int64(i % 10)), NewIntField(0)}})
+	}
+	it := NewTupleIterator(hf.TD, tuples)
+	require.NoError(t, it.Open(context.Background()))
+	_, err := hf.BulkLoad(it)
+	require.NoError(t, err)
+
+	plan := &LogicalProject{
+		Cols: []ColumnRef{col("a", "id")},
+		Child: &LogicalFilter{
+			Cond:  And{&Compare{intConst(7), OpEquals, col("a", "v")}, &Compare{col("a", "id"), OpLessThan, intConst(50)}, BoolConst(true)},
+			Child: scan,
+		},
+	}
+	it1, err := BuildPlan(NewTxID(), plan)
+	require.NoError(t, err)
+	rewritten := Rewrite(plan)
+	it2, err := BuildPlan(NewTxID(), rewritten)
+	require.NoError(t, err)
+	want := []string{"int(7)", "int(17)", "int(27)", "int(37)", "int(47)"}
+	assert.Equal(t, want, drain(t, it1))
+	assert.Equal(t, want, drain(t, it2), "the rewritten plan has the same result")
+
+	// the scan of rewritten plan only return id and v
+	var leaf OpIterator = it2
+	for {
+		p, ok := leaf.(parentOp)
+		if !ok {
+			break
+		}
+		leaf = *p.children()[0]
+	}
+	require.IsType(t, &SeqScan{}, leaf)
+	assert.Equal(t, []int{0, 1}, leaf.(*SeqScan).Fields)
+	assert.Len(t, leaf.TupleDesc().TdItems, 2)
+	assert.Equal(t, "id(int64(8))", it2.TupleDesc().String())
+
+	_, err = BuildPlan(NewTxID(), &LogicalJoin{Left: scan, Right: rewriteScan(t, "b")})
+	assert.Error(t, err, "no join operator")
+	_, err = BuildPlan(NewTxID(), &LogicalFilter{Cond: &Compare{col("a", "id"), OpEquals, col("a", "v")}, Child: scan})
+	assert.Error(t, err, "only column op constant")
+	_, err = BuildPlan(NewTxID(), &LogicalFilter{Cond: &Compare{col("x", "id"), OpEquals, intConst(1)}, Child: scan})
+	assert.Error(t, err, "no such column")
+}
+
+func TestLogicalPlan_Columns(t *testing.T) {
+	a, b := rewriteScan(t, "a"), rewriteScan(t, "b")
+	join := &LogicalJoin{Left: a, Right: &LogicalScan{TableID: b.TableID, Alias: "b", Fields: []int{2}, td: b.td}}
+	assert.Equal(t, []ColumnRef{col("a", "id"), col("a", "v"), col("a", "pad"), col("b", "pad")}, join.Columns())
+	assert.Len(t, join.TupleDesc().TdItems, 4)
+	assert.Equal(t, "Join(cross)\n-> Scan("+a.TableID+" AS a)\n-> Scan("+b.TableID+" AS b fields=[2])\n", FormatPlan(join))
+
+	project := &LogicalProject{Cols: []ColumnRef{col("b", "pad"), col("a", "id")}, Child: join}
+	assert.Equal(t, "pad(int64(8)),id(int64(8))", project.TupleDesc().String())
+	assert.Nil(t, (&LogicalProject{Cols: []ColumnRef{col("b", "id")}, Child: join}).TupleDesc(), "b.id is not scanned")
+
+	_, err := NewLogicalScan("no-such-table", "x")
+	assert.Error(t, err)
+}
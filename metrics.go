@@ -0,0 +1,134 @@
+package newdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// PoolCounters the counters of BufferPool for the pages of one table
+type PoolCounters struct {
+	// Hits the page is in BufferPool when GetPage
+	Hits uint64 `json:"hits"`
+	// Misses the page is read from disk when GetPage
+	Misses uint64 `json:"misses"`
+	// Evictions the clean pages discarded to make room
+	Evictions uint64 `json:"evictions"`
+	// DirtyWrites the dirty pages written to disk by flush
+	DirtyWrites uint64 `json:"dirty_writes"`
+}
+
+func (s *PoolCounters) add(o PoolCounters) {
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.Evictions += o.Evictions
+	s.DirtyWrites += o.DirtyWrites
+}
+
+// HitRatio hits / (hits + misses), 0 if no page is got
+func (s PoolCounters) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// BufferPoolStats the snapshot of the BufferPool counters
+type BufferPoolStats struct {
+	// Capacity the max num of pages
+	Capacity   int `json:"capacity"`
+	Pages      int `json:"pages"`
+	DirtyPages int `json:"dirty_pages"`
+	// Total the sum of Tables
+	Total PoolCounters `json:"total"`
+	// Tables k is the table id
+	Tables map[string]PoolCounters `json:"tables"`
+}
+
+// tableStats the counters of table, the caller must hold bp.mu
+func (bp *BufferPool) tableStats(tableID string) *PoolCounters {
+	stats, ok := bp.stats[tableID]
+	if !ok {
+		stats = &PoolCounters{}
+		bp.stats[tableID] = stats
+	}
+	return stats
+}
+
+// Stats the snapshot of counters
+func (bp *BufferPool) Stats() BufferPoolStats {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	ret := BufferPoolStats{
+		Capacity: bp.maxSize,
+		Pages:    len(bp.PageID2Page),
+		Tables:   make(map[string]PoolCounters, len(bp.stats)),
+	}
+	for _, page := range bp.PageID2Page {
+		if page.IsDirty() != nil {
+			ret.DirtyPages++
+		}
+	}
+	for tableID, stats := range bp.stats {
+		ret.Tables[tableID] = *stats
+		ret.Total.add(*stats)
+	}
+	return ret
+}
+
+// ResetStats set all counters to 0
+func (bp *BufferPool) ResetStats() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.stats = make(map[string]*PoolCounters)
+}
+
+// WritePrometheus write the stats in prometheus text format, names map the table id to the table name
+func (s BufferPoolStats) WritePrometheus(w io.Writer, names map[string]string) (int64, error) {
+	var buf bytes.Buffer
+	gauge := func(name, help string, val int) {
+		fmt.Fprintf(&buf, "# HELP %v %v\n# TYPE %v gauge\n%v %v\n", name, help, name, name, val)
+	}
+	gauge("newdb_buffer_pool_capacity_pages", "The max num of pages in buffer pool.", s.Capacity)
+	gauge("newdb_buffer_pool_pages", "The num of pages in buffer pool.", s.Pages)
+	gauge("newdb_buffer_pool_dirty_pages", "The num of dirty pages in buffer pool.", s.DirtyPages)
+
+	tableIDs := make([]string, 0, len(s.Tables))
+	for tableID := range s.Tables {
+		tableIDs = append(tableIDs, tableID)
+	}
+	sort.Strings(tableIDs)
+	counters := []struct {
+		name, help string
+		val        func(PoolCounters) uint64
+	}{
+		{"newdb_buffer_pool_hits_total", "The pages found in buffer pool.", func(t PoolCounters) uint64 { return t.Hits }},
+		{"newdb_buffer_pool_misses_total", "The pages read from disk.", func(t PoolCounters) uint64 { return t.Misses }},
+		{"newdb_buffer_pool_evictions_total", "The clean pages evicted.", func(t PoolCounters) uint64 { return t.Evictions }},
+		{"newdb_buffer_pool_dirty_writes_total", "The dirty pages written to disk.", func(t PoolCounters) uint64 { return t.DirtyWrites }},
+	}
+	for _, counter := range counters {
+		fmt.Fprintf(&buf, "# HELP %v %v\n# TYPE %v counter\n", counter.name, counter.help, counter.name)
+		for _, tableID := range tableIDs {
+			fmt.Fprintf(&buf, "%v{table=%q,table_id=%q} %v\n", counter.name, names[tableID], tableID, counter.val(s.Tables[tableID]))
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// MetricsHandler serve the stats of db.BufferPool in prometheus text format,
+// it is mounted by the process running the db, the stats are not shared between processes
+func (db *Database) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names := make(map[string]string, len(db.C().Name2ID))
+		for name, id := range db.C().Name2ID {
+			names[id] = name
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if _, err := db.B().Stats().WritePrometheus(w, names); err != nil {
+			dbL.Error("write metrics", "error", err)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package newdb
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPool_Stats(t *testing.T) {
+	hf := backupTestTable(t, 3*TuplesPerPage(NewTupleDesc(GetTypes(2), GetStrings(2, "f")))+1)
+	bp := NewBufferPool(2)
+	txID := NewTxID()
+	get := func(pageNum int) Page {
+		page, err := bp.GetPage(context.Background(), txID, NewHeapPageID(hf.ID(), pageNum), PermReadOnly)
+		require.NoError(t, err)
+		return page
+	}
+	get(0)
+	get(1)
+	get(0)
+	get(2)
+	stats := bp.Stats()
+	assert.Equal(t, 2, stats.Capacity)
+	assert.Equal(t, 2, stats.Pages)
+	assert.Equal(t, PoolCounters{Hits: 1, Misses: 3, Evictions: 1}, stats.Tables[hf.ID()])
+	assert.Equal(t, stats.Tables[hf.ID()], stats.Total)
+	assert.Equal(t, 0.25, stats.Total.HitRatio())
+
+	// dirty pages are never evicted
+	for _, page := range bp.PageID2Page {
+		page.MarkDirty(txID)
+	}
+	assert.Equal(t, 2, bp.Stats().DirtyPages)
+	get(3)
+	assert.Equal(t, 3, bp.Stats().Pages, "grow over the capacity")
+	require.NoError(t, bp.FlushPages(NewTxID()))
+	assert.Equal(t, 2, bp.Stats().DirtyPages, "only flush the pages of the tx")
+	require.NoError(t, bp.FlushPages(txID))
+	stats = bp.Stats()
+	assert.Equal(t, 0, stats.DirtyPages)
+	assert.Equal(t, uint64(2), stats.Total.DirtyWrites)
+
+	bp.ResetStats()
+	assert.Equal(t, PoolCounters{}, bp.Stats().Total)
+}
+
+func TestBufferPoolStats_WritePrometheus(t *testing.T) {
+	stats := BufferPoolStats{
+		Capacity: 50,
+		Pages:    2,
+		Tables:   map[string]PoolCounters{"id1": {Hits: 3, Misses: 2}},
+	}
+	var buf strings.Builder
+	_, err := stats.WritePrometheus(&buf, map[string]string{"id1": "t"})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "# TYPE newdb_buffer_pool_hits_total counter\nnewdb_buffer_pool_hits_total{table=\"t\",table_id=\"id1\"} 3\n")
+	assert.Contains(t, buf.String(), "newdb_buffer_pool_capacity_pages 50\n")
+
+	w := httptest.NewRecorder()
+	DB.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "newdb_buffer_pool_misses_total")
+}
@@ -0,0 +1,736 @@
+package newdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrWriteConflict the tuple is deleted or updated by another transaction committed after the snapshot,
+// the first committer wins, and the transaction should be aborted
+var ErrWriteConflict = errors.New("write conflict, the tuple is changed by a concurrent transaction")
+
+// ErrSerializationFailure the Serializable transaction read a table changed by another transaction
+// committed after the snapshot, the transaction is aborted at commit
+var ErrSerializationFailure = errors.New("serialization failure, the table read is changed by a concurrent transaction")
+
+// ErrIsolationNotSupported the transaction started by NewTxWithOptions above ReadUncommitted touched
+// a table not MVCC, which is only read uncommitted, as there is no lock manager
+var ErrIsolationNotSupported = errors.New("isolation level not supported, the table is not mvcc and only READ UNCOMMITTED")
+
+// Snapshot the view of MVCC tables for one transaction
+type Snapshot struct {
+	// TxID the changes of TxID itself are visible
+	TxID uint64
+	// Seq the commit seq when taken, the transactions committed at or before Seq are visible
+	Seq uint64
+	// Dirty the latest versions are visible, even if uncommitted, see ReadUncommitted
+	Dirty bool
+}
+
+type txStatus int
+
+const (
+	txActive txStatus = iota
+	txCommitted
+	txAborted
+)
+
+type undoKind int
+
+const (
+	// undoInsert remove the inserted version
+	undoInsert undoKind = iota
+	// undoDelete clear the xmax of the deleted version
+	undoDelete
+)
+
+type undoRecord struct {
+	kind undoKind
+	rid  *RecordID
+}
+
+// mvccTx the state of transaction wrote MVCC tables, or started by NewTx
+type mvccTx struct {
+	status    txStatus
+	isolation IsolationLevel
+	// strict the tables not MVCC are rejected, if isolation is above ReadUncommitted
+	strict bool
+	// snapshot the snapshot of writes, and reads if RepeatableRead or Serializable
+	snapshot  Snapshot
+	commitSeq uint64
+	// writes the snapshot seq when the versions are deleted by recordKey, for first-committer-wins
+	writes map[string]uint64
+	// written the versions inserted and deleted by tableID, for Serializable
+	written map[string][]*Tuple
+	// reads the predicate locks of the scans by tableID, for Serializable
+	reads map[string][]predicateLock
+	// pending the versions being deleted by another active transaction, the xmax is set at commit
+	pending []*RecordID
+	undo    []undoRecord
+	// pages the touched pages by PageID.ID(), written at commit or abort
+	pages map[string]PageID
+}
+
+// TxManager the transactions of MVCC tables.
+//
+// Every tuple of MVCC table is a version with the creator Xmin and deleter Xmax,
+// the version is visible to a snapshot if Xmin is committed before the snapshot, and Xmax is not.
+// Delete and update set Xmax, the update inserts a new version; abort undoes the changes.
+// The pages are written without the changes of the uncommitted transactions, see HeapPage.committedImage,
+// so the TxIDs on disk are of the committed transactions, and the ones of the earlier runs are not in txs.
+// Vacuum reclaims the versions deleted before all snapshots.
+type TxManager struct {
+	// latch serialize the changes of MVCC pages, the readers filter the versions under read lock
+	latch sync.RWMutex
+	// mu guard the fields below
+	mu sync.Mutex
+	// seq the commit seq of the last committed transaction
+	seq uint64
+	txs map[uint64]*mvccTx
+	// readers the snapshots of the scans out of transaction, see acquire
+	readers map[uint64]int
+}
+
+// NewTxManager new TxManager
+func NewTxManager() *TxManager {
+	return &TxManager{
+		txs:     make(map[uint64]*mvccTx),
+		readers: make(map[uint64]int),
+	}
+}
+
+func recordKey(rid *RecordID) string {
+	return fmt.Sprintf("%v#%v", rid.PID.ID(), rid.TupleNum)
+}
+
+// Begin BeginWith DefaultIsolationLevel
+func (tm *TxManager) Begin(txID *TxID) Snapshot {
+	return tm.BeginWith(txID, DefaultIsolationLevel)
+}
+
+// BeginWith take the snapshot of txID, the same snapshot is returned until the transaction completes.
+// the isolation is ignored if txID has begun
+func (tm *TxManager) BeginWith(txID *TxID, isolation IsolationLevel) Snapshot {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.beginWith(txID, isolation).snapshot
+}
+
+// beginStrict BeginWith, and the transaction can not touch the tables not MVCC above ReadUncommitted,
+// see checkIsolation
+func (tm *TxManager) beginStrict(txID *TxID, isolation IsolationLevel) Snapshot {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	st := tm.beginWith(txID, isolation)
+	st.strict = true
+	return st.snapshot
+}
+
+// checkIsolation ErrIsolationNotSupported if the strict transaction above ReadUncommitted touches hf not MVCC
+func (tm *TxManager) checkIsolation(txID *TxID, hf *HeapFile) error {
+	if hf.MVCC {
+		return nil
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if st, ok := tm.txs[txID.ID]; ok && st.strict && st.isolation > ReadUncommitted {
+		return ErrIsolationNotSupported
+	}
+	return nil
+}
+
+// begin the transaction wrote MVCC tables before BeginWith is DefaultIsolationLevel
+func (tm *TxManager) begin(txID *TxID) *mvccTx {
+	return tm.beginWith(txID, DefaultIsolationLevel)
+}
+
+func (tm *TxManager) beginWith(txID *TxID, isolation IsolationLevel) *mvccTx {
+	if st, ok := tm.txs[txID.ID]; ok {
+		return st
+	}
+	st := &mvccTx{
+		isolation: isolation,
+		snapshot:  Snapshot{TxID: txID.ID, Seq: tm.seq},
+		writes:    make(map[string]uint64),
+		written:   make(map[string][]*Tuple),
+		reads:     make(map[string][]predicateLock),
+		pages:     make(map[string]PageID),
+	}
+	tm.txs[txID.ID] = st
+	return st
+}
+
+// active the transaction begun and not completed
+func (tm *TxManager) active(txID *TxID) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	st, ok := tm.txs[txID.ID]
+	return ok && st.status == txActive
+}
+
+// predicateLock the conjunction of predicates over the fields of table, the versions matched are read.
+// the empty one matches all versions, the whole table is read
+type predicateLock []*Predicate
+
+func (l predicateLock) matches(tuple *Tuple) bool {
+	for _, pred := range l {
+		if !pred.Filter(tuple) {
+			return false
+		}
+	}
+	return true
+}
+
+// acquire the snapshot of the statement reading the versions of tableID matched by lock, kept until release.
+// it is the snapshot of txID if RepeatableRead or Serializable, or else a new one
+func (tm *TxManager) acquire(txID *TxID, tableID string, lock predicateLock) (Snapshot, func()) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	snap := Snapshot{TxID: txID.ID, Seq: tm.seq}
+	if st, ok := tm.txs[txID.ID]; ok && st.status == txActive {
+		st.reads[tableID] = append(st.reads[tableID], lock)
+		switch st.isolation {
+		case RepeatableRead, Serializable:
+			return st.snapshot, func() {}
+		}
+		// the later writes of the transaction are checked against the new snapshot
+		st.snapshot.Seq = snap.Seq
+		snap.Dirty = st.isolation == ReadUncommitted
+	}
+	tm.readers[snap.Seq]++
+	var once sync.Once
+	return snap, func() {
+		once.Do(func() {
+			tm.mu.Lock()
+			defer tm.mu.Unlock()
+			if tm.readers[snap.Seq]--; tm.readers[snap.Seq] <= 0 {
+				delete(tm.readers, snap.Seq)
+			}
+		})
+	}
+}
+
+// committedIn the transaction id is committed and visible to snap, mu must be held
+func (tm *TxManager) committedIn(id uint64, snap Snapshot) bool {
+	st, ok := tm.txs[id]
+	if !ok {
+		// committed by an earlier run, or pruned after committed before all snapshots
+		return true
+	}
+	return st.status == txCommitted && st.commitSeq <= snap.Seq
+}
+
+// visible the version is visible to snap, mu must be held
+func (tm *TxManager) visible(snap Snapshot, tuple *Tuple) bool {
+	if snap.Dirty {
+		// the versions of the aborted transactions are undone, and the pending deletes have no xmax
+		return tuple.Xmax == 0 || tuple.Xmax != snap.TxID && tm.aborted(tuple.Xmax)
+	}
+	if tuple.Xmin != snap.TxID && !tm.committedIn(tuple.Xmin, snap) {
+		return false
+	}
+	if tuple.Xmax == 0 {
+		return true
+	}
+	if tuple.Xmax == snap.TxID {
+		return false
+	}
+	return !tm.committedIn(tuple.Xmax, snap)
+}
+
+// aborted the transaction is aborted and its changes are being undone, or failed to undo, mu must be held
+func (tm *TxManager) aborted(id uint64) bool {
+	st, ok := tm.txs[id]
+	return ok && st.status == txAborted
+}
+
+// uncommitted the TxIDs of the active and aborted transactions, their changes are not written to disk
+func (tm *TxManager) uncommitted() map[uint64]bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	ret := make(map[uint64]bool)
+	for id, st := range tm.txs {
+		if st.status != txCommitted {
+			ret[id] = true
+		}
+	}
+	return ret
+}
+
+// committedImage the page without the versions created by uncommitted, and with their deletes undone,
+// it is a copy if partial, some changes are left out
+func (hp *HeapPage) committedImage(uncommitted map[uint64]bool) (ret *HeapPage, partial bool) {
+	ret = hp
+	for slot, tuple := range hp.Tuples {
+		if tuple == nil || !uncommitted[tuple.Xmin] && !uncommitted[tuple.Xmax] {
+			continue
+		}
+		if !partial {
+			image := *hp
+			image.Head = append([]byte(nil), hp.Head...)
+			image.Tuples = append([]*Tuple(nil), hp.Tuples...)
+			ret, partial = &image, true
+		}
+		if uncommitted[tuple.Xmin] {
+			ret.Bitset().Unset(uint(slot))
+			ret.Tuples[slot] = nil
+			continue
+		}
+		version := *tuple
+		version.Xmax = 0
+		ret.Tuples[slot] = &version
+	}
+	return
+}
+
+// Visible the version is visible to snap
+func (tm *TxManager) Visible(snap Snapshot, tuple *Tuple) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.visible(snap, tuple)
+}
+
+// visibleTuples the versions of the page visible to snap, with only the fields of table if not nil,
+// see BufferPool.getTuples
+func (tm *TxManager) visibleTuples(ctx context.Context, txID *TxID, snap Snapshot, hf *HeapFile, pid PageID, td *TupleDesc, fields []int) ([]*Tuple, error) {
+	tm.latch.RLock()
+	defer tm.latch.RUnlock()
+	var tuples []*Tuple
+	if fields != nil {
+		var err error
+		if tuples, err = DB.B().getTuples(ctx, hf, pid, td, fields); err != nil {
+			return nil, err
+		}
+	} else {
+		page, err := DB.B().GetPage(ctx, txID, pid, PermReadOnly)
+		if err != nil {
+			return nil, err
+		}
+		hp, ok := page.(*HeapPage)
+		if !ok {
+			return nil, fmt.Errorf("page is not HeapPage: %T", page)
+		}
+		tuples = hp.Tuples
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	var ret []*Tuple
+	for _, tuple := range tuples {
+		if tuple != nil && tm.visible(snap, tuple) {
+			ret = append(ret, tuple)
+		}
+	}
+	return ret, nil
+}
+
+// insertVersion insert the tuple as the version created by txID
+func (tm *TxManager) insertVersion(ctx context.Context, txID *TxID, hf *HeapFile, tuple *Tuple) ([]Page, error) {
+	tm.latch.Lock()
+	defer tm.latch.Unlock()
+	return tm.insertLocked(ctx, txID, hf, tuple)
+}
+
+func (tm *TxManager) insertLocked(ctx context.Context, txID *TxID, hf *HeapFile, tuple *Tuple) ([]Page, error) {
+	tm.mu.Lock()
+	st := tm.begin(txID)
+	tm.mu.Unlock()
+	tuple.Xmin, tuple.Xmax = txID.ID, 0
+	pages, err := hf.insertTuple(ctx, txID, tuple)
+	if err != nil {
+		return nil, err
+	}
+	// keep the pages in BufferPool before the latch is released, the appended page is not on disk
+	for _, page := range pages {
+		if err = DB.B().keepDirty(ctx, txID, page); err != nil {
+			return nil, err
+		}
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	st.undo = append(st.undo, undoRecord{kind: undoInsert, rid: tuple.RecordID})
+	st.written[hf.ID()] = append(st.written[hf.ID()], tuple)
+	for _, page := range pages {
+		st.pages[page.PageID().ID()] = page.PageID()
+	}
+	return pages, nil
+}
+
+// deleteVersion set the xmax of the version to txID, the version must be visible to txID,
+// ErrWriteConflict if it is deleted by a transaction committed after the snapshot
+func (tm *TxManager) deleteVersion(ctx context.Context, txID *TxID, hf *HeapFile, tuple *Tuple) ([]Page, error) {
+	tm.latch.Lock()
+	defer tm.latch.Unlock()
+	return tm.deleteLocked(ctx, txID, hf, tuple)
+}
+
+func (tm *TxManager) deleteLocked(ctx context.Context, txID *TxID, hf *HeapFile, tuple *Tuple) ([]Page, error) {
+	page, err := hf.heapPageOf(ctx, txID, tuple)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := page.slotOf(tuple)
+	if err != nil {
+		return nil, err
+	}
+	cur, rid := page.Tuples[slot], NewRecordID(page.PID, slot)
+	key := recordKey(rid)
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	st := tm.begin(txID)
+	if cur.Xmin != txID.ID && !tm.committedIn(cur.Xmin, st.snapshot) {
+		return nil, fmt.Errorf("tuple %v is not visible", key)
+	}
+	switch {
+	case cur.Xmax == txID.ID:
+		return nil, fmt.Errorf("tuple %v is deleted", key)
+	case cur.Xmax == 0 || tm.aborted(cur.Xmax):
+		cur.Xmax = txID.ID
+	case tm.committedIn(cur.Xmax, st.snapshot):
+		return nil, fmt.Errorf("tuple %v is deleted", key)
+	case tm.txs[cur.Xmax] != nil && tm.txs[cur.Xmax].status == txActive:
+		// the first committer of them wins
+		st.pending = append(st.pending, rid)
+	default:
+		return nil, ErrWriteConflict
+	}
+	st.writes[key] = st.snapshot.Seq
+	st.written[hf.ID()] = append(st.written[hf.ID()], cur)
+	st.undo = append(st.undo, undoRecord{kind: undoDelete, rid: rid})
+	st.pages[page.PID.ID()] = page.PID
+	if err = DB.B().keepDirty(ctx, txID, page); err != nil {
+		return nil, err
+	}
+	return []Page{page}, nil
+}
+
+// updateVersion delete the old version and insert the new one
+func (tm *TxManager) updateVersion(ctx context.Context, txID *TxID, hf *HeapFile, old *Tuple, tuple *Tuple) ([]Page, error) {
+	tm.latch.Lock()
+	defer tm.latch.Unlock()
+	ret, err := tm.deleteLocked(ctx, txID, hf, old)
+	if err != nil {
+		return nil, err
+	}
+	inserted, err := tm.insertLocked(ctx, txID, hf, tuple)
+	if err != nil {
+		return nil, err
+	}
+	return append(ret, inserted...), nil
+}
+
+// conflicts ErrWriteConflict if another transaction committed after the snapshot of the delete
+// deleted the same version, ErrSerializationFailure if st is Serializable and another transaction
+// committed after the snapshot inserted or deleted a version matched by the predicate locks of st,
+// so the phantoms are prevented, mu must be held
+func (tm *TxManager) conflicts(st *mvccTx) error {
+	for _, other := range tm.txs {
+		if other == st || other.status != txCommitted {
+			continue
+		}
+		for key, seq := range st.writes {
+			if _, ok := other.writes[key]; ok && other.commitSeq > seq {
+				return ErrWriteConflict
+			}
+		}
+		if st.isolation != Serializable || other.commitSeq <= st.snapshot.Seq {
+			continue
+		}
+		for table, versions := range other.written {
+			for _, lock := range st.reads[table] {
+				for _, version := range versions {
+					if lock.matches(version) {
+						return ErrSerializationFailure
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// complete commit or abort the transaction, the error of conflicts if the commit fails.
+// the touched pages are written to disk, and synced after the latch is released, so the concurrent
+// commits share the fsyncs, see groupSync. nothing is done if txID did not begin.
+// the error of rollback is returned, and the tx stays aborted, its versions are invisible to all
+func (tm *TxManager) complete(txID *TxID, commit bool) error {
+	tm.latch.Lock()
+	tm.mu.Lock()
+	st, ok := tm.txs[txID.ID]
+	if !ok || st.status != txActive {
+		tm.mu.Unlock()
+		tm.latch.Unlock()
+		return nil
+	}
+	var conflict error
+	if commit {
+		conflict = tm.conflicts(st)
+	}
+	if commit && conflict == nil {
+		tm.seq++
+		st.status, st.commitSeq = txCommitted, tm.seq
+	} else {
+		st.status = txAborted
+	}
+	tm.mu.Unlock()
+
+	var err error
+	undone := false
+	if st.status == txCommitted {
+		err = tm.applyPending(txID, st)
+	} else {
+		err = tm.rollback(txID, st)
+		undone = err == nil
+	}
+	pids := make([]PageID, 0, len(st.pages))
+	for _, pid := range st.pages {
+		pids = append(pids, pid)
+	}
+	files, e := DB.B().writeBackPages(pids)
+	if err == nil {
+		err = e
+	}
+	tm.mu.Lock()
+	// the tx failed to roll back is kept aborted, so the versions left are never visible
+	if undone {
+		delete(tm.txs, txID.ID)
+	}
+	tm.prune()
+	tm.mu.Unlock()
+	tm.latch.Unlock()
+	if e = files.sync(); err == nil {
+		err = e
+	}
+	if conflict != nil {
+		txL.Info("abort tx", "error", conflict, "tx_id", txID.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return conflict
+}
+
+// pageOf the HeapPage of rid through BufferPool
+func pageOf(txID *TxID, rid *RecordID) (*HeapPage, error) {
+	page, err := DB.B().GetPage(context.Background(), txID, rid.PID, PermReadWrite)
+	if err != nil {
+		return nil, err
+	}
+	hp, ok := page.(*HeapPage)
+	if !ok {
+		return nil, fmt.Errorf("page is not HeapPage: %T", page)
+	}
+	return hp, nil
+}
+
+// applyPending set the xmax of the pending versions, the other deleters will fail at commit
+func (tm *TxManager) applyPending(txID *TxID, st *mvccTx) error {
+	for _, rid := range st.pending {
+		hp, err := pageOf(txID, rid)
+		if err != nil {
+			return err
+		}
+		if cur := hp.Tuples[rid.TupleNum]; cur != nil {
+			cur.Xmax = txID.ID
+			if err = DB.B().keepDirty(context.Background(), txID, hp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rollback undo the changes of the transaction
+func (tm *TxManager) rollback(txID *TxID, st *mvccTx) error {
+	return tm.undo(txID, st.undo)
+}
+
+// undo the records of txID in reverse order, the latch must be held
+func (tm *TxManager) undo(txID *TxID, records []undoRecord) error {
+	for i := len(records) - 1; i >= 0; i-- {
+		u := records[i]
+		hp, err := pageOf(txID, u.rid)
+		if err != nil {
+			return err
+		}
+		cur := hp.Tuples[u.rid.TupleNum]
+		switch {
+		case cur == nil:
+			continue
+		case u.kind == undoInsert && cur.Xmin == txID.ID:
+			hp.Bitset().Unset(uint(u.rid.TupleNum))
+			hp.Tuples[u.rid.TupleNum] = nil
+			hf := DB.C().GetTableByID(u.rid.PID.TableID()).(*HeapFile)
+			fsm, err := hf.FreeSpaceMap()
+			if err != nil {
+				return err
+			}
+			if err = fsm.Set(u.rid.PID.PageNum(), true); err != nil {
+				return err
+			}
+		case u.kind == undoDelete && cur.Xmax == txID.ID:
+			cur.Xmax = 0
+		default:
+			continue
+		}
+		if err = DB.B().keepDirty(context.Background(), txID, hp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// horizon the versions deleted by the transactions committed at or before horizon are
+// invisible to all snapshots, mu must be held
+func (tm *TxManager) horizon() uint64 {
+	ret := tm.seq
+	for _, st := range tm.txs {
+		if st.status == txActive && st.snapshot.Seq < ret {
+			ret = st.snapshot.Seq
+		}
+	}
+	for seq := range tm.readers {
+		if seq < ret {
+			ret = seq
+		}
+	}
+	return ret
+}
+
+// prune forget the committed transactions before the horizon, mu must be held
+func (tm *TxManager) prune() {
+	horizon := tm.horizon()
+	for id, st := range tm.txs {
+		if st.status == txCommitted && st.commitSeq <= horizon {
+			delete(tm.txs, id)
+		}
+	}
+}
+
+// deadBefore the version is deleted by a transaction committed at or before horizon, mu must be held
+func (tm *TxManager) deadBefore(tuple *Tuple, horizon uint64) bool {
+	if tuple.Xmax == 0 {
+		return false
+	}
+	return tm.committedIn(tuple.Xmax, Snapshot{Seq: horizon})
+}
+
+// Vacuum reclaim the slots of the versions of hf no snapshot can see, return the num of reclaimed versions.
+// the latch is taken page by page, so the transactions go on meanwhile, and the reclaimed pages are
+// written at last with one sync
+func (tm *TxManager) Vacuum(ctx context.Context, hf *HeapFile) (int, error) {
+	if !hf.MVCC {
+		return 0, fmt.Errorf("table %v is not mvcc", hf.ID())
+	}
+	// the snapshots taken later are after the horizon
+	tm.mu.Lock()
+	horizon := tm.horizon()
+	tm.mu.Unlock()
+	fsm, err := hf.FreeSpaceMap()
+	if err != nil {
+		return 0, err
+	}
+	txID := NewTxID()
+	var (
+		ret  int
+		pids []PageID
+	)
+	for pageNum := 0; int64(pageNum) < hf.NumPagesInFile(); pageNum++ {
+		pid := NewHeapPageID(hf.ID(), pageNum)
+		reclaimed, err := tm.vacuumPage(ctx, txID, pid, horizon)
+		if err != nil {
+			return ret, err
+		}
+		if reclaimed == 0 {
+			continue
+		}
+		ret += reclaimed
+		pids = append(pids, pid)
+		if err = fsm.Set(pageNum, true); err != nil {
+			return ret, err
+		}
+	}
+	tm.latch.RLock()
+	files, err := DB.B().writeBackPages(pids)
+	tm.latch.RUnlock()
+	if err != nil {
+		return ret, err
+	}
+	if err = files.sync(); err != nil {
+		return ret, err
+	}
+	if ret > 0 {
+		txL.Info("vacuum", "table", hf.ID(), "reclaimed", ret, "horizon", horizon)
+	}
+	return ret, nil
+}
+
+// vacuumPage reclaim the slots of the versions deleted before horizon in the page under the latch,
+// the page is kept dirty in BufferPool if any is reclaimed
+func (tm *TxManager) vacuumPage(ctx context.Context, txID *TxID, pid PageID, horizon uint64) (int, error) {
+	tm.latch.Lock()
+	defer tm.latch.Unlock()
+	page, err := DB.B().GetPage(ctx, txID, pid, PermReadWrite)
+	if err != nil {
+		return 0, err
+	}
+	hp := page.(*HeapPage)
+	reclaimed := 0
+	tm.mu.Lock()
+	for slot, tuple := range hp.Tuples {
+		if tuple != nil && tm.deadBefore(tuple, horizon) {
+			hp.Bitset().Unset(uint(slot))
+			hp.Tuples[slot] = nil
+			reclaimed++
+		}
+	}
+	tm.mu.Unlock()
+	if reclaimed == 0 {
+		return 0, nil
+	}
+	return reclaimed, DB.B().keepDirty(ctx, txID, hp)
+}
+
+// VacuumAll vacuum all MVCC tables in catalog
+func (db *Database) VacuumAll(ctx context.Context) (int, error) {
+	var ret int
+	for _, dbFile := range db.C().TableID2DBFile {
+		hf, ok := dbFile.(*HeapFile)
+		if !ok || !hf.MVCC {
+			continue
+		}
+		n, err := db.T().Vacuum(ctx, hf)
+		ret += n
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// StartVacuum run VacuumAll every interval in background until stop is called
+func (db *Database) StartVacuum(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := db.VacuumAll(ctx); err != nil && ctx.Err() == nil {
+					txL.Error("vacuum", "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
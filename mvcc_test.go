@@ -0,0 +1,375 @@
+package newdb
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mvccTable create a MVCC table of the ints in a new file
+func mvccTable(t *testing.T, ints ...int64) *HeapFile {
+	name, err := TmpDataFile()
+	require.NoError(t, err)
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	hf, err := NewMVCCHeapFile(f, GetTupleDesc(1, "v"))
+	require.NoError(t, err)
+	DB.C().AddTable(hf, name)
+	if len(ints) > 0 {
+		tx := NewTx()
+		for _, i := range ints {
+			require.NoError(t, DB.B().InsertTuple(context.Background(), tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(i)}}))
+		}
+		require.NoError(t, tx.Commit())
+	}
+	return hf
+}
+
+// scanTuples the visible tuples of hf to txID
+func scanTuples(t *testing.T, txID *TxID, hf *HeapFile) (ret []*Tuple) {
+	scan := NewSeqScan(txID, hf.ID(), "t")
+	require.NoError(t, scan.Open(context.Background()))
+	defer scan.Close()
+	for scan.HasNext() {
+		ret = append(ret, scan.Next())
+	}
+	require.NoError(t, scan.Error())
+	return
+}
+
+func scanStrings(t *testing.T, txID *TxID, hf *HeapFile) (ret []string) {
+	for _, tuple := range scanTuples(t, txID, hf) {
+		ret = append(ret, tuple.String())
+	}
+	return
+}
+
+func TestMVCC_SnapshotIsolation(t *testing.T) {
+	hf := mvccTable(t, 1, 2, 3)
+	reader := NewTx()
+	defer reader.Finish()
+
+	writer := NewTx()
+	ctx := context.Background()
+	require.NoError(t, DB.B().InsertTuple(ctx, writer.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(4)}}))
+	require.NoError(t, DB.B().DeleteTuple(ctx, writer.TxID, scanTuples(t, writer.TxID, hf)[0]))
+	assert.Equal(t, []string{"int(2)", "int(3)", "int(4)"}, scanStrings(t, writer.TxID, hf), "own changes are visible")
+	assert.Equal(t, []string{"int(1)", "int(2)", "int(3)"}, scanStrings(t, NewTxID(), hf), "uncommitted changes are invisible")
+	require.NoError(t, writer.Commit())
+
+	assert.Equal(t, []string{"int(1)", "int(2)", "int(3)"}, scanStrings(t, reader.TxID, hf), "committed after the snapshot")
+	assert.Equal(t, []string{"int(2)", "int(3)", "int(4)"}, scanStrings(t, NewTxID(), hf))
+}
+
+func TestMVCC_WriteConflict(t *testing.T) {
+	hf := mvccTable(t, 1, 2)
+	ctx := context.Background()
+
+	tx1, tx2 := NewTx(), NewTx()
+	require.NoError(t, DB.B().DeleteTuple(ctx, tx1.TxID, scanTuples(t, tx1.TxID, hf)[0]))
+	require.NoError(t, DB.B().DeleteTuple(ctx, tx2.TxID, scanTuples(t, tx2.TxID, hf)[0]), "the first committer wins")
+	require.NoError(t, tx1.Commit())
+	assert.Equal(t, ErrWriteConflict, tx2.Commit())
+	assert.Equal(t, []string{"int(2)"}, scanStrings(t, NewTxID(), hf))
+
+	tx3 := NewTx()
+	tuple := scanTuples(t, tx3.TxID, hf)[0]
+	tx4 := NewTx()
+	require.NoError(t, DB.B().UpdateTuple(ctx, tx4.TxID, tuple, &Tuple{TD: hf.TD, Fields: []Field{NewIntField(20)}}))
+	require.NoError(t, tx4.Commit())
+	err := DB.B().DeleteTuple(ctx, tx3.TxID, tuple)
+	assert.Equal(t, ErrWriteConflict, err, "deleted by the transaction committed after the snapshot")
+	require.NoError(t, tx3.Abort())
+	assert.Equal(t, []string{"int(20)"}, scanStrings(t, NewTxID(), hf))
+}
+
+func TestMVCC_Abort(t *testing.T) {
+	hf := mvccTable(t, 1, 2)
+	ctx := context.Background()
+	tx := NewTx()
+	require.NoError(t, DB.B().InsertTuple(ctx, tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(3)}}))
+	update := NewUpdate(tx.TxID, NewSeqScan(tx.TxID, hf.ID(), "t"), []Assignment{{Field: 0, Expr: ConstExpr{Val: NewIntField(0)}}})
+	assert.Equal(t, []string{"int(3)"}, drain(t, update))
+	assert.Equal(t, []string{"int(0)", "int(0)", "int(0)"}, scanStrings(t, tx.TxID, hf))
+	require.NoError(t, tx.Abort())
+	tx.Finish()
+
+	assert.Equal(t, []string{"int(1)", "int(2)"}, scanStrings(t, NewTxID(), hf))
+	page, err := hf.ReadPage(NewHeapPageID(hf.ID(), 0))
+	require.NoError(t, err)
+	hp := page.(*HeapPage)
+	assert.Equal(t, 2, NumOfNotNilPage(hp), "the inserted versions are removed on disk")
+	for _, tuple := range hp.Tuples[:2] {
+		assert.Equal(t, uint64(0), tuple.Xmax)
+	}
+}
+
+func TestMVCC_AbortFailed(t *testing.T) {
+	hf := mvccTable(t, 1)
+	ctx := context.Background()
+	tx := NewTx()
+	require.NoError(t, DB.B().InsertTuple(ctx, tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(2)}}))
+	// the last record is undone first, and fails on the page not in file
+	DB.T().mu.Lock()
+	st := DB.T().txs[tx.TxID.ID]
+	st.undo = append(st.undo, undoRecord{kind: undoInsert, rid: &RecordID{PID: NewHeapPageID(hf.ID(), 100)}})
+	DB.T().mu.Unlock()
+	assert.Error(t, tx.Abort())
+
+	assert.False(t, DB.T().active(tx.TxID))
+	DB.T().mu.Lock()
+	assert.True(t, DB.T().aborted(tx.TxID.ID), "kept aborted")
+	DB.T().mu.Unlock()
+	assert.Equal(t, []string{"int(1)"}, scanStrings(t, NewTxID(), hf))
+	page, err := hf.ReadPage(NewHeapPageID(hf.ID(), 0))
+	require.NoError(t, err)
+	assert.Equal(t, 1, NumOfNotNilPage(page.(*HeapPage)), "the version left is not written")
+}
+
+func TestMVCC_Vacuum(t *testing.T) {
+	hf := mvccTable(t, 1, 2, 3)
+	ctx := context.Background()
+	reader := NewTx()
+
+	tx := NewTx()
+	for _, tuple := range scanTuples(t, tx.TxID, hf)[:2] {
+		require.NoError(t, DB.B().DeleteTuple(ctx, tx.TxID, tuple))
+	}
+	require.NoError(t, tx.Commit())
+
+	n, err := DB.T().Vacuum(ctx, hf)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "visible to reader")
+	assert.Equal(t, []string{"int(1)", "int(2)", "int(3)"}, scanStrings(t, reader.TxID, hf))
+	reader.Finish()
+
+	n, err = DB.T().Vacuum(ctx, hf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	page, err := hf.ReadPage(NewHeapPageID(hf.ID(), 0))
+	require.NoError(t, err)
+	assert.Equal(t, 1, NumOfNotNilPage(page.(*HeapPage)))
+
+	tx = NewTx()
+	require.NoError(t, DB.B().InsertTuple(ctx, tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(4)}}))
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, int64(1), hf.NumPagesInFile(), "the slots are reused")
+	assert.Equal(t, []string{"int(4)", "int(3)"}, scanStrings(t, NewTxID(), hf))
+
+	_, err = DB.T().Vacuum(ctx, DB.C().GetTableByID(singleFieldTableID).(*HeapFile))
+	assert.Error(t, err, "not mvcc")
+}
+
+func TestMVCC_VacuumSyncOnce(t *testing.T) {
+	perPage := HeapPage{TD: GetTupleDesc(1, "v"), MVCC: true}.NumOfTuples()
+	ints := make([]int64, 3*perPage)
+	hf := mvccTable(t, ints...)
+	ctx := context.Background()
+	tx := NewTx()
+	for _, tuple := range scanTuples(t, tx.TxID, hf) {
+		require.NoError(t, DB.B().DeleteTuple(ctx, tx.TxID, tuple))
+	}
+	require.NoError(t, tx.Commit())
+
+	syncs := atomic.LoadInt64(&hf.group.syncs)
+	n, err := DB.T().Vacuum(ctx, hf)
+	require.NoError(t, err)
+	assert.Equal(t, len(ints), n)
+	assert.Equal(t, syncs+1, atomic.LoadInt64(&hf.group.syncs), "the pages are synced at once")
+	for pageNum := 0; pageNum < 3; pageNum++ {
+		page, err := hf.ReadPage(NewHeapPageID(hf.ID(), pageNum))
+		require.NoError(t, err)
+		assert.Equal(t, 0, NumOfNotNilPage(page.(*HeapPage)))
+	}
+}
+
+func TestMVCC_Reopen(t *testing.T) {
+	hf := mvccTable(t, 1, 2)
+	name := hf.File.Name()
+
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	_, err = NewHeapFile(f, hf.TD)
+	assert.IsType(t, ErrBadHeader{}, err, "the table is mvcc")
+
+	f, err = os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	reopened, err := NewMVCCHeapFile(f, hf.TD)
+	require.NoError(t, err)
+	page, err := reopened.ReadPage(NewHeapPageID(hf.ID(), 0))
+	require.NoError(t, err)
+	tuple := page.(*HeapPage).Tuples[0]
+	assert.Equal(t, "int(1)", tuple.String())
+	assert.True(t, DB.T().Visible(Snapshot{TxID: NewTxID().ID}, tuple), "committed, and forgotten by TxManager")
+}
+
+func TestMVCC_RestartWithUncommitted(t *testing.T) {
+	hf := mvccTable(t, 1, 2)
+	ctx := context.Background()
+	uncommitted := NewTx()
+	defer uncommitted.Finish()
+	require.NoError(t, DB.B().InsertTuple(ctx, uncommitted.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(3)}}))
+	require.NoError(t, DB.B().DeleteTuple(ctx, uncommitted.TxID, scanTuples(t, uncommitted.TxID, hf)[0]))
+
+	committed := NewTx()
+	require.NoError(t, DB.B().InsertTuple(ctx, committed.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(4)}}))
+	require.NoError(t, committed.Commit())
+	pid := NewHeapPageID(hf.ID(), 0)
+	assert.NotNil(t, DB.B().PageID2Page[pid.ID()].IsDirty(), "the uncommitted changes are only in BufferPool")
+
+	// restart the process, the changes of the uncommitted transaction are lost
+	db, lastTxID := DB, atomic.LoadUint64(&atomicTxID)
+	defer func() {
+		DB = db
+		advanceTxID(lastTxID)
+	}()
+	DB = NewDatabase()
+	atomic.StoreUint64(&atomicTxID, 0)
+	f, err := os.OpenFile(hf.File.Name(), os.O_RDWR, 0666)
+	require.NoError(t, err)
+	reopened, err := NewMVCCHeapFile(f, hf.TD)
+	require.NoError(t, err)
+	DB.C().AddTable(reopened, hf.File.Name())
+
+	txID := NewTxID()
+	assert.True(t, txID.ID > committed.TxID.ID && txID.ID > uncommitted.TxID.ID, "over the TxID high-water mark")
+	assert.Equal(t, []string{"int(1)", "int(2)", "int(4)"}, scanStrings(t, txID, reopened))
+	page, err := reopened.ReadPage(pid)
+	require.NoError(t, err)
+	for _, tuple := range page.(*HeapPage).Tuples {
+		if tuple != nil {
+			assert.NotEqual(t, uncommitted.TxID.ID, tuple.Xmin)
+			assert.Zero(t, tuple.Xmax)
+		}
+	}
+}
+
+func TestDatabase_StartVacuum(t *testing.T) {
+	hf := mvccTable(t, 1)
+	tx := NewTx()
+	require.NoError(t, DB.B().DeleteTuple(context.Background(), tx.TxID, scanTuples(t, tx.TxID, hf)[0]))
+	require.NoError(t, tx.Commit())
+
+	stop := DB.StartVacuum(time.Millisecond)
+	defer stop()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		page, err := hf.ReadPage(NewHeapPageID(hf.ID(), 0))
+		require.NoError(t, err)
+		if NumOfNotNilPage(page.(*HeapPage)) == 0 {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "not vacuumed")
+	}
+}
+
+// countMatched the num of tuples of hf matched by pred, read by the Filter over SeqScan
+func countMatched(t *testing.T, tx *Tx, hf *HeapFile, pred *Predicate) int {
+	return len(drain(t, NewFilter(pred, NewSeqScan(tx.TxID, hf.ID(), "t"))))
+}
+
+func TestMVCC_PredicateLock(t *testing.T) {
+	hf := mvccTable(t, 1, 2)
+	pred := &Predicate{Field: 0, Op: OpGreaterThanOrEq, Operand: NewIntField(10)}
+	insert := func(tx *Tx, i int64) {
+		require.NoError(t, DB.B().InsertTuple(context.Background(), tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(i)}}))
+	}
+
+	reader := NewTxWithOptions(&TxOptions{Isolation: Serializable})
+	assert.Equal(t, 0, countMatched(t, reader, hf, pred))
+	writer := NewTx()
+	insert(writer, 5)
+	require.NoError(t, writer.Commit())
+	insert(reader, 100)
+	require.NoError(t, reader.Commit(), "the row inserted is not matched")
+
+	reader = NewTxWithOptions(&TxOptions{Isolation: Serializable})
+	assert.Equal(t, 1, countMatched(t, reader, hf, pred))
+	writer = NewTx()
+	insert(writer, 15)
+	require.NoError(t, writer.Commit())
+	assert.Equal(t, 1, countMatched(t, reader, hf, pred), "the phantom is invisible to the snapshot")
+	assert.Equal(t, ErrSerializationFailure, reader.Commit())
+
+	reader = NewTxWithOptions(&TxOptions{Isolation: Serializable})
+	scan := NewSeqScan(reader.TxID, hf.ID(), "t")
+	require.NoError(t, scan.SelectFields([]int{0}))
+	assert.Len(t, drain(t, NewFilter(&Predicate{Field: 0, Op: OpLessThan, Operand: NewIntField(3)}, scan)), 2)
+	writer = NewTx()
+	require.NoError(t, DB.B().DeleteTuple(context.Background(), writer.TxID, scanTuples(t, writer.TxID, hf)[0]))
+	require.NoError(t, writer.Commit())
+	assert.Equal(t, ErrSerializationFailure, reader.Commit(), "the row matched is deleted")
+}
+
+func TestMVCC_ConcurrentInsertScan(t *testing.T) {
+	hf := mvccTable(t)
+	const workers, keys = 8, 4
+	insertIfAbsent := func(key int64) error {
+		tx := NewTxWithOptions(&TxOptions{Isolation: Serializable})
+		defer tx.Finish()
+		scan := NewFilter(&Predicate{Field: 0, Op: OpEquals, Operand: NewIntField(key)}, NewSeqScan(tx.TxID, hf.ID(), "t"))
+		if err := scan.Open(context.Background()); err != nil {
+			return err
+		}
+		found := scan.HasNext()
+		scan.Close()
+		if !found {
+			err := DB.B().InsertTuple(context.Background(), tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(key)}})
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+
+	errs := make(chan error, workers*keys)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := int64(0); key < keys; key++ {
+				for {
+					err := insertIfAbsent(key)
+					if err != ErrSerializationFailure {
+						errs <- err
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"int(0)", "int(1)", "int(2)", "int(3)"}, scanStrings(t, NewTxID(), hf), "no duplicated keys")
+}
+
+func TestMVCC_SelectFields(t *testing.T) {
+	hf := mvccTable(t, 1, 2)
+	writer := NewTx()
+	require.NoError(t, DB.B().InsertTuple(context.Background(), writer.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(3)}}))
+	selected := func(tx *Tx) []string {
+		scan := NewSeqScan(tx.TxID, hf.ID(), "t")
+		require.NoError(t, scan.SelectFields([]int{0}))
+		return drain(t, scan)
+	}
+	reader := NewTx()
+	assert.Equal(t, []string{"int(1)", "int(2)"}, selected(reader), "the dirty page in BufferPool")
+	assert.Equal(t, []string{"int(1)", "int(2)", "int(3)"}, selected(writer))
+	require.NoError(t, writer.Abort())
+	writer.Finish()
+
+	DB.B().mu.Lock()
+	delete(DB.B().PageID2Page, NewHeapPageID(hf.ID(), 0).ID())
+	DB.B().mu.Unlock()
+	assert.Equal(t, []string{"int(1)", "int(2)"}, selected(reader), "read from file")
+	reader.Finish()
+}
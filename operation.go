@@ -1,6 +1,10 @@
 package newdb
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"strings"
+)
 
 // Op enum of Op
 type Op int
@@ -44,6 +48,40 @@ func (op Op) String() (ret string) {
 	return
 }
 
+// reverse the op if the operands are swapped, `a op b` is `b op.reverse() a`
+func (op Op) reverse() Op {
+	switch op {
+	case OpLessThan:
+		return OpGreaterThan
+	case OpLessThanOrEq:
+		return OpGreaterThanOrEq
+	case OpGreaterThan:
+		return OpLessThan
+	case OpGreaterThanOrEq:
+		return OpLessThanOrEq
+	}
+	return op
+}
+
+// negate the op of `NOT (a op b)`, false if op could not be negated, eg: OpLike
+func (op Op) negate() (Op, bool) {
+	switch op {
+	case OpEquals:
+		return OpNotEquals, true
+	case OpNotEquals:
+		return OpEquals, true
+	case OpLessThan:
+		return OpGreaterThanOrEq, true
+	case OpLessThanOrEq:
+		return OpGreaterThan, true
+	case OpGreaterThan:
+		return OpLessThanOrEq, true
+	case OpGreaterThanOrEq:
+		return OpLessThan, true
+	}
+	return op, false
+}
+
 // Predicate compares tuples to a specified Field value
 type Predicate struct {
 	Field   int
@@ -66,10 +104,36 @@ func (p Predicate) String() string {
 	return fmt.Sprintf("f=%v\top=%v\toperand=%v", p.Field, p.Op.String(), p.Operand.String())
 }
 
+// describe the predicate with the field name in td
+func (p Predicate) describe(td *TupleDesc) string {
+	name := fmt.Sprintf("$%v", p.Field)
+	if td != nil && p.Field >= 0 && p.Field < len(td.TdItems) && td.TdItems[p.Field].Name != "" {
+		name = td.TdItems[p.Field].Name
+	}
+	return fmt.Sprintf("%v %v %v", name, p.Op, p.Operand)
+}
+
+// ParseOp parse the Op from its String
+func ParseOp(s string) (Op, error) {
+	for op := OpEquals; op <= OpNotEquals; op++ {
+		if strings.EqualFold(op.String(), s) {
+			return op, nil
+		}
+	}
+	if s == "==" {
+		return OpEquals, nil
+	}
+	if s == "<>" {
+		return OpNotEquals, nil
+	}
+	return 0, fmt.Errorf("unknown op %v", s)
+}
+
 // Iterator iterator
 type Iterator interface {
 	// Open opens the iterator. This must be called before any of the other methods.
-	Open() error
+	// ctx is used by the whole execution, include Rewind, the iterator stop with ctx.Err() once ctx is done
+	Open(ctx context.Context) error
 	// Close Closes the iterator. When the iterator is closed, calling next(), hasNext(), or rewind() should return error
 	Close()
 	// HasNext Returns true if the iterator has more tuples.
@@ -88,6 +152,8 @@ type OpIterator interface {
 	Iterator
 	// TupleDesc Returns the TupleDesc associated with this OpIterator.
 	TupleDesc() *TupleDesc
+	// Explain Returns the tree of this OpIterator with the estimated rows and cost, see ExplainAnalyze
+	Explain() *PlanNode
 }
 
 var _ OpIterator = (*Filter)(nil)
@@ -99,6 +165,7 @@ type Filter struct {
 
 	open bool
 	next *Tuple
+	ctx  context.Context
 
 	Err error
 }
@@ -113,13 +180,19 @@ func (f *Filter) Error() error {
 
 // Open open iterator
 // see #OpIterator
-func (f *Filter) Open() error {
+func (f *Filter) Open(ctx context.Context) error {
+	f.ctx = ctx
+	lockPredicates(f)
+	if f.Err = f.Child.Open(ctx); f.Err != nil {
+		return f.Err
+	}
 	f.open = true
 	return nil
 }
 
 // Close close iterator
 func (f *Filter) Close() {
+	f.Child.Close()
 	f.open = false
 	f.next = nil
 }
@@ -149,7 +222,7 @@ func (f *Filter) fetchNext() (*Tuple, error) {
 			return tuple, f.Error()
 		}
 	}
-	return nil, nil
+	return nil, f.Child.Error()
 }
 
 // Next next tuple
@@ -171,7 +244,7 @@ func (f *Filter) Next() (ret *Tuple) {
 // Rewind restart the iterator
 func (f *Filter) Rewind() error {
 	f.Close()
-	return f.Open()
+	return f.Open(f.ctx)
 }
 
 // TupleDesc returns the TupleDesc associated with this OpIterator.
@@ -179,6 +252,104 @@ func (f Filter) TupleDesc() *TupleDesc {
 	return f.Child.TupleDesc()
 }
 
+// Explain the selectivity is estimated by the stats of the base table if known
+func (f *Filter) Explain() *PlanNode {
+	child := f.Child.Explain()
+	ret := &PlanNode{Operator: "Filter", Detail: f.Pred.describe(f.Child.TupleDesc()), Rows: UnknownRows, Cost: child.Cost + cpuCost(child.Rows), Children: []*PlanNode{child}, stats: child.stats, statsFields: child.statsFields}
+	if child.Rows != UnknownRows {
+		selectivity := DefaultSelectivity
+		if child.stats != nil {
+			selectivity = child.stats.EstimateSelectivity(child.statsField(f.Pred.Field), f.Pred.Op, f.Pred.Operand)
+		}
+		ret.Rows = int(float64(child.Rows)*selectivity + 0.5)
+	}
+	return ret
+}
+
+func (f *Filter) children() []*OpIterator {
+	return []*OpIterator{&f.Child}
+}
+
+var _ OpIterator = (*Project)(nil)
+
+// Project return the Fields of the tuples of child, the RecordID is kept
+type Project struct {
+	Child  OpIterator
+	Fields []int
+
+	td  *TupleDesc
+	Err error
+}
+
+// NewProject new Project of the fields of child
+func NewProject(fields []int, child OpIterator) *Project {
+	ret := &Project{Child: child, Fields: fields}
+	ret.td, ret.Err = projectTupleDesc(child.TupleDesc(), fields)
+	return ret
+}
+
+// Open open the child
+func (p *Project) Open(ctx context.Context) error {
+	if p.Err != nil {
+		return p.Err
+	}
+	return p.Child.Open(ctx)
+}
+
+// Close close the child
+func (p *Project) Close() {
+	p.Child.Close()
+}
+
+// HasNext hasNext of child
+func (p *Project) HasNext() bool {
+	return p.Err == nil && p.Child.HasNext()
+}
+
+// Next the projected next tuple of child
+func (p *Project) Next() *Tuple {
+	tuple := p.Child.Next()
+	if tuple == nil {
+		return nil
+	}
+	return projectTuple(p.td, p.Fields, tuple)
+}
+
+// Rewind rewind the child
+func (p *Project) Rewind() error {
+	return p.Child.Rewind()
+}
+
+// TupleDesc the TupleDesc of Fields
+func (p *Project) TupleDesc() *TupleDesc {
+	return p.td
+}
+
+// Error return error
+func (p *Project) Error() error {
+	if p.Err != nil {
+		return p.Err
+	}
+	return p.Child.Error()
+}
+
+// Explain the rows of child, the fields of base table are mapped for estimation
+func (p *Project) Explain() *PlanNode {
+	child := p.Child.Explain()
+	ret := &PlanNode{Operator: "Project", Detail: fmt.Sprintf("fields=%v", p.Fields), Rows: child.Rows, Cost: child.Cost + cpuCost(child.Rows), Children: []*PlanNode{child}}
+	if child.stats != nil {
+		ret.stats = child.stats
+		for _, f := range p.Fields {
+			ret.statsFields = append(ret.statsFields, child.statsField(f))
+		}
+	}
+	return ret
+}
+
+func (p *Project) children() []*OpIterator {
+	return []*OpIterator{&p.Child}
+}
+
 var _ OpIterator = (*TupleIterator)(nil)
 
 // TupleIterator Implements a OpIterator
@@ -200,8 +371,8 @@ func NewTupleIterator(td *TupleDesc, tuples []*Tuple) *TupleIterator {
 	}
 }
 
-// Open open
-func (it *TupleIterator) Open() error {
+// Open open, the tuples are in memory, so ctx is not checked
+func (it *TupleIterator) Open(ctx context.Context) error {
 	it.index = 0
 	return nil
 }
@@ -232,7 +403,7 @@ func (it *TupleIterator) Next() (ret *Tuple) {
 // Rewind rewind the iterator
 func (it *TupleIterator) Rewind() error {
 	it.Close()
-	return it.Open()
+	return it.Open(context.Background())
 }
 
 // TupleDesc TupleDesc
@@ -240,6 +411,17 @@ func (it TupleIterator) TupleDesc() *TupleDesc {
 	return it.TD
 }
 
+// Explain the rows are the tuples in memory
+func (it *TupleIterator) Explain() *PlanNode {
+	var rows int
+	for _, tuple := range it.Tuples {
+		if tuple != nil {
+			rows++
+		}
+	}
+	return &PlanNode{Operator: "TupleIterator", Rows: rows, Cost: cpuCost(rows)}
+}
+
 // Error return error
 func (it TupleIterator) Error() error {
 	return it.Err
@@ -252,7 +434,10 @@ type SeqScan struct {
 	TableAlias string
 	DBFile     DBFile
 	Iter       DbFileIterator
+	// Fields the fields of the table in the returned tuples, nil for all, see SelectFields
+	Fields []int
 
+	td  *TupleDesc
 	Err error
 }
 
@@ -273,9 +458,88 @@ func NewSeqScan(txID *TxID, tableID string, tableAlias string) *SeqScan {
 	return ret
 }
 
+// SelectFields only return the fields of table, the RecordID of tuples is kept.
+// the HeapFile only decodes the fields
+func (s *SeqScan) SelectFields(fields []int) error {
+	if s.DBFile == nil {
+		return s.Err
+	}
+	td, err := projectTupleDesc(s.DBFile.TupleDesc(), fields)
+	if err != nil {
+		return err
+	}
+	if it, ok := s.Iter.(*HeapPageDbFileIterator); ok {
+		if err = it.SelectFields(fields); err != nil {
+			return err
+		}
+		td = it.td
+	}
+	s.Fields, s.td = fields, td
+	return nil
+}
+
+// projectTupleDesc the TupleDesc of the fields of td
+func projectTupleDesc(td *TupleDesc, fields []int) (*TupleDesc, error) {
+	ret := &TupleDesc{}
+	for _, i := range fields {
+		if i < 0 || i >= len(td.TdItems) {
+			return nil, fmt.Errorf("field %v out of range [0, %v)", i, len(td.TdItems))
+		}
+		ret.TdItems = append(ret.TdItems, td.TdItems[i])
+	}
+	return ret, nil
+}
+
+// projectTuple the tuple of the fields of tuple, the RecordID is kept
+func projectTuple(td *TupleDesc, fields []int, tuple *Tuple) *Tuple {
+	ret := &Tuple{TD: td, RecordID: tuple.RecordID, Fields: make([]Field, len(fields))}
+	for i, f := range fields {
+		ret.Fields[i] = tuple.Fields[f]
+	}
+	return ret
+}
+
+// lockPredicates narrow the predicate lock of the SeqScan under the chain of Filters
+// to the predicates of them, the Filters over others do nothing
+func lockPredicates(op OpIterator) {
+	var preds []*Predicate
+	for {
+		switch o := op.(type) {
+		case *Filter:
+			preds = append(preds, o.Pred)
+			op = o.Child
+		case *SeqScan:
+			o.lockPredicates(preds)
+			return
+		default:
+			return
+		}
+	}
+}
+
+// lockPredicates read the tuples matched by preds over the returned fields, the longest
+// chain of the Filters is kept
+func (s *SeqScan) lockPredicates(preds []*Predicate) {
+	it, ok := s.Iter.(*HeapPageDbFileIterator)
+	if !ok || len(preds) <= len(it.Predicates) {
+		return
+	}
+	lock := make([]*Predicate, len(preds))
+	for i, pred := range preds {
+		lock[i] = pred
+		if s.Fields != nil {
+			if pred.Field < 0 || pred.Field >= len(s.Fields) {
+				return
+			}
+			lock[i] = &Predicate{Field: s.Fields[pred.Field], Op: pred.Op, Operand: pred.Operand}
+		}
+	}
+	it.Predicates = lock
+}
+
 // Open open
-func (s *SeqScan) Open() error {
-	return s.Iter.Open()
+func (s *SeqScan) Open(ctx context.Context) error {
+	return s.Iter.Open(ctx)
 }
 
 // Close close
@@ -290,7 +554,12 @@ func (s *SeqScan) HasNext() bool {
 
 // Next next tuple
 func (s *SeqScan) Next() *Tuple {
-	return s.Iter.Next()
+	ret := s.Iter.Next()
+	// the tuples of HeapPageDbFileIterator are projected already
+	if ret != nil && s.td != nil && ret.TD != s.td {
+		ret = projectTuple(s.td, s.Fields, ret)
+	}
+	return ret
 }
 
 // Rewind rewind the iterator
@@ -300,10 +569,46 @@ func (s *SeqScan) Rewind() error {
 
 // TupleDesc TupleDesc
 func (s SeqScan) TupleDesc() *TupleDesc {
+	if s.td != nil {
+		return s.td
+	}
 	return s.DBFile.TupleDesc()
 }
 
+// Explain estimate by the stats of table, see Catalog.Analyze;
+// without stats, the rows are unknown and the cost is to read all pages
+func (s *SeqScan) Explain() *PlanNode {
+	ret := &PlanNode{Operator: "SeqScan", Detail: fmt.Sprintf("table=%v alias=%v", s.TableID, s.TableAlias), Rows: UnknownRows}
+	if s.td != nil {
+		ret.Detail += fmt.Sprintf(" fields=%v", s.Fields)
+	}
+	if s.DBFile == nil {
+		return ret
+	}
+	if stats, err := DB.C().GetTableStats(s.TableID); err == nil && stats != nil {
+		ret.Rows = stats.Rows
+		ret.Cost = stats.EstimateScanCost() + cpuCost(stats.Rows)
+		ret.stats, ret.statsFields = stats, s.Fields
+		return ret
+	}
+	if hf, ok := s.DBFile.(*HeapFile); ok {
+		ret.Cost = float64(hf.NumPagesInFile()) * DefaultIOCostPerPage
+	}
+	return ret
+}
+
+// PagesRead the num of pages read by the iterator
+func (s *SeqScan) PagesRead() int {
+	if it, ok := s.Iter.(*HeapPageDbFileIterator); ok {
+		return it.pagesRead
+	}
+	return 0
+}
+
 // Error return error
 func (s SeqScan) Error() error {
+	if s.Err == nil && s.Iter != nil {
+		return s.Iter.Error()
+	}
 	return s.Err
 }
@@ -1,7 +1,10 @@
 package newdb
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -68,7 +71,7 @@ func TestFilter_filterAllLessThan(t *testing.T) {
 	expected := GetTupleDesc(2, "scan")
 	actual := op.TupleDesc()
 	assert.Equal(t, expected, actual)
-	require.NoError(t, op.Open())
+	require.NoError(t, op.Open(context.Background()))
 	i := -5
 	for op.HasNext() {
 		next := op.Next()
@@ -87,7 +90,7 @@ func TestTupleIterator_AllTest(t *testing.T) {
 	}
 	tuples[5] = nil
 	it := NewTupleIterator(td, tuples)
-	err := it.Open()
+	err := it.Open(context.Background())
 	assert.NoError(t, err)
 	i := 0
 	for it.HasNext() {
@@ -107,11 +110,11 @@ func TestNewSeqScan(t *testing.T) {
 		TD:     td,
 		Fields: []Field{NewIntField(1)},
 	}
-	err := DB.B().InsertTuple(txID, singleFieldTableID, tuple)
+	err := DB.B().InsertTuple(context.Background(), txID, singleFieldTableID, tuple)
 	assert.NoError(t, err)
 
 	it := NewSeqScan(NewTxID(), singleFieldTableID, "seq_scan")
-	err = it.Open()
+	err = it.Open(context.Background())
 	require.NoError(t, err)
 	var i int
 	for it.HasNext() {
@@ -122,3 +125,123 @@ func TestNewSeqScan(t *testing.T) {
 	}
 	assert.NotEqual(t, 0, i)
 }
+
+func TestSeqScan_Canceled(t *testing.T) {
+	tableID, err := RandDBFile(1)
+	require.NoError(t, err)
+	scan := NewMockScan(0, 3*TuplesPerPage(DB.C().GetTableByID(tableID).TupleDesc()), 1)
+	require.NoError(t, scan.Open(context.Background()))
+	_, err = DB.C().GetTableByID(tableID).(*HeapFile).BulkLoad(scan)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	seq := NewSeqScan(NewTxID(), tableID, "t")
+	filter := NewFilter(&Predicate{Field: 0, Op: OpGreaterThanOrEq, Operand: NewIntField(0)}, seq)
+	require.NoError(t, filter.Open(ctx))
+	for i := 0; i < 10; i++ {
+		require.True(t, filter.HasNext())
+		filter.Next()
+	}
+	cancel()
+	for filter.HasNext() {
+		filter.Next()
+	}
+	assert.Equal(t, context.Canceled, seq.Error(), "canceled when read the next page")
+	assert.Equal(t, context.Canceled, filter.Error())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, NewSeqScan(NewTxID(), tableID, "t").Open(ctx))
+}
+
+func TestParseOp(t *testing.T) {
+	for op := OpEquals; op <= OpNotEquals; op++ {
+		parsed, err := ParseOp(op.String())
+		assert.NoError(t, err)
+		assert.Equal(t, op, parsed)
+	}
+	op, err := ParseOp("like")
+	assert.NoError(t, err)
+	assert.Equal(t, OpLike, op)
+	op, err = ParseOp("<>")
+	assert.NoError(t, err)
+	assert.Equal(t, OpNotEquals, op)
+	_, err = ParseOp("~")
+	assert.Error(t, err)
+}
+
+func TestSeqScan_SelectFields(t *testing.T) {
+	tableID, err := RandDBFile(3)
+	require.NoError(t, err)
+	td := DB.C().GetTableByID(tableID).TupleDesc()
+	require.NoError(t, DB.B().InsertTuple(context.Background(), NewTxID(), tableID, &Tuple{TD: td, Fields: []Field{NewIntField(1), NewIntField(2), NewIntField(3)}}))
+
+	scan := NewSeqScan(NewTxID(), tableID, "t")
+	assert.Error(t, scan.SelectFields([]int{3}))
+	require.NoError(t, scan.SelectFields([]int{2, 0}))
+	assert.Equal(t, "f2(int64(8)),f0(int64(8))", scan.TupleDesc().String())
+	require.NoError(t, scan.Open(context.Background()))
+	require.True(t, scan.HasNext())
+	tuple := scan.Next()
+	assert.Equal(t, "int(3)\tint(1)", tuple.String())
+	assert.NotNil(t, tuple.RecordID, "RecordID is kept")
+	assert.Contains(t, scan.Explain().Detail, "fields=[2 0]")
+
+	project := NewProject([]int{1}, NewSeqScan(NewTxID(), tableID, "t"))
+	require.NoError(t, project.Open(context.Background()))
+	require.True(t, project.HasNext())
+	assert.Equal(t, "int(2)", project.Next().String())
+	assert.Equal(t, "Project", project.Explain().Operator)
+	assert.Error(t, NewProject([]int{5}, NewSeqScan(NewTxID(), tableID, "t")).Open(context.Background()))
+}
+
+// countedType the int64 type counting the fields parsed
+var (
+	countedType   = &Type{Name: "counted", Len: 8}
+	countedParsed int64
+)
+
+func init() {
+	err := RegisterType("counted", countedType, func(t *Type) Field {
+		atomic.AddInt64(&countedParsed, 1)
+		return &IntField{TypeReal: t}
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestSeqScan_SelectFieldsNotDecoded(t *testing.T) {
+	name, err := TmpDataFile()
+	require.NoError(t, err)
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	hf, err := NewHeapFile(f, NewTupleDesc([]*Type{IntType, countedType}, []string{"a", "b"}))
+	require.NoError(t, err)
+	DB.C().AddTable(hf, name)
+	// open the map before the pages exist, or they are read to rebuild it
+	_, err = hf.FreeSpaceMap()
+	require.NoError(t, err)
+	var tuples []*Tuple
+	for i := 0; i < 3; i++ {
+		tuples = append(tuples, &Tuple{TD: hf.TD, Fields: []Field{NewIntField(int64(i)), &IntField{Val: int64(i), TypeReal: countedType}}})
+	}
+	loader := NewBulkLoader(hf, 1)
+	for _, tuple := range tuples {
+		require.NoError(t, loader.Add(tuple))
+	}
+	require.NoError(t, loader.Close())
+
+	parsed := atomic.LoadInt64(&countedParsed)
+	scan := NewSeqScan(NewTxID(), hf.ID(), "t")
+	require.NoError(t, scan.SelectFields([]int{0}))
+	assert.Equal(t, []string{"int(0)", "int(1)", "int(2)"}, drain(t, scan))
+	assert.Equal(t, parsed, atomic.LoadInt64(&countedParsed), "the field b is skipped")
+	_, cached := DB.B().PageID2Page[NewHeapPageID(hf.ID(), 0).ID()]
+	assert.False(t, cached, "the page read by fields is not cached")
+
+	scan = NewSeqScan(NewTxID(), hf.ID(), "t")
+	require.NoError(t, scan.SelectFields([]int{1}))
+	assert.Equal(t, []string{"int(0)", "int(1)", "int(2)"}, drain(t, scan))
+	assert.Equal(t, parsed+3, atomic.LoadInt64(&countedParsed))
+}
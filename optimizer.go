@@ -0,0 +1,317 @@
+package newdb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+const (
+	// DefaultCPUCostPerTuple the cost to process one tuple, relative to DefaultIOCostPerPage
+	DefaultCPUCostPerTuple = 1.0
+	// MaxJoinTables the max num of tables the JoinOptimizer enumerates
+	MaxJoinTables = 16
+)
+
+// JoinAlgorithm the physical algorithm of a join
+type JoinAlgorithm int
+
+const (
+	// JoinNestedLoop scan the inner table for every outer tuple, any Op
+	JoinNestedLoop JoinAlgorithm = iota
+	// JoinHash build a hash table of the inner table, OpEquals only
+	JoinHash
+	// JoinSortMerge sort both sides and merge, OpEquals and the range Ops
+	JoinSortMerge
+)
+
+func (a JoinAlgorithm) String() string {
+	switch a {
+	case JoinNestedLoop:
+		return "NestedLoopJoin"
+	case JoinHash:
+		return "HashJoin"
+	case JoinSortMerge:
+		return "SortMergeJoin"
+	}
+	return "UnsupportedJoin"
+}
+
+// supports the algorithm could evaluate op
+func (a JoinAlgorithm) supports(op Op) bool {
+	switch a {
+	case JoinNestedLoop:
+		return true
+	case JoinHash:
+		return op == OpEquals
+	case JoinSortMerge:
+		return op == OpEquals || op == OpLessThan || op == OpLessThanOrEq || op == OpGreaterThan || op == OpGreaterThanOrEq
+	}
+	return false
+}
+
+// LogicalJoinNode the join `Table1Alias.Field1 Op Table2Alias.Field2` in query
+type LogicalJoinNode struct {
+	Table1Alias string
+	Field1      int
+	Op          Op
+	Table2Alias string
+	Field2      int
+}
+
+// swap the tables of node, the Op is reversed
+func (n LogicalJoinNode) swap() LogicalJoinNode {
+	return LogicalJoinNode{Table1Alias: n.Table2Alias, Field1: n.Field2, Op: n.Op.reverse(), Table2Alias: n.Table1Alias, Field2: n.Field1}
+}
+
+func (n LogicalJoinNode) String() string {
+	return fmt.Sprintf("%v.%v %v %v.%v", n.Table1Alias, n.Field1, n.Op, n.Table2Alias, n.Field2)
+}
+
+// JoinStep one join of the left-deep JoinPlan, the outer is the plan of the previous steps,
+// the inner is the base table Node.Table2Alias
+type JoinStep struct {
+	Node      LogicalJoinNode
+	Algorithm JoinAlgorithm
+	// Filters the other joins between the outer and inner, applied after the join
+	Filters []LogicalJoinNode
+	// Cost the total cost of the plan after this step
+	Cost float64
+	// Card the estimated num of tuples after this step
+	Card int
+}
+
+// JoinPlan the left-deep join plan, Outer is the first table
+type JoinPlan struct {
+	Outer string
+	Steps []JoinStep
+	Cost  float64
+	Card  int
+}
+
+func (p *JoinPlan) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Scan(%v)", p.Outer)
+	for _, step := range p.Steps {
+		fmt.Fprintf(&buf, " -> %v(%v", step.Algorithm, step.Node)
+		for _, filter := range step.Filters {
+			fmt.Fprintf(&buf, " AND %v", filter)
+		}
+		fmt.Fprintf(&buf, ") cost=%.0f card=%v", step.Cost, step.Card)
+	}
+	return buf.String()
+}
+
+type joinTable struct {
+	alias       string
+	stats       *TableStats
+	selectivity float64
+}
+
+// card the num of tuples after the filters
+func (t joinTable) card() int {
+	return t.stats.EstimateTableCardinality(t.selectivity)
+}
+
+// distinct the num of distinct values of field after the filters
+func (t joinTable) distinct(field int) int {
+	d := t.stats.DistinctCount(field)
+	if card := t.card(); d > card {
+		d = card
+	}
+	if d < 1 {
+		d = 1
+	}
+	return d
+}
+
+// JoinOptimizer choose the order and algorithms of joins by Selinger style dynamic programming
+// over the left-deep plans, the cost is the IO of pages plus the CPU of tuples
+type JoinOptimizer struct {
+	CPUCostPerTuple float64
+
+	tables []joinTable
+	index  map[string]int
+	joins  []LogicalJoinNode
+}
+
+// NewJoinOptimizer new JoinOptimizer with DefaultCPUCostPerTuple
+func NewJoinOptimizer() *JoinOptimizer {
+	return &JoinOptimizer{CPUCostPerTuple: DefaultCPUCostPerTuple, index: make(map[string]int)}
+}
+
+// AddTable add the table by alias, selectivity is the fraction of tuples left by the filters on the table
+func (jo *JoinOptimizer) AddTable(alias string, stats *TableStats, selectivity float64) error {
+	if _, ok := jo.index[alias]; ok {
+		return fmt.Errorf("duplicate table alias %v", alias)
+	}
+	if stats == nil {
+		return fmt.Errorf("no stats of table %v", alias)
+	}
+	if len(jo.tables) >= MaxJoinTables {
+		return fmt.Errorf("too many tables, max %v", MaxJoinTables)
+	}
+	jo.index[alias] = len(jo.tables)
+	jo.tables = append(jo.tables, joinTable{alias: alias, stats: stats, selectivity: clamp01(selectivity)})
+	return nil
+}
+
+// AddJoin add the join between two added tables
+func (jo *JoinOptimizer) AddJoin(node LogicalJoinNode) error {
+	for _, side := range []struct {
+		alias string
+		field int
+	}{{node.Table1Alias, node.Field1}, {node.Table2Alias, node.Field2}} {
+		i, ok := jo.index[side.alias]
+		if !ok {
+			return fmt.Errorf("join %v: no table %v", node, side.alias)
+		}
+		if side.field < 0 || side.field >= len(jo.tables[i].stats.Columns) {
+			return fmt.Errorf("join %v: no field %v in table %v", node, side.field, side.alias)
+		}
+	}
+	if node.Table1Alias == node.Table2Alias {
+		return fmt.Errorf("join %v: self join must use different aliases", node)
+	}
+	jo.joins = append(jo.joins, node)
+	return nil
+}
+
+// scanCost the cost to scan the table once
+func (jo *JoinOptimizer) scanCost(t joinTable) float64 {
+	return t.stats.EstimateScanCost() + float64(t.stats.Rows)*jo.CPUCostPerTuple
+}
+
+// EstimateJoinCost the cost of joining the outer (with cost and card) and the inner table by algorithm,
+// the cost of outer is included
+func (jo *JoinOptimizer) EstimateJoinCost(algorithm JoinAlgorithm, outerCost float64, outerCard int, inner string) float64 {
+	t := jo.tables[jo.index[inner]]
+	n1, n2 := float64(outerCard), float64(t.card())
+	cpu := jo.CPUCostPerTuple
+	switch algorithm {
+	case JoinHash:
+		// build the hash table of inner, then probe it with every outer tuple
+		return outerCost + jo.scanCost(t) + (n1+n2)*cpu
+	case JoinSortMerge:
+		return outerCost + jo.scanCost(t) + (n1*log2(n1)+n2*log2(n2)+n1+n2)*cpu
+	}
+	// the inner table is scanned for every outer tuple
+	return outerCost + n1*jo.scanCost(t) + n1*n2*cpu
+}
+
+func log2(n float64) float64 {
+	if n < 2 {
+		return 1
+	}
+	return math.Log2(n)
+}
+
+// joinSelectivity the fraction of the cross product satisfy node
+func (jo *JoinOptimizer) joinSelectivity(node LogicalJoinNode) float64 {
+	t1, t2 := jo.tables[jo.index[node.Table1Alias]], jo.tables[jo.index[node.Table2Alias]]
+	d := t1.distinct(node.Field1)
+	if d2 := t2.distinct(node.Field2); d2 > d {
+		d = d2
+	}
+	switch node.Op {
+	case OpEquals:
+		return 1 / float64(d)
+	case OpNotEquals:
+		return 1 - 1/float64(d)
+	}
+	return DefaultSelectivity
+}
+
+type subPlan struct {
+	cost  float64
+	card  int
+	outer string
+	steps []JoinStep
+}
+
+// Optimize choose the cheapest left-deep plan join all tables, the join graph must be connected
+func (jo *JoinOptimizer) Optimize() (*JoinPlan, error) {
+	n := len(jo.tables)
+	if n == 0 {
+		return nil, fmt.Errorf("no table to join")
+	}
+	best := make(map[uint32]*subPlan, 1<<uint(n))
+	for i, t := range jo.tables {
+		best[1<<uint(i)] = &subPlan{cost: jo.scanCost(t), card: t.card(), outer: t.alias}
+	}
+	// the masks in the increasing order of num of tables
+	for size := 2; size <= n; size++ {
+		for mask := uint32(1); mask < 1<<uint(n); mask++ {
+			if bits.OnesCount32(mask) != size {
+				continue
+			}
+			for i := range jo.tables {
+				bit := uint32(1) << uint(i)
+				if mask&bit == 0 {
+					continue
+				}
+				outer, ok := best[mask&^bit]
+				if !ok {
+					continue
+				}
+				if plan := jo.joinTable(outer, mask&^bit, i); plan != nil {
+					if cur, ok := best[mask]; !ok || plan.cost < cur.cost {
+						best[mask] = plan
+					}
+				}
+			}
+		}
+	}
+	plan, ok := best[1<<uint(n)-1]
+	if !ok {
+		return nil, fmt.Errorf("the tables are not connected by joins, cross join is not supported")
+	}
+	return &JoinPlan{Outer: plan.outer, Steps: plan.steps, Cost: plan.cost, Card: plan.card}, nil
+}
+
+// joinTable the cheapest plan join the outer plan of tables in mask with the inner table i,
+// nil if no join between them
+func (jo *JoinOptimizer) joinTable(outer *subPlan, mask uint32, i int) *subPlan {
+	inner := jo.tables[i].alias
+	var edges []LogicalJoinNode
+	for _, node := range jo.joins {
+		if node.Table1Alias == inner {
+			node = node.swap()
+		}
+		if node.Table2Alias != inner {
+			continue
+		}
+		if mask&(1<<uint(jo.index[node.Table1Alias])) != 0 {
+			edges = append(edges, node)
+		}
+	}
+	if len(edges) == 0 {
+		return nil
+	}
+	card := float64(outer.card) * float64(jo.tables[i].card())
+	for _, edge := range edges {
+		card *= jo.joinSelectivity(edge)
+	}
+	// every edge could be the join, the others are filters
+	var ret *subPlan
+	for k, edge := range edges {
+		for _, algorithm := range []JoinAlgorithm{JoinNestedLoop, JoinHash, JoinSortMerge} {
+			if !algorithm.supports(edge.Op) {
+				continue
+			}
+			cost := jo.EstimateJoinCost(algorithm, outer.cost, outer.card, inner)
+			if ret != nil && cost >= ret.cost {
+				continue
+			}
+			var filters []LogicalJoinNode
+			filters = append(filters, edges[:k]...)
+			filters = append(filters, edges[k+1:]...)
+			step := JoinStep{Node: edge, Algorithm: algorithm, Filters: filters, Cost: cost, Card: int(card + 0.5)}
+			steps := make([]JoinStep, len(outer.steps), len(outer.steps)+1)
+			copy(steps, outer.steps)
+			ret = &subPlan{cost: cost, card: step.Card, outer: outer.outer, steps: append(steps, step)}
+		}
+	}
+	return ret
+}
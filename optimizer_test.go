@@ -0,0 +1,98 @@
+package newdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTableStats the stats of table with rows and pages, every column has distinct values
+func fakeTableStats(t *testing.T, rows, pages int, distinct ...int) *TableStats {
+	ret := &TableStats{Rows: rows, Pages: pages, IOCostPerPage: DefaultIOCostPerPage}
+	for _, d := range distinct {
+		hll, err := NewHyperLogLog(DefaultHLLPrecision)
+		require.NoError(t, err)
+		for i := 0; i < d; i++ {
+			require.NoError(t, hll.AddField(NewIntField(int64(i))))
+		}
+		ret.Columns = append(ret.Columns, &ColumnStats{Type: "int", Distinct: hll})
+	}
+	return ret
+}
+
+func TestJoinOptimizer_Order(t *testing.T) {
+	jo := NewJoinOptimizer()
+	// orders(id, customer_id, product_id) customers(id) products(id)
+	require.NoError(t, jo.AddTable("orders", fakeTableStats(t, 100000, 1000, 100000, 1000, 100), 1))
+	require.NoError(t, jo.AddTable("customers", fakeTableStats(t, 1000, 10, 1000), 0.01))
+	require.NoError(t, jo.AddTable("products", fakeTableStats(t, 100, 1, 100), 1))
+	assert.Error(t, jo.AddTable("orders", fakeTableStats(t, 1, 1, 1), 1))
+	require.NoError(t, jo.AddJoin(LogicalJoinNode{"orders", 1, OpEquals, "customers", 0}))
+	require.NoError(t, jo.AddJoin(LogicalJoinNode{"products", 0, OpEquals, "orders", 2}))
+	assert.Error(t, jo.AddJoin(LogicalJoinNode{"orders", 1, OpEquals, "nobody", 0}))
+	assert.Error(t, jo.AddJoin(LogicalJoinNode{"orders", 5, OpEquals, "customers", 0}))
+
+	plan, err := jo.Optimize()
+	require.NoError(t, err)
+	require.Len(t, plan.Steps, 2)
+	// the filtered customers is the smallest, orders is scanned once by hash join
+	assert.Equal(t, "customers", plan.Outer)
+	assert.Equal(t, LogicalJoinNode{"customers", 0, OpEquals, "orders", 1}, plan.Steps[0].Node)
+	assert.Equal(t, JoinHash, plan.Steps[0].Algorithm)
+	assert.Equal(t, "orders", plan.Steps[1].Node.Table1Alias)
+	assert.Equal(t, "products", plan.Steps[1].Node.Table2Alias)
+	assert.InEpsilon(t, 1000, plan.Steps[0].Card, 0.05)
+	assert.Equal(t, plan.Steps[1].Card, plan.Card)
+	assert.Equal(t, plan.Steps[1].Cost, plan.Cost)
+	assert.Contains(t, plan.String(), "Scan(customers) -> HashJoin(customers.0 = orders.1)")
+}
+
+func TestJoinOptimizer_Algorithm(t *testing.T) {
+	jo := NewJoinOptimizer()
+	require.NoError(t, jo.AddTable("a", fakeTableStats(t, 10000, 100, 10000), 1))
+	require.NoError(t, jo.AddTable("b", fakeTableStats(t, 10000, 100, 10000), 1))
+	require.NoError(t, jo.AddJoin(LogicalJoinNode{"a", 0, OpLessThan, "b", 0}))
+	plan, err := jo.Optimize()
+	require.NoError(t, err)
+	assert.Equal(t, JoinSortMerge, plan.Steps[0].Algorithm, "hash join is only for equality")
+
+	jo = NewJoinOptimizer()
+	require.NoError(t, jo.AddTable("a", fakeTableStats(t, 10, 1, 10), 1))
+	require.NoError(t, jo.AddTable("b", fakeTableStats(t, 10, 1, 10), 1))
+	require.NoError(t, jo.AddJoin(LogicalJoinNode{"a", 0, OpNotEquals, "b", 0}))
+	require.NoError(t, jo.AddJoin(LogicalJoinNode{"b", 0, OpGreaterThan, "a", 0}))
+	plan, err = jo.Optimize()
+	require.NoError(t, err)
+	assert.Equal(t, JoinSortMerge, plan.Steps[0].Algorithm)
+	// the range join is swapped with the tables
+	if plan.Outer == "a" {
+		assert.Equal(t, LogicalJoinNode{"a", 0, OpLessThan, "b", 0}, plan.Steps[0].Node)
+	} else {
+		assert.Equal(t, LogicalJoinNode{"b", 0, OpGreaterThan, "a", 0}, plan.Steps[0].Node)
+	}
+	assert.Len(t, plan.Steps[0].Filters, 1)
+	assert.Equal(t, OpNotEquals, plan.Steps[0].Filters[0].Op)
+
+	jo = NewJoinOptimizer()
+	require.NoError(t, jo.AddTable("a", fakeTableStats(t, 10, 1, 10), 1))
+	require.NoError(t, jo.AddTable("b", fakeTableStats(t, 10, 1, 10), 1))
+	require.NoError(t, jo.AddJoin(LogicalJoinNode{"a", 0, OpNotEquals, "b", 0}))
+	plan, err = jo.Optimize()
+	require.NoError(t, err)
+	assert.Equal(t, JoinNestedLoop, plan.Steps[0].Algorithm)
+}
+
+func TestJoinOptimizer_NotConnected(t *testing.T) {
+	jo := NewJoinOptimizer()
+	_, err := jo.Optimize()
+	assert.Error(t, err)
+	require.NoError(t, jo.AddTable("a", fakeTableStats(t, 10, 1, 10), 1))
+	plan, err := jo.Optimize()
+	require.NoError(t, err)
+	assert.Equal(t, "a", plan.Outer)
+	assert.Empty(t, plan.Steps)
+	require.NoError(t, jo.AddTable("b", fakeTableStats(t, 10, 1, 10), 1))
+	_, err = jo.Optimize()
+	assert.Error(t, err)
+}
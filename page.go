@@ -2,11 +2,13 @@ package newdb
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/anydemo/newdb/pkg/bitset"
 )
@@ -18,7 +20,7 @@ type PageID interface {
 	TableID() string
 }
 
-//Page page
+// Page page
 type Page interface {
 	encoding.BinaryMarshaler
 	// PageID get the PageID
@@ -26,6 +28,8 @@ type Page interface {
 	// MarkDirty mark the page dirty
 	// if TxID is nil, Mark not dirty
 	MarkDirty(*TxID)
+	// IsDirty the TxID dirtied the page, nil if not dirty
+	IsDirty() *TxID
 	TupleDesc() *TupleDesc
 }
 
@@ -40,8 +44,11 @@ type DBFile interface {
 	ReadPage(pid PageID) (Page, error)
 	WritePage(p Page) error
 
-	InsertTuple(*TxID, *Tuple) ([]Page, error)
-	DeleteTuple(*TxID, *Tuple) ([]Page, error)
+	InsertTuple(context.Context, *TxID, *Tuple) ([]Page, error)
+	DeleteTuple(context.Context, *TxID, *Tuple) ([]Page, error)
+	// UpdateTuple replace the old tuple(located by its RecordID) with the new one,
+	// the RecordID of the new tuple is set
+	UpdateTuple(ctx context.Context, txID *TxID, old *Tuple, tuple *Tuple) ([]Page, error)
 	TupleDesc() *TupleDesc
 	Iterator(*TxID) DbFileIterator
 }
@@ -83,35 +90,76 @@ func NewHeapPageID(tID string, pn int) *HeapPageID {
 
 var (
 	_     DBFile = (*HeapFile)(nil)
-	hfLog        = log.WithField("name", "heapfile")
+	hfLog        = newSubsystemLogger(LogHeapFile)
 )
 
 // HeapFile HeapFile
 //
 // file format:
 //
-// [Page][Page][Page][Page]...
+// [HeapFileHeader][Page][Page][Page][Page]...
+//
+// the header takes one page, PageNum 0 is the first page after the header
 type HeapFile struct {
-	File *os.File
-	TD   *TupleDesc
+	File   *os.File
+	TD     *TupleDesc
+	Header *HeapFileHeader
+	// MVCC every tuple is a version with creator and deleter, see TxManager
+	MVCC bool
+
+	// fsmMu guard the open of fsm
+	fsmMu sync.Mutex
+	fsm   *FreeSpaceMap
+	// group the group commit of the syncs, see Sync
+	group *groupSync
+	// snapMu guard snap, the writers hold the read lock until the page is written
+	snapMu sync.RWMutex
+	// snap the running snapshot of backup, see BackupTo
+	snap *pageSnapshot
+}
+
+// NewHeapFile new HeapFile, the header is written if file is empty,
+// or else the header is validated with td and the page size of database
+func NewHeapFile(file *os.File, td *TupleDesc) (*HeapFile, error) {
+	return newHeapFile(file, td, false)
+}
+
+// NewMVCCHeapFile new HeapFile of MVCC table, see NewHeapFile
+func NewMVCCHeapFile(file *os.File, td *TupleDesc) (*HeapFile, error) {
+	return newHeapFile(file, td, true)
+}
+
+func newHeapFile(file *os.File, td *TupleDesc, mvcc bool) (*HeapFile, error) {
+	ret := &HeapFile{
+		File:  file,
+		TD:    td,
+		MVCC:  mvcc,
+		group: newGroupSync(file),
+	}
+	if err := ret.initHeader(); err != nil {
+		return nil, err
+	}
+	return ret, nil
 }
 
-// NewHeapFile new HeapFile
-func NewHeapFile(file *os.File, td *TupleDesc) *HeapFile {
-	return &HeapFile{
-		File: file,
-		TD:   td,
-	}
+// layout the empty HeapPage to compute the slots of the HeapFile
+func (hf *HeapFile) layout() *HeapPage {
+	return &HeapPage{TD: hf.TD, MVCC: hf.MVCC}
 }
 
 // ID string
-func (hf HeapFile) ID() string {
+func (hf *HeapFile) ID() string {
 	return fmt.Sprintf("%x", sha1.Sum([]byte(hf.File.Name())))
 }
 
+// pageOffset the offset of the page in file, the header page is skipped
+func (hf *HeapFile) pageOffset(pageNum int) int64 {
+	return int64(pageNum+1) * int64(DB.B().PageSize())
+}
+
 // ReadPage read one page
-func (hf HeapFile) ReadPage(pid PageID) (Page, error) {
-	seek, err := hf.File.Seek(int64(pid.PageNum()*DB.B().PageSize()), 0)
+func (hf *HeapFile) ReadPage(pid PageID) (Page, error) {
+	seek, err := hf.File.Seek(hf.pageOffset(pid.PageNum()), 0)
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +168,13 @@ func (hf HeapFile) ReadPage(pid PageID) (Page, error) {
 	if err != nil {
 		return nil, err
 	}
-	hfLog.WithField("op", "read_page").WithField("seek", seek).WithField("read_len", n).Infof("read page from HeapFile")
+	if hfLog.Enabled(LevelDebug) {
+		hfLog.Debug("read page from HeapFile", "op", "read_page", "seek", seek, "read_len", n)
+	}
+	if err = VerifyPageChecksum(pid, buf); err != nil {
+		hfLog.Error("verify page checksum", "error", err)
+		return nil, err
+	}
 	heapPID, ok := pid.(*HeapPageID)
 	if !ok {
 		return nil, fmt.Errorf("pid is not HeapPageID")
@@ -132,85 +186,251 @@ func (hf HeapFile) ReadPage(pid PageID) (Page, error) {
 	return page, err
 }
 
-// WritePage write one page
+// readPageFields read the page from file, and decode the used slots with only the fields of table,
+// the other fields are skipped by the size of their type without parsing.
+// the tuples are of td, the TupleDesc of fields, and are not on any HeapPage
+func (hf *HeapFile) readPageFields(pid PageID, td *TupleDesc, fields []int) ([]*Tuple, error) {
+	buf := make([]byte, DB.B().PageSize())
+	if _, err := hf.File.ReadAt(buf, hf.pageOffset(pid.PageNum())); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := VerifyPageChecksum(pid, buf); err != nil {
+		hfLog.Error("verify page checksum", "error", err)
+		return nil, err
+	}
+	heapPID, ok := pid.(*HeapPageID)
+	if !ok {
+		return nil, fmt.Errorf("pid is not HeapPageID")
+	}
+	offsets := make([]int, len(hf.TD.TdItems))
+	for i := 1; i < len(offsets); i++ {
+		offsets[i] = offsets[i-1] + int(hf.TD.TdItems[i-1].Type.Len)
+	}
+	layout := hf.layout()
+	head := bitset.Bytes(buf[PageReservedSize : PageReservedSize+layout.HeaderSize()])
+	tuplesStart := PageReservedSize + layout.HeaderSize()
+	var ret []*Tuple
+	for i := 0; i < layout.NumOfTuples(); i++ {
+		if !head.Get(uint(i)) {
+			continue
+		}
+		slot := buf[tuplesStart+i*layout.TupleSize() : tuplesStart+(i+1)*layout.TupleSize()]
+		tuple := &Tuple{TD: td, RecordID: NewRecordID(heapPID, i), Fields: make([]Field, len(fields))}
+		if hf.MVCC {
+			tuple.Xmin, tuple.Xmax = DefaultOrder.Uint64(slot), DefaultOrder.Uint64(slot[8:])
+			slot = slot[TupleVersionSize:]
+		}
+		for j, f := range fields {
+			item := hf.TD.TdItems[f]
+			field, err := item.Type.Parse(bytes.NewReader(slot[offsets[f] : offsets[f]+int(item.Type.Len)]))
+			if err != nil {
+				return nil, fmt.Errorf("read tuple %vth field %v err: %v", i, item.Name, err)
+			}
+			tuple.Fields[j] = field
+		}
+		ret = append(ret, tuple)
+	}
+	return ret, nil
+}
+
+// WritePage write one page, and sync the file
 func (hf *HeapFile) WritePage(page Page) error {
-	seek, err := hf.File.Seek(int64(page.PageID().PageNum()*DB.B().PageSize()), 0)
-	if err != nil {
+	if err := hf.writePage(page); err != nil {
 		return err
 	}
+	return hf.Sync()
+}
+
+// writePage write one page without sync
+func (hf *HeapFile) writePage(page Page) error {
 	buf, err := page.MarshalBinary()
 	if err != nil {
 		return err
 	}
-	n, err := hf.File.Write(buf)
-	if err != nil {
+	PutPageChecksum(buf)
+	if err = hf.writePagesAt(page.PageID().PageNum(), buf); err != nil {
 		return err
 	}
-	err = hf.File.Sync()
-	hfLog.WithField("op", "write_page").WithField("seek", seek).WithField("write_size", n).Infof("write page to HeapFile")
-	return err
+	if hfLog.Enabled(LevelDebug) {
+		hfLog.Debug("write page to HeapFile", "op", "write_page", "seek", hf.pageOffset(page.PageID().PageNum()), "write_size", len(buf))
+	}
+	return nil
 }
 
 // NumPagesInFile get real num pages in file
-func (hf HeapFile) NumPagesInFile() int64 {
+func (hf *HeapFile) NumPagesInFile() int64 {
 	info, err := hf.File.Stat()
 	if err != nil {
-		hfLog.WithError(err).WithField("id", hf.ID())
+		hfLog.Error("stat HeapFile", "error", err, "id", hf.ID())
 		return 0
 	}
 	pageSize := int64(DB.B().PageSize())
-	return (info.Size() + pageSize - 1) / pageSize
+	if info.Size() <= pageSize {
+		return 0
+	}
+	// the header page is not counted, and the trailing partial page is counted
+	return (info.Size() - 1) / pageSize
 }
 
-// InsertTuple insert tuple to the HeapPage
-func (hf *HeapFile) InsertTuple(txID *TxID, tuple *Tuple) (ret []Page, err error) {
-	for i := 0; int64(i) <= hf.NumPagesInFile(); i++ {
-		HPID := NewHeapPageID(hf.ID(), i)
-		var page Page
-		if int64(i) < hf.NumPagesInFile() {
-			page, err = DB.B().GetPage(txID, HPID, PermReadWrite)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			page, err = NewHeapPage(NewHeapPageID(hf.ID(), i), HeapPageCreateEmptyPageData())
-			if err != nil {
+// InsertTuple insert tuple to the HeapPage, the page with free slot is found by the FreeSpaceMap.
+// if no page has free slot, a new page is appended.
+// the tuple of MVCC table is the version created by txID
+func (hf *HeapFile) InsertTuple(ctx context.Context, txID *TxID, tuple *Tuple) (ret []Page, err error) {
+	if hf.MVCC {
+		return DB.T().insertVersion(ctx, txID, hf, tuple)
+	}
+	if err = DB.T().checkIsolation(txID, hf); err != nil {
+		return nil, err
+	}
+	return hf.insertTuple(ctx, txID, tuple)
+}
+
+func (hf *HeapFile) insertTuple(ctx context.Context, txID *TxID, tuple *Tuple) (ret []Page, err error) {
+	fsm, err := hf.FreeSpaceMap()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		pageNum, ok := fsm.Find()
+		if !ok {
+			break
+		}
+		if int64(pageNum) >= hf.NumPagesInFile() {
+			if err = fsm.Set(pageNum, false); err != nil {
 				return nil, err
 			}
+			continue
+		}
+		page, err := DB.B().GetPage(ctx, txID, NewHeapPageID(hf.ID(), pageNum), PermReadWrite)
+		if err != nil {
+			return nil, err
 		}
 		heapPage, ok := page.(*HeapPage)
 		if !ok {
 			return nil, fmt.Errorf("assign page HeapPage error")
 		}
-		if heapPage.EmptyTupleNum() > 0 {
-			err = heapPage.InsertTuple(tuple)
-			if err != nil {
-				hfLog.WithError(err).WithField("page_id", page.PageID).Warn("can not insert to this page, so insert to next page")
-				continue
+		inserted := heapPage.EmptyTupleNum() > 0
+		if inserted {
+			if err = heapPage.InsertTuple(tuple); err != nil {
+				return nil, err
 			}
-			// flush newly created page to disk
-			if int64(i) == hf.NumPagesInFile() {
-				err = hf.WritePage(page)
-				if err != nil {
-					hfLog.WithError(err).WithField("page", page.PageID()).Error("write page error")
-					return nil, err
-				}
-				hfLog.WithField("pid", page.PageID).Infof("page full, write to disk")
+		}
+		if heapPage.EmptyTupleNum() == 0 {
+			if err = fsm.Set(pageNum, false); err != nil {
+				return nil, err
 			}
-			ret = append(ret, heapPage)
-			return
 		}
+		if inserted {
+			return []Page{heapPage}, nil
+		}
+	}
+
+	// append new empty page to disk, the tuple is only in the dirty page,
+	// so it is discarded if the transaction aborts
+	pageNum := int(hf.NumPagesInFile())
+	heapPage, err := NewHeapPage(NewHeapPageID(hf.ID(), pageNum), HeapPageCreateEmptyPageData())
+	if err != nil {
+		return nil, err
+	}
+	if err = hf.WritePage(heapPage); err != nil {
+		hfLog.Error("write page error", "error", err, "page", heapPage.PageID())
+		return nil, err
+	}
+	if err = heapPage.InsertTuple(tuple); err != nil {
+		return nil, err
+	}
+	// the page is free on disk, if it becomes full, the next Find clear the bit
+	if err = fsm.Set(pageNum, true); err != nil {
+		return nil, err
+	}
+	return []Page{heapPage}, nil
+}
+
+// heapPageOf get the HeapPage where the tuple lives through the BufferPool
+func (hf *HeapFile) heapPageOf(ctx context.Context, txID *TxID, tuple *Tuple) (*HeapPage, error) {
+	if tuple.RecordID == nil || tuple.RecordID.PID == nil {
+		return nil, fmt.Errorf("tuple has no RecordID")
+	}
+	if tableID := tuple.RecordID.PID.TableID(); tableID != hf.ID() {
+		return nil, fmt.Errorf("tuple belongs to table %v, not %v", tableID, hf.ID())
+	}
+	page, err := DB.B().GetPage(ctx, txID, tuple.RecordID.PID, PermReadWrite)
+	if err != nil {
+		return nil, err
+	}
+	heapPage, ok := page.(*HeapPage)
+	if !ok {
+		return nil, fmt.Errorf("page is not HeapPage: %T", page)
+	}
+	return heapPage, nil
+}
+
+// DeleteTuple del tuple from the HeapPage where the tuple.RecordID point to,
+// the tuple of MVCC table is kept as the version deleted by txID until vacuum
+func (hf *HeapFile) DeleteTuple(ctx context.Context, txID *TxID, tuple *Tuple) ([]Page, error) {
+	if hf.MVCC {
+		return DB.T().deleteVersion(ctx, txID, hf, tuple)
+	}
+	if err := DB.T().checkIsolation(txID, hf); err != nil {
+		return nil, err
+	}
+	heapPage, err := hf.heapPageOf(ctx, txID, tuple)
+	if err != nil {
+		return nil, err
+	}
+	err = heapPage.DeleteTuple(tuple)
+	if err != nil {
+		return nil, err
+	}
+	fsm, err := hf.FreeSpaceMap()
+	if err != nil {
+		return nil, err
+	}
+	if err = fsm.Set(heapPage.PID.PageNum(), true); err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("failed to insert this tuple")
+	return []Page{heapPage}, nil
 }
 
-// DeleteTuple del tuple to the HeapPage
-func (hf *HeapFile) DeleteTuple(*TxID, *Tuple) ([]Page, error) {
-	panic("not implemented")
+// UpdateTuple update the tuple in place if the new one fits in the slot,
+// or insert the new one with a new RecordID and then delete the old.
+// the new tuple of MVCC table is always a new version
+func (hf *HeapFile) UpdateTuple(ctx context.Context, txID *TxID, old *Tuple, tuple *Tuple) ([]Page, error) {
+	if !hf.TD.Equal(tuple.TD) {
+		return nil, fmt.Errorf("tuple desc is diff")
+	}
+	if hf.MVCC {
+		return DB.T().updateVersion(ctx, txID, hf, old, tuple)
+	}
+	if err := DB.T().checkIsolation(txID, hf); err != nil {
+		return nil, err
+	}
+	heapPage, err := hf.heapPageOf(ctx, txID, old)
+	if err != nil {
+		return nil, err
+	}
+	err = heapPage.UpdateTuple(old, tuple)
+	if err == nil {
+		return []Page{heapPage}, nil
+	}
+	if err != errSlotTooSmall {
+		return nil, err
+	}
+	// the old tuple is kept if the insert fails
+	hfLog.Debug("tuple not fit in slot, insert and delete", "record_id", old.RecordID)
+	ret, err := hf.InsertTuple(ctx, txID, tuple)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := hf.DeleteTuple(ctx, txID, old)
+	if err != nil {
+		return nil, err
+	}
+	return append(ret, deleted...), nil
 }
 
 // TupleDesc return TupleDesc
-func (hf HeapFile) TupleDesc() *TupleDesc {
+func (hf *HeapFile) TupleDesc() *TupleDesc {
 	return hf.TD
 }
 
@@ -225,10 +445,17 @@ var _ Page = (*HeapPage)(nil)
 //
 // file format:
 //
-// | header bit set | [Tuple][Tuple][Tuple][Tuple] |
+// | checksum 4B | LSN 8B | header bit set | [Tuple][Tuple][Tuple][Tuple] |
+//
+// the checksum is the CRC32C of the rest of the page, written by HeapFile.WritePage.
+// the tuple of MVCC table is | xmin 8B | xmax 8B | fields |
 type HeapPage struct {
-	PID         *HeapPageID
-	TD          *TupleDesc
+	PID *HeapPageID
+	TD  *TupleDesc
+	// MVCC the tuples have the version header
+	MVCC bool
+	// LSN the log sequence number of the last change of the page, always 0 until a write-ahead log exists
+	LSN         uint64
 	Head        []byte
 	Tuples      []*Tuple
 	TxMarkDirty *TxID
@@ -237,21 +464,29 @@ type HeapPage struct {
 // NewHeapPage new HeapPage
 func NewHeapPage(pid *HeapPageID, data []byte) (*HeapPage, error) {
 	ret := HeapPage{}
-	ret.TD = DB.C().GetTableByID(pid.TableID()).TupleDesc()
+	dbFile := DB.C().GetTableByID(pid.TableID())
+	ret.TD = dbFile.TupleDesc()
+	if hf, ok := dbFile.(*HeapFile); ok {
+		ret.MVCC = hf.MVCC
+	}
 	ret.PID = pid
 
-	bufReader := bytes.NewReader(data)
+	if len(data) < PageReservedSize {
+		return nil, fmt.Errorf("page size %v is less than reserved size %v", len(data), PageReservedSize)
+	}
+	ret.LSN = DefaultOrder.Uint64(data[PageChecksumSize:PageReservedSize])
+	bufReader := bytes.NewReader(data[PageReservedSize:])
 	ret.Head = make([]byte, ret.HeaderSize())
 	n, err := bufReader.Read(ret.Head)
 	if err != nil {
 		err = fmt.Errorf("read header error %v", err)
-		log.WithError(err).Warnf("read header error")
+		hfLog.Warn("read header error", "error", err)
 		return nil, err
 	}
 
 	if n < ret.HeaderSize() {
 		err = fmt.Errorf("read head want %v, get %v", ret.HeaderSize(), n)
-		log.WithError(err).Warnf("read head error")
+		hfLog.Warn("read head error", "error", err)
 		return nil, err
 	}
 	// TODO: implement here
@@ -263,7 +498,7 @@ func NewHeapPage(pid *HeapPageID, data []byte) (*HeapPage, error) {
 			return nil, err
 		}
 		if err == io.EOF {
-			log.Debugf("read %vth tuple, and end", i)
+			hfLog.Debug("read tuple, and end", "slot", i)
 		}
 	}
 	return &ret, nil
@@ -305,9 +540,17 @@ func (hp HeapPage) EmptyTupleNum() (ret int) {
 	return
 }
 
+// TupleSize the size of one slot, the fields and the version header of MVCC
+func (hp HeapPage) TupleSize() int {
+	if hp.MVCC {
+		return TupleVersionSize + hp.TD.Size()
+	}
+	return hp.TD.Size()
+}
+
 // NumOfTuples retrieve the number of tuples on this page.
 func (hp HeapPage) NumOfTuples() int {
-	return (DB.B().PageSize() * 8) / (hp.TD.Size()*8 + 1)
+	return ((DB.B().PageSize() - PageReservedSize) * 8) / (hp.TupleSize()*8 + 1)
 }
 
 // HeaderSize computes the number of bytes in the header of
@@ -319,20 +562,27 @@ func (hp HeapPage) HeaderSize() int {
 func (hp HeapPage) readNextTuple(r io.Reader, slotID int) (*Tuple, error) {
 	// if page not used
 	if !hp.Bitset().Get(uint(slotID)) {
-		buf := make([]byte, hp.TD.Size())
+		buf := make([]byte, hp.TupleSize())
 		n, err := r.Read(buf)
 		if err != nil {
 			return nil, err
 		}
-		if n != hp.TD.Size() {
-			err = fmt.Errorf("read size want: %v, get: %v", hp.TD.Size(), n)
+		if n != hp.TupleSize() {
+			err = fmt.Errorf("read size want: %v, get: %v", hp.TupleSize(), n)
 			return nil, err
 		}
-		assertEqual(n, hp.TD.Size())
+		assertEqual(n, hp.TupleSize())
 		return nil, nil
 	}
 	// else if page is used, read the Tuple
 	ret := &Tuple{TD: hp.TupleDesc(), RecordID: NewRecordID(hp.PageID(), slotID)}
+	if hp.MVCC {
+		buf := make([]byte, TupleVersionSize)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		ret.Xmin, ret.Xmax = DefaultOrder.Uint64(buf), DefaultOrder.Uint64(buf[8:])
+	}
 	for _, field := range hp.TD.TdItems {
 		f, err := field.Type.Parse(r)
 		if err != nil {
@@ -350,20 +600,76 @@ func (hp *HeapPage) InsertTuple(tuple *Tuple) error {
 	}
 	for i := 0; i < hp.NumOfTuples(); i++ {
 		if !hp.Bitset().Get(uint(i)) {
-			hp.Tuples[i] = tuple
-			tuple.RecordID = NewRecordID(hp.PID, i)
-			hp.Bitset().Set(uint(i))
+			hp.insertTupleAt(i, tuple)
 			return nil
 		}
 	}
 	return fmt.Errorf("page is full")
 }
 
+// slotOf check the tuple is stored in this page, and return its slot
+func (hp *HeapPage) slotOf(tuple *Tuple) (int, error) {
+	if tuple.RecordID == nil || tuple.RecordID.PID == nil || tuple.RecordID.PID.ID() != hp.PID.ID() {
+		return 0, fmt.Errorf("tuple is not on page %v", hp.PID.ID())
+	}
+	slot := tuple.RecordID.TupleNum
+	if slot < 0 || slot >= hp.NumOfTuples() {
+		return 0, fmt.Errorf("slot %v out of range [0, %v)", slot, hp.NumOfTuples())
+	}
+	if !hp.Bitset().Get(uint(slot)) {
+		return 0, fmt.Errorf("slot %v of page %v is empty", slot, hp.PID.ID())
+	}
+	return slot, nil
+}
+
+// DeleteTuple delete the tuple from the page, the RecordID of tuple is cleared
+func (hp *HeapPage) DeleteTuple(tuple *Tuple) error {
+	slot, err := hp.slotOf(tuple)
+	if err != nil {
+		return err
+	}
+	hp.Bitset().Unset(uint(slot))
+	hp.Tuples[slot] = nil
+	tuple.RecordID = nil
+	return nil
+}
+
+var errSlotTooSmall = fmt.Errorf("tuple does not fit in the slot")
+
+// UpdateTuple replace the old tuple with the new one in the same slot,
+// return errSlotTooSmall if the new tuple does not fit in the slot
+func (hp *HeapPage) UpdateTuple(old *Tuple, tuple *Tuple) error {
+	slot, err := hp.slotOf(old)
+	if err != nil {
+		return err
+	}
+	buf, err := tuple.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if len(buf) > hp.TupleDesc().Size() || !hp.TupleDesc().Equal(tuple.TD) {
+		return errSlotTooSmall
+	}
+	tuple.Xmin, tuple.Xmax = old.Xmin, old.Xmax
+	hp.Tuples[slot] = tuple
+	tuple.RecordID = NewRecordID(hp.PID, slot)
+	return nil
+}
+
+// insertTupleAt put the tuple to the empty slot, the TupleDesc should be checked by caller
+func (hp *HeapPage) insertTupleAt(slot int, tuple *Tuple) {
+	hp.Tuples[slot] = tuple
+	tuple.RecordID = NewRecordID(hp.PID, slot)
+	hp.Bitset().Set(uint(slot))
+}
+
 // MarshalBinary implement encoding.BinaryMarshaler
 func (hp HeapPage) MarshalBinary() (data []byte, err error) {
 	data = make([]byte, DB.B().PageSize())
-	var n = copy(data, []byte(hp.Head))
-	tupleSize := hp.TupleDesc().Size()
+	DefaultOrder.PutUint64(data[PageChecksumSize:], hp.LSN)
+	var n = PageReservedSize
+	n += copy(data[n:], []byte(hp.Head))
+	tupleSize := hp.TupleSize()
 	var buf []byte
 	for index, tuple := range hp.Tuples {
 		if hp.Bitset().Get(uint(index)) {
@@ -371,6 +677,9 @@ func (hp HeapPage) MarshalBinary() (data []byte, err error) {
 			if err != nil {
 				return nil, err
 			}
+			if hp.MVCC {
+				buf = append(tuple.marshalVersion(), buf...)
+			}
 		} else {
 			buf = make([]byte, tupleSize)
 		}
@@ -390,10 +699,22 @@ var _ DbFileIterator = (*HeapPageDbFileIterator)(nil)
 type HeapPageDbFileIterator struct {
 	curPage int
 	iter    OpIterator
+	ctx     context.Context
+	// pagesRead the num of pages read since created
+	pagesRead int
 
 	txID *TxID
 	hf   *HeapFile
 	Err  error
+
+	// Predicates the predicate lock of MVCC table taken at Open, nil lock the whole table
+	Predicates []*Predicate
+	// Fields the fields of table in the returned tuples, nil for all, see SelectFields
+	Fields []int
+	td     *TupleDesc
+	// snapshot the view of MVCC table, taken at the first Open
+	snapshot *Snapshot
+	release  func()
 }
 
 // NewHeapPageDbFileIterator  new HeapPageDbFileIterator with txID
@@ -405,45 +726,98 @@ func NewHeapPageDbFileIterator(txID *TxID, hf *HeapFile) *HeapPageDbFileIterator
 	}
 }
 
+// SelectFields only decode and return the fields of table
+func (it *HeapPageDbFileIterator) SelectFields(fields []int) error {
+	td, err := projectTupleDesc(it.hf.TD, fields)
+	if err != nil {
+		return err
+	}
+	it.Fields, it.td = fields, td
+	return nil
+}
+
 // Open open the iterator
-func (it *HeapPageDbFileIterator) Open() error {
+func (it *HeapPageDbFileIterator) Open(ctx context.Context) error {
+	it.ctx = ctx
 	it.curPage = 0
-	for (int64(it.curPage)) < it.hf.NumPagesInFile() {
-		if it.iter == nil {
-			page, err := DB.B().GetPage(it.txID, NewHeapPageID(it.hf.ID(), it.curPage), PermReadOnly)
-			if it.Err = err; err != nil {
-				return it.Error()
-			}
-			hp, ok := page.(*HeapPage)
-			if !ok {
-				it.Err = fmt.Errorf("page is not HeapPage: %T", page)
-				return it.Error()
-			}
-			it.iter = NewTupleIterator(page.TupleDesc(), hp.Tuples)
-			it.Err = it.iter.Open()
-			if err = it.Error(); err != nil {
-				return err
-			}
+	it.iter = nil
+	if it.Err = DB.T().checkIsolation(it.txID, it.hf); it.Err != nil {
+		return it.Err
+	}
+	if it.hf.MVCC && it.snapshot == nil {
+		snapshot, release := DB.T().acquire(it.txID, it.hf.ID(), it.Predicates)
+		it.snapshot, it.release = &snapshot, release
+	}
+	if it.hf.NumPagesInFile() > 0 {
+		it.Err = it.loadPage()
+	}
+	return it.Error()
+}
+
+// loadPage load the tuples of curPage, only the versions visible to the snapshot if MVCC
+func (it *HeapPageDbFileIterator) loadPage() error {
+	pid := NewHeapPageID(it.hf.ID(), it.curPage)
+	if it.hf.MVCC {
+		tuples, err := DB.T().visibleTuples(it.ctx, it.txID, *it.snapshot, it.hf, pid, it.td, it.Fields)
+		if err != nil {
+			return err
 		}
-		if !it.iter.HasNext() {
-			it.curPage++
-			it.iter = nil
-		} else {
-			return it.Error()
+		it.pagesRead++
+		td := it.hf.TD
+		if it.td != nil {
+			td = it.td
 		}
+		it.iter = NewTupleIterator(td, tuples)
+		return it.iter.Open(it.ctx)
 	}
-	return it.Error()
+	if it.Fields != nil {
+		tuples, err := DB.B().getTuples(it.ctx, it.hf, pid, it.td, it.Fields)
+		if err != nil {
+			return err
+		}
+		it.pagesRead++
+		it.iter = NewTupleIterator(it.td, tuples)
+		return it.iter.Open(it.ctx)
+	}
+	page, err := DB.B().GetPage(it.ctx, it.txID, NewHeapPageID(it.hf.ID(), it.curPage), PermReadOnly)
+	if err != nil {
+		return err
+	}
+	it.pagesRead++
+	hp, ok := page.(*HeapPage)
+	if !ok {
+		return fmt.Errorf("page is not HeapPage: %T", page)
+	}
+	it.iter = NewTupleIterator(page.TupleDesc(), hp.Tuples)
+	return it.iter.Open(it.ctx)
 }
 
-// Close close
+// Close close, and release the snapshot
 func (it *HeapPageDbFileIterator) Close() {
 	it.curPage = -1
 	it.iter = nil
+	if it.release != nil {
+		it.release()
+	}
+	it.snapshot, it.release = nil, nil
 }
 
-// HasNext has next
+// HasNext has next, move to the next page if the tuples of current page is exhausted
 func (it *HeapPageDbFileIterator) HasNext() bool {
-	return int64(it.curPage) < it.hf.NumPagesInFile() && it.iter != nil && it.iter.HasNext()
+	if it.curPage == -1 || it.iter == nil || it.Err != nil {
+		return false
+	}
+	for !it.iter.HasNext() {
+		it.curPage++
+		if int64(it.curPage) >= it.hf.NumPagesInFile() {
+			it.iter = nil
+			return false
+		}
+		if it.Err = it.loadPage(); it.Err != nil {
+			return false
+		}
+	}
+	return true
 }
 
 // Next next
@@ -452,45 +826,22 @@ func (it *HeapPageDbFileIterator) Next() (ret *Tuple) {
 		it.Err = fmt.Errorf("no such element, iterator has closed")
 		return nil
 	}
-	if !it.iter.HasNext() {
-		it.curPage++
-		for int64(it.curPage) < it.hf.NumPagesInFile() {
-			// next page
-			page, err := DB.B().GetPage(it.txID, NewHeapPageID(it.hf.ID(), it.curPage), PermReadOnly)
-			if it.Err = err; err != nil {
-				return nil
-			}
-			hp, ok := page.(*HeapPage)
-			if !ok {
-				it.Err = fmt.Errorf("page is not HeapPage: %T", page)
-				return nil
-			}
-			it.iter = NewTupleIterator(page.TupleDesc(), hp.Tuples)
-			it.Err = it.iter.Open()
-			if err = it.Error(); err != nil {
-				return nil
-			}
-
-			if !it.iter.HasNext() {
-				it.curPage++
-			} else {
-				break
-			}
-		}
-	}
-	if it.iter.HasNext() {
+	if it.HasNext() {
 		ret = it.iter.Next()
 	}
-	if ret == nil {
+	if ret == nil && it.Err == nil {
 		it.Err = fmt.Errorf("no element exists")
 	}
 	return
 }
 
-// Rewind rewind the iterator
+// Rewind rewind the iterator, the snapshot is kept
 func (it *HeapPageDbFileIterator) Rewind() error {
+	ctx, snapshot, release := it.ctx, it.snapshot, it.release
+	it.release = nil
 	it.Close()
-	return it.Open()
+	it.snapshot, it.release = snapshot, release
+	return it.Open(ctx)
 }
 
 // Error return err
@@ -1,6 +1,7 @@
 package newdb
 
 import (
+	"context"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
@@ -18,12 +19,13 @@ func TestNewHeapPage(t *testing.T) {
 	require.NotEqual(t, nil, page)
 
 	emptyPage = make([]byte, DB.B().PageSize())
-	emptyPage[0] = 0x1
+	emptyPage[PageReservedSize] = 0x1
 	tp := &Tuple{TD: page.TupleDesc(), Fields: []Field{NewIntField(8)}}
 	tpBuf, err := tp.MarshalBinary()
 	assert.NoErrorf(t, err, "marshal tuple must no error")
 	assert.Equal(t, []byte{0x8, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}, tpBuf)
-	copy(emptyPage[page.HeaderSize():page.HeaderSize()+tp.TD.Size()], tpBuf)
+	tupleStart := PageReservedSize + page.HeaderSize()
+	copy(emptyPage[tupleStart:tupleStart+tp.TD.Size()], tpBuf)
 	page, err = NewHeapPage(NewHeapPageID(singleFieldTableID, 1), emptyPage)
 	require.NoError(t, err, "new HeapPage has err")
 	assert.NotNil(t, page.TupleDesc())
@@ -71,11 +73,11 @@ func TestNewHeapPageDbFileIterator(t *testing.T) {
 		TD:     td,
 		Fields: []Field{NewIntField(1)},
 	}
-	err := DB.B().InsertTuple(txID, singleFieldTableID, tuple)
+	err := DB.B().InsertTuple(context.Background(), txID, singleFieldTableID, tuple)
 	assert.NoError(t, err)
 	it := NewHeapPageDbFileIterator(txID, dbFile.(*HeapFile))
 	assert.NotEqual(t, nil, it)
-	err = it.Open()
+	err = it.Open(context.Background())
 	assert.NoError(t, err)
 	var i int
 	for it.HasNext() {
@@ -86,3 +88,64 @@ func TestNewHeapPageDbFileIterator(t *testing.T) {
 	}
 	assert.NotEqual(t, 0, i)
 }
+
+func TestHeapPage_DeleteUpdateTuple(t *testing.T) {
+	pageBuf, err := GeneratePageBytes(3)
+	require.NoError(t, err)
+	page, err := NewHeapPage(NewHeapPageID(singleFieldTableID, 1), pageBuf)
+	require.NoError(t, err)
+	td := page.TupleDesc()
+
+	second := page.Tuples[1]
+	updated := &Tuple{TD: td, Fields: []Field{NewIntField(42)}}
+	require.NoError(t, page.UpdateTuple(second, updated))
+	assert.Equal(t, NewRecordID(page.PageID(), 1), updated.RecordID)
+	assert.Equal(t, updated, page.Tuples[1])
+
+	other := &Tuple{TD: GetTupleDesc(2, "x"), Fields: GetFields(2)}
+	assert.Equal(t, errSlotTooSmall, page.UpdateTuple(updated, other))
+
+	require.NoError(t, page.DeleteTuple(updated))
+	assert.Nil(t, updated.RecordID)
+	assert.Nil(t, page.Tuples[1])
+	assert.False(t, page.Bitset().Get(1))
+	assert.Equal(t, 2, NumOfNotNilPage(page))
+
+	assert.Error(t, page.DeleteTuple(&Tuple{TD: td, RecordID: NewRecordID(page.PageID(), 1)}), "slot is empty")
+	assert.Error(t, page.DeleteTuple(&Tuple{TD: td, RecordID: NewRecordID(NewHeapPageID(singleFieldTableID, 2), 0)}), "other page")
+	assert.Error(t, page.DeleteTuple(&Tuple{TD: td}), "no RecordID")
+}
+
+func TestBufferPool_DeleteTuple(t *testing.T) {
+	tableID, err := RandDBFile(1)
+	require.NoError(t, err)
+	txID := NewTxID()
+	td := DB.C().GetTableByID(tableID).TupleDesc()
+	tuple := &Tuple{TD: td, Fields: []Field{NewIntField(7)}}
+	require.NoError(t, DB.B().InsertTuple(context.Background(), txID, tableID, tuple))
+	pid := tuple.RecordID.PID
+	require.NoError(t, DB.B().DeleteTuple(context.Background(), txID, tuple))
+	page, err := DB.B().GetPage(context.Background(), txID, pid, PermReadOnly)
+	require.NoError(t, err)
+	assert.Equal(t, 0, NumOfNotNilPage(page.(*HeapPage)))
+	assert.Equal(t, txID, page.(*HeapPage).IsDirty())
+	assert.Error(t, DB.B().DeleteTuple(context.Background(), txID, tuple), "RecordID is cleared")
+}
+
+func TestBufferPool_UpdateTupleDiffTupleDesc(t *testing.T) {
+	tableID, err := RandDBFile(1)
+	require.NoError(t, err)
+	txID := NewTxID()
+	td := DB.C().GetTableByID(tableID).TupleDesc()
+	tuple := &Tuple{TD: td, Fields: []Field{NewIntField(7)}}
+	require.NoError(t, DB.B().InsertTuple(context.Background(), txID, tableID, tuple))
+	pid := tuple.RecordID.PID
+
+	other := &Tuple{TD: GetTupleDesc(2, "x"), Fields: GetFields(2)}
+	assert.Error(t, DB.B().UpdateTuple(context.Background(), txID, tuple, other), "the new tuple can not be inserted")
+	assert.NotNil(t, tuple.RecordID)
+	page, err := DB.B().GetPage(context.Background(), txID, pid, PermReadOnly)
+	require.NoError(t, err)
+	assert.Equal(t, 1, NumOfNotNilPage(page.(*HeapPage)), "the old tuple survives")
+	assert.Equal(t, tuple, page.(*HeapPage).Tuples[tuple.RecordID.TupleNum])
+}
@@ -0,0 +1,125 @@
+package newdb
+
+import (
+	"encoding"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FieldFactory create an empty Field of the Type, the Field is filled by UnmarshalBinary
+type FieldFactory func(t *Type) Field
+
+// TypeInfo one registered column type
+type TypeInfo struct {
+	// SchemaName the name used in schema json, eg: int
+	SchemaName string
+	// Type the Type, Type.Name is the name used by Type.Parse
+	Type *Type
+	// New the Field factory
+	New FieldFactory
+}
+
+type typeRegistry struct {
+	sync.RWMutex
+	// bySchemaName k is TypeInfo.SchemaName
+	bySchemaName map[string]*TypeInfo
+	// byTypeName k is TypeInfo.Type.Name
+	byTypeName map[string]*TypeInfo
+}
+
+var typeReg = &typeRegistry{
+	bySchemaName: make(map[string]*TypeInfo),
+	byTypeName:   make(map[string]*TypeInfo),
+}
+
+func init() {
+	builtin := []TypeInfo{
+		{"int", IntType, func(t *Type) Field { return &IntField{TypeReal: t} }},
+		{"float", FloatType, func(t *Type) Field { return &FloatField{TypeReal: t} }},
+		{"bool", BoolType, func(t *Type) Field { return &BoolField{TypeReal: t} }},
+		{"date", DateType, func(t *Type) Field { return &DateField{TypeReal: t} }},
+		{"timestamp", TimestampType, func(t *Type) Field { return &TimestampField{TypeReal: t} }},
+		{"decimal", DecimalType, func(t *Type) Field { return &DecimalField{TypeReal: t} }},
+	}
+	for _, info := range builtin {
+		if err := RegisterType(info.SchemaName, info.Type, info.New); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterType register a column type, so that it can be used in schema json with schemaName.
+// Both schemaName and t.Name must be unique
+func RegisterType(schemaName string, t *Type, factory FieldFactory) error {
+	if schemaName == "" || t == nil || t.Name == "" || t.Len == 0 || factory == nil {
+		return fmt.Errorf("register type %q: name, type and factory are required", schemaName)
+	}
+	typeReg.Lock()
+	defer typeReg.Unlock()
+	if _, exists := typeReg.bySchemaName[schemaName]; exists {
+		return fmt.Errorf("register type %q: schema name already registered", schemaName)
+	}
+	if _, exists := typeReg.byTypeName[t.Name]; exists {
+		return fmt.Errorf("register type %q: type name %q already registered", schemaName, t.Name)
+	}
+	info := &TypeInfo{SchemaName: schemaName, Type: t, New: factory}
+	typeReg.bySchemaName[schemaName] = info
+	typeReg.byTypeName[t.Name] = info
+	return nil
+}
+
+// LookupType get the TypeInfo by the name used in schema json
+func LookupType(schemaName string) (*TypeInfo, bool) {
+	typeReg.RLock()
+	defer typeReg.RUnlock()
+	info, ok := typeReg.bySchemaName[schemaName]
+	return info, ok
+}
+
+// LookupTypeByName get the TypeInfo by Type.Name
+func LookupTypeByName(typeName string) (*TypeInfo, bool) {
+	typeReg.RLock()
+	defer typeReg.RUnlock()
+	info, ok := typeReg.byTypeName[typeName]
+	return info, ok
+}
+
+// RegisteredTypes the schema names of all registered types, sorted
+func RegisteredTypes() (ret []string) {
+	typeReg.RLock()
+	defer typeReg.RUnlock()
+	for name := range typeReg.bySchemaName {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return
+}
+
+// ParseField parse the text to the Field of type t, the Field must implement encoding.TextUnmarshaler
+func ParseField(t *Type, text string) (Field, error) {
+	info, ok := LookupTypeByName(t.Name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %v", t.Name)
+	}
+	field := info.New(info.Type)
+	unmarshaler, ok := field.(encoding.TextUnmarshaler)
+	if !ok {
+		return nil, fmt.Errorf("type %v can not be parsed from text", t.Name)
+	}
+	if err := unmarshaler.UnmarshalText([]byte(text)); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// FormatField the text of the Field, the reverse of ParseField.
+// if the Field not implement encoding.TextMarshaler, Field.String is used
+func FormatField(field Field) (string, error) {
+	marshaler, ok := field.(encoding.TextMarshaler)
+	if !ok {
+		return field.String(), nil
+	}
+	text, err := marshaler.MarshalText()
+	return string(text), err
+}
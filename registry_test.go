@@ -0,0 +1,90 @@
+package newdb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var uuidType = &Type{Name: "uuid", Len: 16}
+
+// uuidField custom field registered in test, only used for check the registry
+type uuidField struct {
+	Val      [16]byte
+	TypeReal *Type
+}
+
+func (u uuidField) String() string { return fmt.Sprintf("uuid(%x)", u.Val) }
+
+func (u uuidField) Type() *Type { return u.TypeReal }
+
+func (u uuidField) Compare(op Op, val Field) bool {
+	uV, ok := val.(*uuidField)
+	if !ok {
+		return false
+	}
+	return cmpResult(op, bytes.Compare(u.Val[:], uV.Val[:]))
+}
+
+func (u uuidField) MarshalBinary() ([]byte, error) { return append([]byte(nil), u.Val[:]...), nil }
+
+func (u *uuidField) UnmarshalBinary(data []byte) error {
+	if len(data) != len(u.Val) {
+		return fmt.Errorf("uuid want %v bytes, get %v", len(u.Val), len(data))
+	}
+	copy(u.Val[:], data)
+	return nil
+}
+
+func init() {
+	err := RegisterType("uuid", uuidType, func(t *Type) Field { return &uuidField{TypeReal: t} })
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	assert.Error(t, RegisterType("uuid", &Type{Name: "uuid2", Len: 16}, func(t *Type) Field { return nil }), "dup schema name")
+	assert.Error(t, RegisterType("int64", &Type{Name: "int64", Len: 8}, func(t *Type) Field { return nil }), "dup type name")
+	assert.Error(t, RegisterType("empty", &Type{Name: "empty"}, func(t *Type) Field { return nil }), "zero len")
+	assert.Error(t, RegisterType("nofactory", &Type{Name: "nofactory", Len: 1}, nil))
+
+	info, ok := LookupType("int")
+	require.True(t, ok)
+	assert.Equal(t, IntType, info.Type)
+	info, ok = LookupTypeByName("decimal")
+	require.True(t, ok)
+	assert.Equal(t, "decimal", info.SchemaName)
+	_, ok = LookupType("string")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"bool", "counted", "date", "decimal", "float", "int", "timestamp", "uuid"}, RegisteredTypes())
+}
+
+func TestRegisterType_CustomType(t *testing.T) {
+	tmpfile, err := TmpDataFile()
+	require.NoError(t, err)
+	var schema = strings.NewReader("[{\"filename\":\"" + tmpfile + "\",\"td\":[{\"name\":\"id\",\"type\":\"uuid\"},{\"name\":\"n\",\"type\":\"int\"}]}]")
+	catalog := NewCatalog()
+	tableIDs, err := catalog.LoadSchema(schema)
+	require.NoError(t, err)
+	td := catalog.GetTableByID(tableIDs[0]).TupleDesc()
+	assert.Equal(t, "id(uuid(16)),n(int64(8))", td.String())
+	assert.Equal(t, "id(uuid(16))", TdItem{Name: "id", Type: &Type{Name: uuidType.Name}}.String(), "named by the registry")
+	assert.Equal(t, 24, td.Size())
+
+	field := &uuidField{TypeReal: uuidType}
+	copy(field.Val[:], "0123456789abcdef")
+	buf, err := field.MarshalBinary()
+	require.NoError(t, err)
+	parsed, err := uuidType.Parse(bytes.NewReader(buf))
+	require.NoError(t, err)
+	assert.Equal(t, Field(field), parsed)
+
+	_, err = StringType.Parse(bytes.NewReader(make([]byte, 16)))
+	assert.Error(t, err, "string type is not registered")
+}
@@ -0,0 +1,309 @@
+package newdb
+
+import "math"
+
+// MaxRewriteIterations the max times Rewrite applies the rules until the plan is unchanged
+const MaxRewriteIterations = 8
+
+// Rule the rewrite rule of logical plan, Apply return the new plan, or plan if nothing to rewrite
+type Rule struct {
+	Name  string
+	Apply func(plan LogicalPlan) LogicalPlan
+}
+
+var (
+	// RuleFoldConstants evaluate the comparisons of constants, and simplify AND, OR and NOT
+	RuleFoldConstants = Rule{Name: "FoldConstants", Apply: foldConstants}
+	// RuleEliminateFilters remove the always-true filters, and replace the always-false filters by Empty
+	RuleEliminateFilters = Rule{Name: "EliminateFilters", Apply: eliminateFilters}
+	// RulePushDownPredicates move the conjuncts of filters to the lowest node having their columns,
+	// below joins, and the conjuncts across both sides become the join condition
+	RulePushDownPredicates = Rule{Name: "PushDownPredicates", Apply: pushDownPredicates}
+	// RulePruneColumns only scan the columns needed by the parents
+	RulePruneColumns = Rule{Name: "PruneColumns", Apply: pruneColumns}
+
+	// DefaultRules the rules of Rewrite
+	DefaultRules = []Rule{RuleFoldConstants, RuleEliminateFilters, RulePushDownPredicates, RulePruneColumns}
+)
+
+// Rewrite apply DefaultRules until the plan is unchanged
+func Rewrite(plan LogicalPlan) LogicalPlan {
+	return RewriteWith(plan, DefaultRules...)
+}
+
+// RewriteWith apply the rules in order, until the plan is unchanged or MaxRewriteIterations
+func RewriteWith(plan LogicalPlan, rules ...Rule) LogicalPlan {
+	last := FormatPlan(plan)
+	for i := 0; i < MaxRewriteIterations; i++ {
+		for _, rule := range rules {
+			plan = rule.Apply(plan)
+		}
+		cur := FormatPlan(plan)
+		if cur == last {
+			break
+		}
+		last = cur
+	}
+	return plan
+}
+
+// transformUp apply fn to the children, then the node
+func transformUp(plan LogicalPlan, fn func(LogicalPlan) LogicalPlan) LogicalPlan {
+	if children := plan.Children(); len(children) > 0 {
+		transformed := make([]LogicalPlan, len(children))
+		for i, child := range children {
+			transformed[i] = transformUp(child, fn)
+		}
+		plan = plan.WithChildren(transformed)
+	}
+	return fn(plan)
+}
+
+func foldConstants(plan LogicalPlan) LogicalPlan {
+	return transformUp(plan, func(plan LogicalPlan) LogicalPlan {
+		switch p := plan.(type) {
+		case *LogicalFilter:
+			return &LogicalFilter{Cond: foldCond(p.Cond, planColumnTypes(p.Child)), Child: p.Child}
+		case *LogicalJoin:
+			if p.Cond != nil {
+				return &LogicalJoin{Left: p.Left, Right: p.Right, Cond: foldCond(p.Cond, planColumnTypes(p))}
+			}
+		}
+		return plan
+	})
+}
+
+// foldCond the simplified cond
+func foldCond(cond Cond, types columnTypes) Cond {
+	switch c := cond.(type) {
+	case *Compare:
+		return foldCompare(c, types)
+	case And:
+		var ret []Cond
+		for _, sub := range c {
+			sub = foldCond(sub, types)
+			if b, ok := sub.(BoolConst); ok {
+				if !b {
+					return BoolConst(false)
+				}
+				continue
+			}
+			ret = append(ret, conjuncts(sub)...)
+		}
+		if len(ret) == 0 {
+			return BoolConst(true)
+		}
+		return conjunction(ret)
+	case Or:
+		var ret []Cond
+		for _, sub := range c {
+			sub = foldCond(sub, types)
+			if b, ok := sub.(BoolConst); ok {
+				if b {
+					return BoolConst(true)
+				}
+				continue
+			}
+			if or, ok := sub.(Or); ok {
+				ret = append(ret, or...)
+				continue
+			}
+			ret = append(ret, sub)
+		}
+		switch len(ret) {
+		case 0:
+			return BoolConst(false)
+		case 1:
+			return ret[0]
+		}
+		return Or(ret)
+	case *Not:
+		switch sub := foldCond(c.Cond, types).(type) {
+		case BoolConst:
+			return !sub
+		case *Not:
+			return sub.Cond
+		case *Compare:
+			// NOT (NaN < x) is true, but NaN >= x is false
+			if op, ok := sub.Op.negate(); ok && types.noNaN(sub.Left) && types.noNaN(sub.Right) {
+				return &Compare{Left: sub.Left, Op: op, Right: sub.Right}
+			}
+			return &Not{Cond: sub}
+		default:
+			return &Not{Cond: sub}
+		}
+	}
+	return cond
+}
+
+// foldCompare evaluate the comparison of constants of the same type, and compare a column with itself
+// if it can not hold NaN, the constant is moved to the right
+func foldCompare(c *Compare, types columnTypes) Cond {
+	left, ok1 := c.Left.(ConstExpr)
+	right, ok2 := c.Right.(ConstExpr)
+	if ok1 && ok2 && left.Val.Type() == right.Val.Type() {
+		return BoolConst(left.Val.Compare(c.Op, right.Val))
+	}
+	if ok1 && !ok2 {
+		return &Compare{Left: c.Right, Op: c.Op.reverse(), Right: c.Left}
+	}
+	lcol, ok1 := c.Left.(ColumnRef)
+	rcol, ok2 := c.Right.(ColumnRef)
+	if ok1 && ok2 && lcol == rcol && types.noNaN(lcol) {
+		switch c.Op {
+		case OpEquals, OpLessThanOrEq, OpGreaterThanOrEq:
+			return BoolConst(true)
+		case OpNotEquals, OpLessThan, OpGreaterThan:
+			return BoolConst(false)
+		}
+	}
+	return c
+}
+
+// columnTypes the types of the columns of a plan
+type columnTypes map[ColumnRef]*Type
+
+// planColumnTypes the types of plan.Columns(), empty if the TupleDesc of plan is unknown
+func planColumnTypes(plan LogicalPlan) columnTypes {
+	ret := columnTypes{}
+	cols, td := plan.Columns(), plan.TupleDesc()
+	if td == nil || len(td.TdItems) != len(cols) {
+		return ret
+	}
+	for i, col := range cols {
+		ret[col] = td.TdItems[i].Type
+	}
+	return ret
+}
+
+// noNaN whether the scalar is never NaN, false for the column of unknown type
+func (types columnTypes) noNaN(s Scalar) bool {
+	switch s := s.(type) {
+	case ConstExpr:
+		f, ok := s.Val.(*FloatField)
+		return !ok || !math.IsNaN(f.Val)
+	case ColumnRef:
+		t, ok := types[s]
+		return ok && t.Name != FloatType.Name
+	}
+	return false
+}
+
+func eliminateFilters(plan LogicalPlan) LogicalPlan {
+	return transformUp(plan, func(plan LogicalPlan) LogicalPlan {
+		for _, child := range plan.Children() {
+			if _, ok := child.(*LogicalEmpty); ok {
+				return emptyOf(plan)
+			}
+		}
+		switch p := plan.(type) {
+		case *LogicalFilter:
+			if b, ok := p.Cond.(BoolConst); ok {
+				if b {
+					return p.Child
+				}
+				return emptyOf(p)
+			}
+		case *LogicalJoin:
+			if b, ok := p.Cond.(BoolConst); ok {
+				if b {
+					return &LogicalJoin{Left: p.Left, Right: p.Right}
+				}
+				return emptyOf(p)
+			}
+		}
+		return plan
+	})
+}
+
+func pushDownPredicates(plan LogicalPlan) LogicalPlan {
+	return pushDown(plan, nil)
+}
+
+// pushDown push the conds into plan, the conds are over the columns of plan
+func pushDown(plan LogicalPlan, conds []Cond) LogicalPlan {
+	switch p := plan.(type) {
+	case *LogicalFilter:
+		return pushDown(p.Child, append(conds, conjuncts(p.Cond)...))
+	case *LogicalProject:
+		return &LogicalProject{Cols: p.Cols, Child: pushDown(p.Child, conds)}
+	case *LogicalJoin:
+		left, right := p.Left.Columns(), p.Right.Columns()
+		var leftConds, rightConds, joinConds []Cond
+		for _, cond := range append(conds, conjuncts(p.Cond)...) {
+			switch {
+			case coversColumns(left, cond):
+				leftConds = append(leftConds, cond)
+			case coversColumns(right, cond):
+				rightConds = append(rightConds, cond)
+			default:
+				joinConds = append(joinConds, cond)
+			}
+		}
+		return &LogicalJoin{Left: pushDown(p.Left, leftConds), Right: pushDown(p.Right, rightConds), Cond: conjunction(joinConds)}
+	}
+	if cond := conjunction(conds); cond != nil {
+		return &LogicalFilter{Cond: cond, Child: plan}
+	}
+	return plan
+}
+
+// coversColumns all columns of cond are in columns
+func coversColumns(columns []ColumnRef, cond Cond) bool {
+	for _, col := range cond.columns() {
+		if columnIndex(columns, col) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func pruneColumns(plan LogicalPlan) LogicalPlan {
+	return prune(plan, plan.Columns())
+}
+
+// prune only keep the required columns in plan, the output of plan could have more columns
+func prune(plan LogicalPlan, required []ColumnRef) LogicalPlan {
+	switch p := plan.(type) {
+	case *LogicalScan:
+		var fields []int
+		for _, f := range p.fields() {
+			if columnIndex(required, ColumnRef{Table: p.Alias, Name: p.td.TdItems[f].Name}) >= 0 {
+				fields = append(fields, f)
+			}
+		}
+		if len(fields) == 0 {
+			// keep one field, the num of tuples is still needed
+			fields = p.fields()[:1]
+		}
+		if len(fields) == len(p.td.TdItems) {
+			fields = nil
+		}
+		return &LogicalScan{TableID: p.TableID, Alias: p.Alias, Fields: fields, td: p.td}
+	case *LogicalFilter:
+		return &LogicalFilter{Cond: p.Cond, Child: prune(p.Child, append(required, p.Cond.columns()...))}
+	case *LogicalProject:
+		var cols []ColumnRef
+		for _, col := range p.Cols {
+			if columnIndex(required, col) >= 0 {
+				cols = append(cols, col)
+			}
+		}
+		return &LogicalProject{Cols: cols, Child: prune(p.Child, cols)}
+	case *LogicalJoin:
+		if p.Cond != nil {
+			required = append(required, p.Cond.columns()...)
+		}
+		return &LogicalJoin{Left: prune(p.Left, required), Right: prune(p.Right, required), Cond: p.Cond}
+	case *LogicalEmpty:
+		ret := &LogicalEmpty{TD: &TupleDesc{}}
+		for i, col := range p.Cols {
+			if columnIndex(required, col) >= 0 {
+				ret.Cols = append(ret.Cols, col)
+				ret.TD.TdItems = append(ret.TD.TdItems, p.TD.TdItems[i])
+			}
+		}
+		return ret
+	}
+	return plan
+}
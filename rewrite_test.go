@@ -0,0 +1,137 @@
+package newdb
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rewriteScan the LogicalScan of a new table with fields (id, v, pad)
+func rewriteScan(t *testing.T, alias string) *LogicalScan {
+	tableID, err := RandTable([]string{"int", "int", "int"}, []string{"id", "v", "pad"})
+	require.NoError(t, err)
+	scan, err := NewLogicalScan(tableID, alias)
+	require.NoError(t, err)
+	return scan
+}
+
+func col(table, name string) ColumnRef {
+	return ColumnRef{Table: table, Name: name}
+}
+
+func intConst(v int64) ConstExpr {
+	return ConstExpr{Val: NewIntField(v)}
+}
+
+func TestFoldCond(t *testing.T) {
+	types := columnTypes{col("a", "id"): IntType, col("a", "v"): IntType}
+	for _, tc := range []struct {
+		cond Cond
+		want string
+	}{
+		{&Compare{intConst(1), OpLessThan, intConst(2)}, "TRUE"},
+		{&Compare{intConst(1), OpEquals, intConst(2)}, "FALSE"},
+		{&Compare{intConst(1), OpLessThan, col("a", "id")}, "a.id > int(1)"},
+		{&Compare{col("a", "id"), OpEquals, col("a", "id")}, "TRUE"},
+		{And{BoolConst(true), &Compare{col("a", "id"), OpEquals, intConst(3)}}, "a.id = int(3)"},
+		{And{&Compare{col("a", "id"), OpEquals, intConst(3)}, &Compare{intConst(1), OpGreaterThan, intConst(2)}}, "FALSE"},
+		{And{And{BoolConst(true), &Compare{col("a", "id"), OpEquals, intConst(3)}}, &Compare{col("a", "v"), OpEquals, intConst(4)}}, "(a.id = int(3) AND a.v = int(4))"},
+		{Or{&Compare{col("a", "id"), OpEquals, intConst(3)}, &Compare{intConst(1), OpLessThan, intConst(2)}}, "TRUE"},
+		{Or{BoolConst(false), &Compare{col("a", "id"), OpEquals, intConst(3)}}, "a.id = int(3)"},
+		{Or{}, "FALSE"},
+		{&Not{Cond: &Compare{col("a", "id"), OpLessThan, intConst(3)}}, "a.id >= int(3)"},
+		{&Not{Cond: &Not{Cond: &Compare{col("a", "id"), OpLike, intConst(3)}}}, "a.id LIKE int(3)"},
+		{&Not{Cond: BoolConst(false)}, "TRUE"},
+		{&Compare{intConst(1), OpEquals, ConstExpr{Val: NewFloatField(1)}}, "int(1) = float(1)"},
+		{&Compare{col("b", "id"), OpEquals, col("b", "id")}, "b.id = b.id"},
+	} {
+		assert.Equal(t, tc.want, foldCond(tc.cond, types).String(), tc.cond.String())
+	}
+}
+
+func TestFoldCond_NaN(t *testing.T) {
+	types := columnTypes{col("a", "f"): FloatType}
+	nan := ConstExpr{Val: NewFloatField(math.NaN())}
+	for _, tc := range []struct {
+		cond Cond
+		want string
+	}{
+		{&Compare{col("a", "f"), OpEquals, col("a", "f")}, "a.f = a.f"},
+		{&Compare{col("a", "f"), OpNotEquals, col("a", "f")}, "a.f != a.f"},
+		{&Not{Cond: &Compare{col("a", "f"), OpLessThan, ConstExpr{Val: NewFloatField(1)}}}, "NOT a.f < float(1)"},
+		{&Not{Cond: &Compare{nan, OpLessThan, ConstExpr{Val: NewFloatField(1)}}}, "TRUE"},
+	} {
+		assert.Equal(t, tc.want, foldCond(tc.cond, types).String(), tc.cond.String())
+	}
+
+	tableID, err := RandTable([]string{"float"}, []string{"f"})
+	require.NoError(t, err)
+	scan, err := NewLogicalScan(tableID, "a")
+	require.NoError(t, err)
+	plan := &LogicalFilter{Cond: &Not{Cond: &Compare{col("a", "f"), OpLessThan, ConstExpr{Val: NewFloatField(1)}}}, Child: scan}
+	assert.Equal(t, "Filter(NOT a.f < float(1))\n"+
+		"-> Scan("+tableID+" AS a)\n", FormatPlan(Rewrite(plan)))
+}
+
+func TestRewrite_PushDownAndPrune(t *testing.T) {
+	a, b := rewriteScan(t, "a"), rewriteScan(t, "b")
+	plan := &LogicalProject{
+		Cols: []ColumnRef{col("a", "id"), col("b", "v")},
+		Child: &LogicalFilter{
+			Cond: And{
+				&Compare{col("a", "id"), OpEquals, col("b", "id")},
+				&Compare{intConst(3), OpEquals, col("a", "v")},
+				&Compare{intConst(1), OpLessThan, intConst(2)},
+				&Compare{col("b", "v"), OpGreaterThan, intConst(5)},
+			},
+			Child: &LogicalJoin{Left: a, Right: b},
+		},
+	}
+	rewritten := Rewrite(plan)
+	assert.Equal(t, "Project(a.id, b.v)\n"+
+		"-> Join(a.id = b.id)\n"+
+		"  -> Filter(a.v = int(3))\n"+
+		"    -> Scan("+a.TableID+" AS a fields=[0 1])\n"+
+		"  -> Filter(b.v > int(5))\n"+
+		"    -> Scan("+b.TableID+" AS b fields=[0 1])\n", FormatPlan(rewritten))
+	assert.Equal(t, plan.Columns(), rewritten.Columns())
+	assert.Equal(t, FormatPlan(rewritten), FormatPlan(Rewrite(rewritten)), "rewrite is idempotent")
+	assert.Nil(t, a.Fields, "the plan is not modified")
+
+	// the join conditions are pushed too
+	join := &LogicalJoin{Left: a, Right: b, Cond: And{
+		&Compare{col("a", "id"), OpEquals, col("b", "id")},
+		&Compare{col("b", "pad"), OpNotEquals, intConst(0)},
+	}}
+	assert.Equal(t, "Join(a.id = b.id)\n"+
+		"-> Scan("+a.TableID+" AS a)\n"+
+		"-> Filter(b.pad != int(0))\n"+
+		"  -> Scan("+b.TableID+" AS b)\n", FormatPlan(RewriteWith(join, RulePushDownPredicates)))
+}
+
+func TestRewrite_EliminateFilters(t *testing.T) {
+	a, b := rewriteScan(t, "a"), rewriteScan(t, "b")
+	always := &LogicalFilter{Cond: Or{&Compare{col("a", "id"), OpEquals, intConst(1)}, BoolConst(true)}, Child: a}
+	assert.Equal(t, a, Rewrite(always))
+
+	never := &LogicalProject{
+		Cols: []ColumnRef{col("a", "id"), col("b", "id")},
+		Child: &LogicalJoin{
+			Left:  &LogicalFilter{Cond: &Compare{intConst(1), OpGreaterThan, intConst(2)}, Child: a},
+			Right: b,
+			Cond:  &Compare{col("a", "id"), OpEquals, col("b", "id")},
+		},
+	}
+	rewritten := Rewrite(never)
+	require.IsType(t, &LogicalEmpty{}, rewritten)
+	assert.Equal(t, never.Columns(), rewritten.Columns())
+	assert.Equal(t, "id(int64(8)),id(int64(8))", rewritten.TupleDesc().String())
+
+	it, err := BuildPlan(NewTxID(), rewritten)
+	require.NoError(t, err)
+	require.NoError(t, it.Open(context.Background()))
+	assert.False(t, it.HasNext())
+}
@@ -0,0 +1,182 @@
+package newdb
+
+import "fmt"
+
+// savepoint the state of Tx when Tx.Savepoint is called
+type savepoint struct {
+	name string
+	// images the before-images of the pages dirty by the transaction, by PageID.ID()
+	images map[string][]byte
+	mark   *mvccMark
+}
+
+// mvccMark the position in the undo log of the MVCC transaction
+type mvccMark struct {
+	undo    int
+	pending int
+	writes  map[string]uint64
+	written map[string]int
+}
+
+// Savepoint mark the current state of tx, the later changes can be undone by RollbackTo.
+// a savepoint with the same name hides the earlier one until it is released
+func (tx *Tx) Savepoint(name string) error {
+	images, err := DB.B().pageImages(tx.TxID)
+	if err != nil {
+		return err
+	}
+	tx.savepoints = append(tx.savepoints, &savepoint{name: name, images: images, mark: DB.T().mark(tx.TxID)})
+	txL.Debug("savepoint", "tx_id", tx.TxID.ID, "name", name, "pages", len(images))
+	return nil
+}
+
+// findSavepoint the index of the latest savepoint of name
+func (tx *Tx) findSavepoint(name string) (int, error) {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("savepoint %v does not exist", name)
+}
+
+// RollbackTo undo the changes of tx after the savepoint, the savepoints after it are released,
+// and itself is kept, so it can be rolled back to again
+func (tx *Tx) RollbackTo(name string) error {
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	sp := tx.savepoints[i]
+	if err = DB.T().rollbackTo(tx.TxID, sp.mark); err != nil {
+		return err
+	}
+	if err = DB.B().restorePages(tx.TxID, sp.images); err != nil {
+		return err
+	}
+	tx.savepoints = tx.savepoints[:i+1]
+	txL.Info("rollback to savepoint", "tx_id", tx.TxID.ID, "name", name)
+	return nil
+}
+
+// Release forget the savepoint and the savepoints after it, the changes are kept
+func (tx *Tx) Release(name string) error {
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	tx.savepoints = tx.savepoints[:i]
+	return nil
+}
+
+// pageImages the before-images of the pages dirty by txID, the pages of MVCC tables are undone by TxManager
+func (bp *BufferPool) pageImages(txID *TxID) (map[string][]byte, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	ret := make(map[string][]byte)
+	for key, page := range bp.PageID2Page {
+		if hp, ok := page.(*HeapPage); ok && hp.MVCC {
+			continue
+		}
+		if dirty := page.IsDirty(); dirty == nil || dirty.ID != txID.ID {
+			continue
+		}
+		image, err := page.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		ret[key] = image
+	}
+	return ret, nil
+}
+
+// restorePages restore the pages dirty by txID to the images, the pages not in images were clean,
+// they are discarded and read from disk next time. the restored pages are free in FreeSpaceMap,
+// the full ones are cleared by the next insert
+func (bp *BufferPool) restorePages(txID *TxID, images map[string][]byte) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for key, page := range bp.PageID2Page {
+		hp, ok := page.(*HeapPage)
+		if !ok || hp.MVCC {
+			continue
+		}
+		if dirty := page.IsDirty(); dirty == nil || dirty.ID != txID.ID {
+			continue
+		}
+		if image, ok := images[key]; ok {
+			restored, err := NewHeapPage(hp.PID, image)
+			if err != nil {
+				return err
+			}
+			restored.MarkDirty(txID)
+			bp.PageID2Page[key] = restored
+		} else {
+			delete(bp.PageID2Page, key)
+		}
+		hf, ok := DB.C().GetTableByID(hp.PID.TableID()).(*HeapFile)
+		if !ok {
+			continue
+		}
+		fsm, err := hf.FreeSpaceMap()
+		if err != nil {
+			return err
+		}
+		if err = fsm.Set(hp.PID.PageNum(), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mark the position of txID in its undo log, nil if txID did not begin
+func (tm *TxManager) mark(txID *TxID) *mvccMark {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	st, ok := tm.txs[txID.ID]
+	if !ok || st.status != txActive {
+		return nil
+	}
+	ret := &mvccMark{
+		undo:    len(st.undo),
+		pending: len(st.pending),
+		writes:  make(map[string]uint64, len(st.writes)),
+		written: make(map[string]int, len(st.written)),
+	}
+	for key, seq := range st.writes {
+		ret.writes[key] = seq
+	}
+	for table, versions := range st.written {
+		ret.written[table] = len(versions)
+	}
+	return ret
+}
+
+// rollbackTo undo the changes of txID after the mark, the predicate locks are kept
+func (tm *TxManager) rollbackTo(txID *TxID, mark *mvccMark) error {
+	tm.latch.Lock()
+	defer tm.latch.Unlock()
+	tm.mu.Lock()
+	st, ok := tm.txs[txID.ID]
+	if !ok || st.status != txActive {
+		tm.mu.Unlock()
+		return nil
+	}
+	if mark == nil {
+		mark = &mvccMark{}
+	}
+	tail := st.undo[mark.undo:]
+	st.undo = st.undo[:mark.undo]
+	st.pending = st.pending[:mark.pending]
+	// the mark is kept for the next RollbackTo
+	st.writes = make(map[string]uint64, len(mark.writes))
+	for key, seq := range mark.writes {
+		st.writes[key] = seq
+	}
+	for table := range st.written {
+		st.written[table] = st.written[table][:mark.written[table]]
+	}
+	tm.mu.Unlock()
+	// the pages are written at commit or abort
+	return tm.undo(txID, tail)
+}
@@ -0,0 +1,73 @@
+package newdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTx_Savepoint(t *testing.T) {
+	tableID, err := RandDBFile(1)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	ctx := context.Background()
+	insert := func(tx *Tx, i int64) {
+		require.NoError(t, DB.B().InsertTuple(ctx, tx.TxID, tableID, &Tuple{TD: hf.TD, Fields: []Field{NewIntField(i)}}))
+	}
+
+	tx := NewTx()
+	insert(tx, 1)
+	require.NoError(t, tx.Savepoint("a"))
+	insert(tx, 2)
+	require.NoError(t, DB.B().DeleteTuple(ctx, tx.TxID, scanTuples(t, tx.TxID, hf)[0]))
+	assert.Equal(t, []string{"int(2)"}, scanStrings(t, tx.TxID, hf))
+	require.NoError(t, tx.RollbackTo("a"))
+	assert.Equal(t, []string{"int(1)"}, scanStrings(t, tx.TxID, hf))
+
+	insert(tx, 3)
+	require.NoError(t, tx.Savepoint("b"))
+	insert(tx, 4)
+	require.NoError(t, tx.Release("b"))
+	assert.Error(t, tx.RollbackTo("b"), "released")
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, []string{"int(1)", "int(3)", "int(4)"}, scanStrings(t, NewTxID(), hf))
+
+	tx = NewTx()
+	require.NoError(t, tx.Savepoint("clean"))
+	insert(tx, 5)
+	require.NoError(t, tx.RollbackTo("clean"))
+	assert.Equal(t, []string{"int(1)", "int(3)", "int(4)"}, scanStrings(t, tx.TxID, hf), "read from disk")
+	insert(tx, 6)
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, []string{"int(1)", "int(3)", "int(4)", "int(6)"}, scanStrings(t, NewTxID(), hf))
+}
+
+func TestTx_SavepointMVCC(t *testing.T) {
+	hf := mvccTable(t, 1)
+	ctx := context.Background()
+	insert := func(tx *Tx, i int64) {
+		require.NoError(t, DB.B().InsertTuple(ctx, tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(i)}}))
+	}
+
+	tx := NewTx()
+	insert(tx, 2)
+	require.NoError(t, tx.Savepoint("a"))
+	for i := 0; i < 2; i++ {
+		insert(tx, 3)
+		require.NoError(t, DB.B().DeleteTuple(ctx, tx.TxID, scanTuples(t, tx.TxID, hf)[0]))
+		assert.Equal(t, []string{"int(2)", "int(3)"}, scanStrings(t, tx.TxID, hf))
+		require.NoError(t, tx.RollbackTo("a"), "rollback to the same savepoint again")
+		assert.Equal(t, []string{"int(1)", "int(2)"}, scanStrings(t, tx.TxID, hf))
+	}
+
+	other := NewTx()
+	require.NoError(t, DB.B().DeleteTuple(ctx, other.TxID, scanTuples(t, other.TxID, hf)[0]))
+	require.NoError(t, other.Commit())
+	require.NoError(t, tx.Commit(), "the delete of the same tuple is rolled back")
+	assert.Equal(t, []string{"int(2)"}, scanStrings(t, NewTxID(), hf))
+
+	_, err := (&Tx{}).findSavepoint("a")
+	assert.Error(t, err)
+}
@@ -0,0 +1,315 @@
+package newdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	// StatsFileSuffix the stats of a HeapFile is stored in ${HeapFile}${StatsFileSuffix}
+	StatsFileSuffix = ".stats.json"
+	// DefaultHistogramBuckets the num of buckets of IntHistogram
+	DefaultHistogramBuckets = 100
+	// DefaultIOCostPerPage the cost to read one page, the cost of one tuple in CPU is 1
+	DefaultIOCostPerPage = 1000.0
+	// DefaultSelectivity the selectivity if nothing is known about the predicate
+	DefaultSelectivity = 1.0 / 3
+)
+
+// ColumnStats the stats of one column
+type ColumnStats struct {
+	Name string
+	// Type the schema name of the type, see RegisterType
+	Type string
+	// Min Max nil if the table is empty
+	Min Field
+	Max Field
+	// Hist nil if the values of the type could not be int64, see int64Value
+	Hist *IntHistogram
+	// Distinct the sketch of distinct values
+	Distinct *HyperLogLog
+}
+
+type columnStatsJSON struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Min      *string       `json:"min,omitempty"`
+	Max      *string       `json:"max,omitempty"`
+	Hist     *IntHistogram `json:"hist,omitempty"`
+	Distinct *HyperLogLog  `json:"distinct"`
+}
+
+// MarshalJSON min and max are formatted by FormatField
+func (cs ColumnStats) MarshalJSON() ([]byte, error) {
+	ret := columnStatsJSON{Name: cs.Name, Type: cs.Type, Hist: cs.Hist, Distinct: cs.Distinct}
+	for _, f := range []struct {
+		field Field
+		text  **string
+	}{{cs.Min, &ret.Min}, {cs.Max, &ret.Max}} {
+		if f.field == nil {
+			continue
+		}
+		text, err := FormatField(f.field)
+		if err != nil {
+			return nil, err
+		}
+		*f.text = &text
+	}
+	return json.Marshal(ret)
+}
+
+// UnmarshalJSON min and max are parsed by ParseField of the registered type
+func (cs *ColumnStats) UnmarshalJSON(data []byte) error {
+	var raw columnStatsJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	info, ok := LookupType(raw.Type)
+	if !ok {
+		return fmt.Errorf("unknown type %v of column %v", raw.Type, raw.Name)
+	}
+	*cs = ColumnStats{Name: raw.Name, Type: raw.Type, Hist: raw.Hist, Distinct: raw.Distinct}
+	var err error
+	if raw.Min != nil {
+		if cs.Min, err = ParseField(info.Type, *raw.Min); err != nil {
+			return err
+		}
+	}
+	if raw.Max != nil {
+		if cs.Max, err = ParseField(info.Type, *raw.Max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TableStats the stats of one table for cost estimation
+type TableStats struct {
+	TableID string         `json:"table_id"`
+	Rows    int            `json:"rows"`
+	Pages   int            `json:"pages"`
+	Columns []*ColumnStats `json:"columns"`
+	// IOCostPerPage the cost to read one page
+	IOCostPerPage float64   `json:"io_cost_per_page"`
+	Analyzed      time.Time `json:"analyzed"`
+}
+
+// int64Value the int64 of field if the order of its values is the order of int64
+func int64Value(field Field) (int64, bool) {
+	switch f := field.(type) {
+	case *IntField:
+		return f.Val, true
+	case *DateField:
+		return f.Days, true
+	case *TimestampField:
+		return f.Val.UnixNano(), true
+	case *DecimalField:
+		return f.Unscaled, true
+	}
+	return 0, false
+}
+
+// ComputeTableStats scan the table twice, the first time for rows, min, max and distinct values,
+// the second time for the histograms
+func ComputeTableStats(ctx context.Context, txID *TxID, tableID string, ioCostPerPage float64) (*TableStats, error) {
+	dbFile := DB.C().GetTableByID(tableID)
+	if dbFile == nil {
+		return nil, fmt.Errorf("no table %v", tableID)
+	}
+	td := dbFile.TupleDesc()
+	ret := &TableStats{TableID: tableID, IOCostPerPage: ioCostPerPage, Analyzed: time.Now().UTC()}
+	if hf, ok := dbFile.(*HeapFile); ok {
+		ret.Pages = int(hf.NumPagesInFile())
+	}
+	for _, item := range td.TdItems {
+		info, ok := LookupTypeByName(item.Type.Name)
+		if !ok {
+			return nil, fmt.Errorf("type %v of column %v is not registered", item.Type.Name, item.Name)
+		}
+		hll, err := NewHyperLogLog(DefaultHLLPrecision)
+		if err != nil {
+			return nil, err
+		}
+		ret.Columns = append(ret.Columns, &ColumnStats{Name: item.Name, Type: info.SchemaName, Distinct: hll})
+	}
+
+	scan := NewSeqScan(txID, tableID, "stats")
+	if err := scan.Open(ctx); err != nil {
+		return nil, err
+	}
+	defer scan.Close()
+	for scan.HasNext() {
+		tuple := scan.Next()
+		if err := scan.Error(); err != nil {
+			return nil, err
+		}
+		ret.Rows++
+		for i, field := range tuple.Fields {
+			col := ret.Columns[i]
+			if col.Min == nil || field.Compare(OpLessThan, col.Min) {
+				col.Min = field
+			}
+			if col.Max == nil || field.Compare(OpGreaterThan, col.Max) {
+				col.Max = field
+			}
+			if err := col.Distinct.AddField(field); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scan.Error(); err != nil {
+		return nil, err
+	}
+
+	hasHist := false
+	for _, col := range ret.Columns {
+		min, ok1 := int64Value(col.Min)
+		max, ok2 := int64Value(col.Max)
+		if ok1 && ok2 {
+			col.Hist = NewIntHistogram(DefaultHistogramBuckets, min, max)
+			hasHist = true
+		}
+	}
+	if !hasHist {
+		return ret, nil
+	}
+	if err := scan.Rewind(); err != nil {
+		return nil, err
+	}
+	for scan.HasNext() {
+		tuple := scan.Next()
+		if err := scan.Error(); err != nil {
+			return nil, err
+		}
+		for i, field := range tuple.Fields {
+			if hist := ret.Columns[i].Hist; hist != nil {
+				v, _ := int64Value(field)
+				hist.AddValue(v)
+			}
+		}
+	}
+	return ret, scan.Error()
+}
+
+// EstimateSelectivity the estimated fraction of tuples satisfy `tuple.Fields[field] op constant`
+func (ts *TableStats) EstimateSelectivity(field int, op Op, constant Field) float64 {
+	if field < 0 || field >= len(ts.Columns) {
+		return 1
+	}
+	if ts.Rows == 0 {
+		return 0
+	}
+	col := ts.Columns[field]
+	if v, ok := int64Value(constant); ok && col.Hist != nil {
+		return col.Hist.EstimateSelectivity(op, v)
+	}
+	switch op {
+	case OpEquals, OpNotEquals:
+		eq := 0.0
+		if col.Min != nil && (constant.Compare(OpGreaterThanOrEq, col.Min) && constant.Compare(OpLessThanOrEq, col.Max)) {
+			eq = 1 / float64(ts.DistinctCount(field))
+		}
+		if op == OpNotEquals {
+			return 1 - eq
+		}
+		return eq
+	case OpGreaterThan, OpGreaterThanOrEq:
+		if col.Max != nil && constant.Compare(OpGreaterThan, col.Max) {
+			return 0
+		}
+		if col.Min != nil && constant.Compare(OpLessThan, col.Min) {
+			return 1
+		}
+	case OpLessThan, OpLessThanOrEq:
+		if col.Min != nil && constant.Compare(OpLessThan, col.Min) {
+			return 0
+		}
+		if col.Max != nil && constant.Compare(OpGreaterThan, col.Max) {
+			return 1
+		}
+	}
+	return DefaultSelectivity
+}
+
+// DistinctCount the estimated num of distinct values of the field, at least 1, and at most Rows
+func (ts *TableStats) DistinctCount(field int) int {
+	d := int(ts.Columns[field].Distinct.Estimate())
+	if d > ts.Rows {
+		d = ts.Rows
+	}
+	if d < 1 {
+		d = 1
+	}
+	return d
+}
+
+// EstimateScanCost the cost of sequence scan the table, the pages are read one by one
+func (ts *TableStats) EstimateScanCost() float64 {
+	return float64(ts.Pages) * ts.IOCostPerPage
+}
+
+// EstimateTableCardinality the num of tuples if the predicates with selectivity are applied
+func (ts *TableStats) EstimateTableCardinality(selectivity float64) int {
+	return int(float64(ts.Rows)*selectivity + 0.5)
+}
+
+// Analyze compute the stats of table, cache them in catalog, and persist them next to the table file
+func (c *Catalog) Analyze(ctx context.Context, txID *TxID, tableID string) (*TableStats, error) {
+	stats, err := ComputeTableStats(ctx, txID, tableID, DefaultIOCostPerPage)
+	if err != nil {
+		return nil, err
+	}
+	if hf, ok := c.GetTableByID(tableID).(*HeapFile); ok {
+		buf, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err = ioutil.WriteFile(hf.File.Name()+StatsFileSuffix, buf, 0644); err != nil {
+			return nil, err
+		}
+	}
+	c.statsMu.Lock()
+	c.TableID2Stats[tableID] = stats
+	c.statsMu.Unlock()
+	return stats, nil
+}
+
+// GetTableStats the stats of table by Analyze, read from file if not cached, nil if never analyzed
+func (c *Catalog) GetTableStats(tableID string) (*TableStats, error) {
+	c.statsMu.Lock()
+	stats, ok := c.TableID2Stats[tableID]
+	c.statsMu.Unlock()
+	if ok {
+		return stats, nil
+	}
+	hf, ok := c.GetTableByID(tableID).(*HeapFile)
+	if !ok {
+		return nil, nil
+	}
+	buf, err := ioutil.ReadFile(hf.File.Name() + StatsFileSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stats = &TableStats{}
+	if err = json.Unmarshal(buf, stats); err != nil {
+		return nil, fmt.Errorf("read stats of table %v: %v", tableID, err)
+	}
+	if len(stats.Columns) != len(hf.TD.TdItems) {
+		return nil, fmt.Errorf("stats of table %v has %v columns, want %v", tableID, len(stats.Columns), len(hf.TD.TdItems))
+	}
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	// the stats analyzed meanwhile are newer than the file
+	if cached, ok := c.TableID2Stats[tableID]; ok {
+		return cached, nil
+	}
+	c.TableID2Stats[tableID] = stats
+	return stats, nil
+}
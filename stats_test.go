@@ -0,0 +1,125 @@
+package newdb
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeTableStats(t *testing.T) {
+	tableID, err := RandTable([]string{"int", "float", "date"}, []string{"id", "score", "day"})
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	day := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	var tuples []*Tuple
+	for i := 0; i < 1000; i++ {
+		tuples = append(tuples, &Tuple{TD: hf.TD, Fields: []Field{
+			NewIntField(int64(i)), NewFloatField(float64(i % 10)), NewDateField(day.AddDate(0, 0, i%100)),
+		}})
+	}
+	it := NewTupleIterator(hf.TD, tuples)
+	require.NoError(t, it.Open(context.Background()))
+	_, err = hf.BulkLoad(it)
+	require.NoError(t, err)
+
+	stats, err := ComputeTableStats(context.Background(), NewTxID(), tableID, DefaultIOCostPerPage)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, stats.Rows)
+	assert.Equal(t, int(hf.NumPagesInFile()), stats.Pages)
+	assert.Equal(t, float64(stats.Pages)*DefaultIOCostPerPage, stats.EstimateScanCost())
+	assert.Equal(t, NewIntField(0), stats.Columns[0].Min)
+	assert.Equal(t, NewIntField(999), stats.Columns[0].Max)
+	assert.Equal(t, NewFloatField(9), stats.Columns[1].Max)
+	assert.Nil(t, stats.Columns[1].Hist, "float has no histogram")
+	assert.NotNil(t, stats.Columns[2].Hist)
+	assert.InEpsilon(t, 1000, stats.DistinctCount(0), 0.05)
+	assert.Equal(t, 10, stats.DistinctCount(1))
+	assert.InEpsilon(t, 100, stats.DistinctCount(2), 0.05)
+
+	assert.InDelta(t, 0.1, stats.EstimateSelectivity(0, OpLessThan, NewIntField(100)), 0.01)
+	assert.InDelta(t, 0.001, stats.EstimateSelectivity(0, OpEquals, NewIntField(100)), 0.001)
+	assert.InDelta(t, 0.1, stats.EstimateSelectivity(1, OpEquals, NewFloatField(3)), 0.001)
+	assert.Equal(t, 0.0, stats.EstimateSelectivity(1, OpEquals, NewFloatField(30)))
+	assert.Equal(t, 0.0, stats.EstimateSelectivity(1, OpGreaterThan, NewFloatField(30)))
+	assert.Equal(t, DefaultSelectivity, stats.EstimateSelectivity(1, OpGreaterThan, NewFloatField(3)))
+	assert.InDelta(t, 0.5, stats.EstimateSelectivity(2, OpGreaterThanOrEq, NewDateField(day.AddDate(0, 0, 50))), 0.02)
+	assert.Equal(t, 1.0, stats.EstimateSelectivity(5, OpEquals, NewIntField(1)), "no such field")
+	assert.Equal(t, 100, stats.EstimateTableCardinality(0.1))
+}
+
+func TestCatalog_Analyze(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	stats, err := DB.C().GetTableStats(tableID)
+	require.NoError(t, err)
+	assert.Nil(t, stats, "never analyzed")
+
+	scan := NewMockScan(0, 100, 2)
+	require.NoError(t, scan.Open(context.Background()))
+	_, err = hf.BulkLoad(scan)
+	require.NoError(t, err)
+	stats, err = DB.C().Analyze(context.Background(), NewTxID(), tableID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, stats.Rows)
+	_, err = os.Stat(hf.File.Name() + StatsFileSuffix)
+	require.NoError(t, err)
+
+	// read from file
+	delete(DB.C().TableID2Stats, tableID)
+	loaded, err := DB.C().GetTableStats(tableID)
+	require.NoError(t, err)
+	assert.Equal(t, stats.Rows, loaded.Rows)
+	assert.Equal(t, stats.Columns[0].Min, loaded.Columns[0].Min)
+	assert.Equal(t, stats.Columns[1].Hist, loaded.Columns[1].Hist)
+	assert.Equal(t, stats.Columns[1].Distinct, loaded.Columns[1].Distinct)
+	assert.Equal(t, stats.EstimateSelectivity(0, OpGreaterThan, NewIntField(10)), loaded.EstimateSelectivity(0, OpGreaterThan, NewIntField(10)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = DB.C().Analyze(ctx, NewTxID(), tableID)
+	assert.Equal(t, context.Canceled, err)
+
+	emptyID, err := RandDBFile(1)
+	require.NoError(t, err)
+	empty, err := DB.C().Analyze(context.Background(), NewTxID(), emptyID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, empty.Rows)
+	assert.Nil(t, empty.Columns[0].Min)
+	assert.Equal(t, 0.0, empty.EstimateSelectivity(0, OpEquals, NewIntField(1)))
+}
+
+func TestCatalog_AnalyzeConcurrently(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	hf := DB.C().GetTableByID(tableID).(*HeapFile)
+	scan := NewMockScan(0, 100, 2)
+	require.NoError(t, scan.Open(context.Background()))
+	_, err = hf.BulkLoad(scan)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := DB.C().Analyze(context.Background(), NewTxID(), tableID)
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			NewSeqScan(NewTxID(), tableID, "t").Explain()
+			_, err := DB.C().GetTableStats(tableID)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	stats, err := DB.C().GetTableStats(tableID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, stats.Rows)
+}
@@ -1,6 +1,7 @@
 package newdb
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -14,19 +15,19 @@ import (
 
 var (
 	singleFieldTableID = "20ccb2e256cc729496851f0c3f4f597324cb20b9"
-	testLog            = log.WithField("name", "test")
+	testLog            = newSubsystemLogger("test")
 )
 
 func init() {
 	tmpfile := "data/a.db"
 	_, err := os.Create(tmpfile)
 	if err != nil {
-		log.WithError(err).WithField("name", "page_test_init").Errorf("create file %v", tmpfile)
+		testLog.Error("create file", "error", err, "file", tmpfile)
 	}
 	var schema = strings.NewReader(fmt.Sprintf("[{\"filename\":\"%v\",\"td\":[{\"name\":\"name1\",\"type\":\"int\"}]}]", tmpfile))
 	_, err = DB.C().LoadSchema(schema)
 	if err != nil {
-		testLog.WithError(err).Error("init test utils, LoadSchema return err")
+		testLog.Error("init test utils, LoadSchema return err", "error", err)
 		panic("has err with loadSchema")
 	}
 	testLog.Info("init test database")
@@ -56,7 +57,8 @@ func GeneratePageBytes(tupleNum int) ([]byte, error) {
 	for i := 0; i < tupleNum; i++ {
 		bs.SetBool(uint(i), true)
 	}
-	var n = copy(emptyPage, []byte(bs))
+	var n = PageReservedSize
+	n += copy(emptyPage[n:], []byte(bs))
 	for i := 0; i < tupleNum; i++ {
 		tp := &Tuple{TD: page.TupleDesc(), Fields: []Field{NewIntField(int64(i))}}
 		tpBuf, err := tp.MarshalBinary()
@@ -71,7 +73,7 @@ func GeneratePageBytes(tupleNum int) ([]byte, error) {
 func Test_GeneratePageBytes(t *testing.T) {
 	buf, err := GeneratePageBytes(4)
 	assert.NoError(t, err)
-	assert.Equal(t, byte(0xf), buf[0])
+	assert.Equal(t, byte(0xf), buf[PageReservedSize])
 	page, err := NewHeapPage(NewHeapPageID(singleFieldTableID, 1), buf)
 	assert.NoError(t, err)
 	for i, tuple := range page.Tuples[:4] {
@@ -81,15 +83,35 @@ func Test_GeneratePageBytes(t *testing.T) {
 	assert.Nil(t, page.Tuples[4], "only generate 4 tuple, but != 4")
 }
 
-func RandDBFile(fieldNum int) (ret string, err error) {
+// TmpDataFile create an empty file in data dir
+func TmpDataFile() (string, error) {
 	tmpfile := fmt.Sprintf("data/tmp-%v.data", RandString(10))
-	_, err = os.Create(tmpfile)
+	f, err := os.Create(tmpfile)
 	if err != nil {
-		log.WithError(err).WithField("name", "page_test_init").Errorf("create file %v", tmpfile)
+		testLog.Error("create file", "error", err, "file", tmpfile)
+		return "", err
 	}
-	var fields []string
+	return tmpfile, f.Close()
+}
+
+func RandDBFile(fieldNum int) (ret string, err error) {
+	var types []string
 	for i := 0; i < fieldNum; i++ {
-		fields = append(fields, fmt.Sprintf("{\"name\":\"f%v\",\"type\":\"int\"}", i))
+		types = append(types, "int")
+	}
+	return RandTable(types, GetStrings(fieldNum, "f"))
+}
+
+// RandTable create a table with the schema type names and field names in a new file,
+// the schema json is written to ${file}.schema.json
+func RandTable(typeNames []string, names []string) (ret string, err error) {
+	tmpfile, err := TmpDataFile()
+	if err != nil {
+		return "", err
+	}
+	var fields []string
+	for i := range typeNames {
+		fields = append(fields, fmt.Sprintf("{\"name\":\"%v\",\"type\":\"%v\"}", names[i], typeNames[i]))
 	}
 	var schemaString = fmt.Sprintf("[{\"filename\":\"%v\",\"td\":[%v]}]", tmpfile, strings.Join(fields, ","))
 	err = ioutil.WriteFile(tmpfile+".schema.json", []byte(schemaString), 0644)
@@ -99,7 +121,7 @@ func RandDBFile(fieldNum int) (ret string, err error) {
 	var schema = strings.NewReader(schemaString)
 	tableIDS, err := DB.C().LoadSchema(schema)
 	if err != nil {
-		testLog.WithError(err).Error("init test utils, LoadSchema return err")
+		testLog.Error("init test utils, LoadSchema return err", "error", err)
 		panic("has err with loadSchema")
 	}
 	ret = tableIDS[0]
@@ -153,6 +175,8 @@ var _ OpIterator = (*MockScan)(nil)
 type MockScan struct {
 	Cur, Low, High, Width int
 	Err                   error
+
+	ctx context.Context
 }
 
 func NewMockScan(low, high, width int) *MockScan {
@@ -166,7 +190,8 @@ func NewMockScan(low, high, width int) *MockScan {
 func (m MockScan) Error() error {
 	return m.Err
 }
-func (m *MockScan) Open() error {
+func (m *MockScan) Open(ctx context.Context) error {
+	m.ctx = ctx
 	m.Cur = m.Low
 	return nil
 }
@@ -174,6 +199,9 @@ func (m *MockScan) Open() error {
 func (m *MockScan) Close() {}
 
 func (m *MockScan) HasNext() bool {
+	if m.Err = m.ctx.Err(); m.Err != nil {
+		return false
+	}
 	return m.Cur < m.High
 }
 
@@ -194,16 +222,20 @@ func (m *MockScan) Next() *Tuple {
 
 func (m *MockScan) Rewind() error {
 	m.Close()
-	return m.Open()
+	return m.Open(m.ctx)
 }
 
 func (m *MockScan) TupleDesc() *TupleDesc {
 	return GetTupleDesc(m.Width, "scan")
 }
 
+func (m *MockScan) Explain() *PlanNode {
+	return &PlanNode{Operator: "MockScan", Rows: m.High - m.Low, Cost: cpuCost(m.High - m.Low)}
+}
+
 func TestNewMockScan(t *testing.T) {
 	scan := NewMockScan(0, 3, 2)
-	err := scan.Open()
+	err := scan.Open(context.Background())
 	assert.NoError(t, err)
 	for scan.HasNext() {
 		ele := scan.Next()
@@ -211,3 +243,8 @@ func TestNewMockScan(t *testing.T) {
 		assert.NotNil(t, ele)
 	}
 }
+
+// TuplesPerPage the num of tuples in one HeapPage with td
+func TuplesPerPage(td *TupleDesc) int {
+	return HeapPage{TD: td}.NumOfTuples()
+}
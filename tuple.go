@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -28,29 +29,23 @@ func (t Type) String() string {
 	return fmt.Sprintf("%v(%v)", t.Name, t.Len)
 }
 
-// Parse parse the real Field
+// Parse parse the real Field, the Field is created by the registered FieldFactory of t
 func (t Type) Parse(r io.Reader) (Field, error) {
-	var (
-		field Field
-		err   error
-	)
+	info, ok := LookupTypeByName(t.Name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %v", t.Name)
+	}
 	buf := make([]byte, t.Len)
-	_, err = r.Read(buf)
+	_, err := r.Read(buf)
 	if err != nil {
 		return nil, err
 	}
-	switch t.Name {
-	case "string":
-		panic("unsupported type")
-	case "int64":
-		i := &IntField{TypeReal: IntType}
-		err = i.UnmarshalBinary(buf)
-		if err != nil {
-			return nil, err
-		}
-		field = i
+	field := info.New(info.Type)
+	err = field.UnmarshalBinary(buf)
+	if err != nil {
+		return nil, err
 	}
-	return field, err
+	return field, nil
 }
 
 // Field identify one filed like int 1
@@ -126,14 +121,31 @@ func (i *IntField) UnmarshalBinary(data []byte) error {
 	return binary.Read(reader, DefaultOrder, &i.Val)
 }
 
+// MarshalText implement encoding.TextMarshaler
+func (i IntField) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(i.Val, 10)), nil
+}
+
+// UnmarshalText implement encoding.TextUnmarshaler
+func (i *IntField) UnmarshalText(text []byte) (err error) {
+	i.Val, err = strconv.ParseInt(strings.TrimSpace(string(text)), 10, 64)
+	return
+}
+
 // TdItem tuple desc item
 type TdItem struct {
 	Type *Type
 	Name string
 }
 
+// String the field name and the type registered by the name of Type,
+// the type not registered is named by itself
 func (ti TdItem) String() string {
-	return fmt.Sprintf("%v(%v)", ti.Name, ti.Type.String())
+	t := ti.Type
+	if info, ok := LookupTypeByName(t.Name); ok {
+		t = info.Type
+	}
+	return fmt.Sprintf("%v(%v)", ti.Name, t.String())
 }
 
 // TupleDesc the tuple descrition
@@ -164,6 +176,19 @@ func (td TupleDesc) Equal(target *TupleDesc) (ret bool) {
 	return td.String() != "" && td.String() == target.String()
 }
 
+// EqualTypes 2 tuple desc have the same field types, the names are ignored
+func (td TupleDesc) EqualTypes(target *TupleDesc) bool {
+	if target == nil || len(td.TdItems) != len(target.TdItems) {
+		return false
+	}
+	for i, item := range td.TdItems {
+		if item.Type.Name != target.TdItems[i].Type.Name || item.Type.Len != target.TdItems[i].Type.Len {
+			return false
+		}
+	}
+	return true
+}
+
 // Size get size of fields
 func (td TupleDesc) Size() int {
 	var ret uintptr
@@ -181,6 +206,9 @@ type Tuple struct {
 	Fields   []Field
 	TD       *TupleDesc
 	RecordID *RecordID
+	// Xmin Xmax the TxID created and deleted the version in MVCC table, 0 if none, see TxManager
+	Xmin uint64
+	Xmax uint64
 }
 
 func (tp Tuple) String() string {
@@ -204,6 +232,17 @@ func (tp Tuple) MarshalBinary() (data []byte, err error) {
 	return data, err
 }
 
+// TupleVersionSize the size of the version header of tuple in MVCC table: | xmin 8B | xmax 8B |
+const TupleVersionSize = 16
+
+// marshalVersion the version header
+func (tp Tuple) marshalVersion() []byte {
+	buf := make([]byte, TupleVersionSize)
+	DefaultOrder.PutUint64(buf, tp.Xmin)
+	DefaultOrder.PutUint64(buf[8:], tp.Xmax)
+	return buf
+}
+
 // RecordID record id: PageID + TupleNum
 type RecordID struct {
 	PID      PageID
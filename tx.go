@@ -1,10 +1,15 @@
 package newdb
 
-import "sync/atomic"
+import (
+	"context"
+	"sync/atomic"
+)
 
 var (
+	// atomicTxID the last TxID, raised to the TxID high-water mark of every MVCC table opened,
+	// so the TxIDs in the tables of the earlier runs are smaller, see HeapFileHeader.TxID
 	atomicTxID uint64
-	txL        = log.WithField("name", "tx")
+	txL        = newSubsystemLogger(LogTx)
 )
 
 // TxID transaction id
@@ -17,24 +22,132 @@ func NewTxID() *TxID {
 	ret := &TxID{
 		ID: atomic.AddUint64(&atomicTxID, 1),
 	}
-	txL.WithField("tx_id", ret).Infof("start tx")
+	if txL.Enabled(LevelDebug) {
+		txL.Debug("start tx", "tx_id", ret.ID)
+	}
 	return ret
 }
 
-// Tx transaction
+// advanceTxID the next TxIDs are greater than id
+func advanceTxID(id uint64) {
+	for {
+		cur := atomic.LoadUint64(&atomicTxID)
+		if cur >= id || atomic.CompareAndSwapUint64(&atomicTxID, cur, id) {
+			return
+		}
+	}
+}
+
+// abortIfDone abort the transaction if ctx is canceled or its deadline is exceeded
+func abortIfDone(ctx context.Context, txID *TxID) {
+	if ctx.Err() == nil {
+		return
+	}
+	if err := DB.B().TransactionComplete(txID, false); err != nil {
+		txL.Error("abort tx", "error", err, "tx_id", txID.ID)
+	}
+}
+
+// IsolationLevel the isolation level of transaction, only the MVCC tables are isolated,
+// there is no lock manager, the other tables are always read uncommitted, see NewTxWithOptions
+type IsolationLevel int
+
+const (
+	// ReadUncommitted read the latest versions, include the uncommitted ones
+	ReadUncommitted IsolationLevel = iota
+	// ReadCommitted every statement reads a new snapshot
+	ReadCommitted
+	// RepeatableRead all statements read the snapshot taken by NewTx, the phantoms are prevented too
+	RepeatableRead
+	// Serializable RepeatableRead, and the commit fails by ErrSerializationFailure if a transaction
+	// committed after the snapshot inserted or deleted the tuples matched by the scans, the scan under
+	// Filters only locks the tuples matched by their predicates, so the phantoms are detected
+	Serializable
+)
+
+// DefaultIsolationLevel the isolation level of NewTx, and the transactions not started by NewTx
+const DefaultIsolationLevel = RepeatableRead
+
+func (l IsolationLevel) String() (ret string) {
+	switch l {
+	case ReadUncommitted:
+		ret = "READ UNCOMMITTED"
+	case ReadCommitted:
+		ret = "READ COMMITTED"
+	case RepeatableRead:
+		ret = "REPEATABLE READ"
+	case Serializable:
+		ret = "SERIALIZABLE"
+	default:
+		ret = "UNSUPPORTED"
+	}
+	return
+}
+
+// TxOptions the options of Tx
+type TxOptions struct {
+	Isolation IsolationLevel
+}
+
+// DefaultTxOptions the default TxOptions
+func DefaultTxOptions() *TxOptions {
+	return &TxOptions{Isolation: DefaultIsolationLevel}
+}
+
+// Tx transaction, the MVCC tables are read with the Snapshot taken by NewTx
 type Tx struct {
-	TxID *TxID
+	TxID      *TxID
+	Isolation IsolationLevel
+	Snapshot  Snapshot
+
+	savepoints []*savepoint
 }
 
-// NewTx new Tx with NewTxID
+// NewTx new Tx with DefaultTxOptions, the isolation level only isolates the MVCC tables,
+// the other tables are read uncommitted: the uncommitted writes of other transactions are read,
+// and the commit never fails for their reads
 func NewTx() *Tx {
+	txID := NewTxID()
 	return &Tx{
-		TxID: NewTxID(),
+		TxID:      txID,
+		Isolation: DefaultIsolationLevel,
+		Snapshot:  DB.T().BeginWith(txID, DefaultIsolationLevel),
 	}
 }
 
-// Finish clean Tx
-func (tx *Tx) Finish() {}
+// NewTxWithOptions new Tx with NewTxID and opts.
+// the tables not MVCC can not be isolated, so the read or write of them fails by ErrIsolationNotSupported
+// if opts.Isolation is above ReadUncommitted
+func NewTxWithOptions(opts *TxOptions) *Tx {
+	txID := NewTxID()
+	return &Tx{
+		TxID:      txID,
+		Isolation: opts.Isolation,
+		Snapshot:  DB.T().beginStrict(txID, opts.Isolation),
+	}
+}
+
+// Commit commit the transaction, ErrWriteConflict or ErrSerializationFailure if it is aborted
+// by a concurrent transaction
+func (tx *Tx) Commit() error {
+	tx.savepoints = nil
+	return DB.B().TransactionComplete(tx.TxID, true)
+}
+
+// Abort abort the transaction
+func (tx *Tx) Abort() error {
+	tx.savepoints = nil
+	return DB.B().TransactionComplete(tx.TxID, false)
+}
+
+// Finish clean Tx, abort it if not committed
+func (tx *Tx) Finish() {
+	if DB.T().active(tx.TxID) {
+		if err := tx.Abort(); err != nil {
+			txL.Error("abort tx", "error", err, "tx_id", tx.TxID.ID)
+		}
+	}
+}
 
 // Permission perm
 type Permission int
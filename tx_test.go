@@ -1,9 +1,11 @@
 package newdb
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewTxID(t *testing.T) {
@@ -26,7 +28,10 @@ func TestNewTx(t *testing.T) {
 	// TODO: how to test NewTx
 	tx1 := NewTx()
 	tx2 := NewTx()
+	defer tx1.Finish()
+	defer tx2.Finish()
 	assert.NotEqual(t, tx1, tx2)
+	assert.Equal(t, tx1.Snapshot, DB.T().Begin(tx1.TxID))
 }
 
 func TestPermission_String(t *testing.T) {
@@ -43,3 +48,128 @@ func TestPermission_String(t *testing.T) {
 		assert.Equal(t, test.V, int(test.P))
 	}
 }
+
+func TestIsolationLevel_String(t *testing.T) {
+	assert.Equal(t, "READ UNCOMMITTED", ReadUncommitted.String())
+	assert.Equal(t, "READ COMMITTED", ReadCommitted.String())
+	assert.Equal(t, "REPEATABLE READ", RepeatableRead.String())
+	assert.Equal(t, "SERIALIZABLE", Serializable.String())
+	assert.Equal(t, "UNSUPPORTED", IsolationLevel(9).String())
+	tx := NewTx()
+	defer tx.Finish()
+	assert.Equal(t, DefaultIsolationLevel, tx.Isolation)
+}
+
+// TestIsolationLevel_Anomalies the anomalies allowed by every isolation level
+func TestIsolationLevel_Anomalies(t *testing.T) {
+	ctx := context.Background()
+	insert := func(t *testing.T, tx *Tx, hf *HeapFile, i int64) {
+		require.NoError(t, DB.B().InsertTuple(ctx, tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(i)}}))
+	}
+	dirtyRead := func(t *testing.T, level IsolationLevel) bool {
+		hf := mvccTable(t, 1, 2)
+		writer := NewTx()
+		insert(t, writer, hf, 3)
+		defer writer.Abort()
+		reader := NewTxWithOptions(&TxOptions{Isolation: level})
+		defer reader.Finish()
+		return len(scanTuples(t, reader.TxID, hf)) == 3
+	}
+	nonRepeatableRead := func(t *testing.T, level IsolationLevel) bool {
+		hf := mvccTable(t, 1, 2)
+		reader := NewTxWithOptions(&TxOptions{Isolation: level})
+		defer reader.Finish()
+		before := scanStrings(t, reader.TxID, hf)
+		writer := NewTx()
+		require.NoError(t, DB.B().UpdateTuple(ctx, writer.TxID, scanTuples(t, writer.TxID, hf)[0], &Tuple{TD: hf.TD, Fields: []Field{NewIntField(10)}}))
+		require.NoError(t, writer.Commit())
+		return assert.ObjectsAreEqual(before, []string{"int(1)", "int(2)"}) && !assert.ObjectsAreEqual(before, scanStrings(t, reader.TxID, hf))
+	}
+	phantom := func(t *testing.T, level IsolationLevel) bool {
+		hf := mvccTable(t, 1, 2)
+		reader := NewTxWithOptions(&TxOptions{Isolation: level})
+		defer reader.Finish()
+		before := len(scanTuples(t, reader.TxID, hf))
+		writer := NewTx()
+		insert(t, writer, hf, 3)
+		require.NoError(t, writer.Commit())
+		return before != len(scanTuples(t, reader.TxID, hf))
+	}
+	writeSkew := func(t *testing.T, level IsolationLevel) bool {
+		hf := mvccTable(t, 1, 2)
+		tx1 := NewTxWithOptions(&TxOptions{Isolation: level})
+		tx2 := NewTxWithOptions(&TxOptions{Isolation: level})
+		// both decide by the rows read, and write a row the other does not read
+		require.Len(t, scanTuples(t, tx1.TxID, hf), 2)
+		require.Len(t, scanTuples(t, tx2.TxID, hf), 2)
+		insert(t, tx1, hf, 3)
+		insert(t, tx2, hf, 4)
+		require.NoError(t, tx1.Commit())
+		err := tx2.Commit()
+		if err != nil {
+			assert.Equal(t, ErrSerializationFailure, err)
+			assert.Equal(t, []string{"int(1)", "int(2)", "int(3)"}, scanStrings(t, NewTxID(), hf))
+		}
+		return err == nil
+	}
+
+	var tests = []struct {
+		level                                                   IsolationLevel
+		dirtyRead, nonRepeatableRead, phantom, writeSkewAnomaly bool
+	}{
+		{ReadUncommitted, true, true, true, true},
+		{ReadCommitted, false, true, true, true},
+		{RepeatableRead, false, false, false, true},
+		{Serializable, false, false, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.level.String(), func(t *testing.T) {
+			assert.Equal(t, test.dirtyRead, dirtyRead(t, test.level), "dirty read")
+			assert.Equal(t, test.nonRepeatableRead, nonRepeatableRead(t, test.level), "non-repeatable read")
+			assert.Equal(t, test.phantom, phantom(t, test.level), "phantom")
+			assert.Equal(t, test.writeSkewAnomaly, writeSkew(t, test.level), "write skew")
+		})
+	}
+}
+
+// TestIsolationLevel_NonMVCC the tables not MVCC are read uncommitted by NewTx, and rejected above ReadUncommitted by NewTxWithOptions
+func TestIsolationLevel_NonMVCC(t *testing.T) {
+	ctx := context.Background()
+	name, err := TmpDataFile()
+	require.NoError(t, err)
+	hf, err := openTmpHeapFile(t, name, GetTupleDesc(1, "v"))
+	require.NoError(t, err)
+	DB.C().AddTable(hf, name)
+	insert := func(t *testing.T, tx *Tx, i int64) {
+		require.NoError(t, DB.B().InsertTuple(ctx, tx.TxID, hf.ID(), &Tuple{TD: hf.TD, Fields: []Field{NewIntField(i)}}))
+	}
+	tx := NewTx()
+	insert(t, tx, 1)
+	insert(t, tx, 2)
+	require.NoError(t, tx.Commit())
+
+	// NewTx only isolates the MVCC tables
+	for _, reader := range []*Tx{NewTxWithOptions(&TxOptions{Isolation: ReadUncommitted}), NewTx()} {
+		writer := NewTx()
+		insert(t, writer, 3)
+		assert.Len(t, scanTuples(t, reader.TxID, hf), 3, "dirty read")
+		require.NoError(t, writer.Abort())
+		assert.Len(t, scanTuples(t, reader.TxID, hf), 2, "non-repeatable read")
+		assert.NoError(t, reader.Commit())
+	}
+
+	for _, level := range []IsolationLevel{ReadCommitted, RepeatableRead, Serializable} {
+		t.Run(level.String(), func(t *testing.T) {
+			tx := NewTxWithOptions(&TxOptions{Isolation: level})
+			defer tx.Finish()
+			scan := NewSeqScan(tx.TxID, hf.ID(), "t")
+			assert.Equal(t, ErrIsolationNotSupported, scan.Open(ctx))
+			tuple := &Tuple{TD: hf.TD, Fields: []Field{NewIntField(3)}}
+			assert.Equal(t, ErrIsolationNotSupported, DB.B().InsertTuple(ctx, tx.TxID, hf.ID(), tuple))
+			old := scanTuples(t, NewTxID(), hf)[0]
+			assert.Equal(t, ErrIsolationNotSupported, DB.B().DeleteTuple(ctx, tx.TxID, old))
+			assert.Equal(t, ErrIsolationNotSupported, DB.B().UpdateTuple(ctx, tx.TxID, old, tuple))
+			assert.Len(t, scanTuples(t, NewTxID(), hf), 2)
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package newdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DecimalScale the number of digits after the decimal point of DecimalType
+	DecimalScale = 4
+	// DecimalPrecision the max number of digits of DecimalType
+	DecimalPrecision = 18
+	// DateLayout the readable layout of DateField
+	DateLayout = "2006-01-02"
+)
+
+var (
+	// FloatType enum of Type float64
+	FloatType = &Type{Name: "float64", Len: Sizeof(float64(0))}
+	// BoolType enum of Type bool
+	BoolType = &Type{Name: "bool", Len: Sizeof(false)}
+	// DateType enum of Type date, stored as days since unix epoch
+	DateType = &Type{Name: "date", Len: Sizeof(int64(0))}
+	// TimestampType enum of Type timestamp, stored as unix nanoseconds
+	TimestampType = &Type{Name: "timestamp", Len: Sizeof(int64(0))}
+	// DecimalType enum of Type decimal(DecimalPrecision, DecimalScale), stored as scaled int64
+	DecimalType = &Type{Name: "decimal", Len: Sizeof(int64(0))}
+
+	decimalFactor = int64(math.Pow10(DecimalScale))
+)
+
+// cmpResult apply op to the result of a three-way compare
+func cmpResult(op Op, cmp int) (ret bool) {
+	switch op {
+	case OpEquals, OpLike:
+		ret = cmp == 0
+	case OpGreaterThan:
+		ret = cmp > 0
+	case OpLessThan:
+		ret = cmp < 0
+	case OpLessThanOrEq:
+		ret = cmp <= 0
+	case OpGreaterThanOrEq:
+		ret = cmp >= 0
+	case OpNotEquals:
+		ret = cmp != 0
+	}
+	return
+}
+
+func cmpInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func putInt64Field(t *Type, val int64) (data []byte, err error) {
+	data = make([]byte, t.Len)
+	buffer := bytes.NewBuffer(data)
+	buffer.Reset()
+	err = binary.Write(buffer, DefaultOrder, val)
+	return
+}
+
+// FloatField float64 field
+type FloatField struct {
+	Val      float64
+	TypeReal *Type
+}
+
+var _ Field = (*FloatField)(nil)
+
+// NewFloatField constructor of FloatField
+func NewFloatField(val float64) Field {
+	return &FloatField{Val: val, TypeReal: FloatType}
+}
+
+// Type the type of float
+func (f FloatField) Type() *Type {
+	return f.TypeReal
+}
+
+// Compare compare with another FloatField, NaN is never equal to anything
+func (f FloatField) Compare(op Op, val Field) bool {
+	fV, ok := val.(*FloatField)
+	if !ok {
+		return false
+	}
+	if math.IsNaN(f.Val) || math.IsNaN(fV.Val) {
+		return op == OpNotEquals
+	}
+	switch {
+	case f.Val < fV.Val:
+		return cmpResult(op, -1)
+	case f.Val > fV.Val:
+		return cmpResult(op, 1)
+	}
+	return cmpResult(op, 0)
+}
+
+// String the readable FloatField
+func (f FloatField) String() string {
+	return fmt.Sprintf("float(%v)", f.Val)
+}
+
+// MarshalBinary implement encoding.BinaryMarshaler
+func (f FloatField) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, f.TypeReal.Len)
+	buffer := bytes.NewBuffer(data)
+	buffer.Reset()
+	err = binary.Write(buffer, DefaultOrder, f.Val)
+	return
+}
+
+// UnmarshalBinary implement encoding.BinaryUnmarshaler
+func (f *FloatField) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	return binary.Read(reader, DefaultOrder, &f.Val)
+}
+
+// MarshalText implement encoding.TextMarshaler
+func (f FloatField) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatFloat(f.Val, 'g', -1, 64)), nil
+}
+
+// UnmarshalText implement encoding.TextUnmarshaler
+func (f *FloatField) UnmarshalText(text []byte) (err error) {
+	f.Val, err = strconv.ParseFloat(strings.TrimSpace(string(text)), 64)
+	return
+}
+
+// BoolField bool field, false < true
+type BoolField struct {
+	Val      bool
+	TypeReal *Type
+}
+
+var _ Field = (*BoolField)(nil)
+
+// NewBoolField constructor of BoolField
+func NewBoolField(val bool) Field {
+	return &BoolField{Val: val, TypeReal: BoolType}
+}
+
+// Type the type of bool
+func (b BoolField) Type() *Type {
+	return b.TypeReal
+}
+
+func boolToInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Compare compare with another BoolField
+func (b BoolField) Compare(op Op, val Field) bool {
+	bV, ok := val.(*BoolField)
+	if !ok {
+		return false
+	}
+	return cmpResult(op, cmpInt64(boolToInt64(b.Val), boolToInt64(bV.Val)))
+}
+
+// String the readable BoolField
+func (b BoolField) String() string {
+	return fmt.Sprintf("bool(%v)", b.Val)
+}
+
+// MarshalBinary implement encoding.BinaryMarshaler
+func (b BoolField) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, b.TypeReal.Len)
+	if b.Val {
+		data[0] = 1
+	}
+	return
+}
+
+// UnmarshalBinary implement encoding.BinaryUnmarshaler
+func (b *BoolField) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("bool field want 1 byte, get %v", len(data))
+	}
+	b.Val = data[0] != 0
+	return nil
+}
+
+// MarshalText implement encoding.TextMarshaler
+func (b BoolField) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatBool(b.Val)), nil
+}
+
+// UnmarshalText implement encoding.TextUnmarshaler, see strconv.ParseBool
+func (b *BoolField) UnmarshalText(text []byte) (err error) {
+	b.Val, err = strconv.ParseBool(strings.TrimSpace(string(text)))
+	return
+}
+
+// DateField date field, without time of day and location
+type DateField struct {
+	// Days days since 1970-01-01
+	Days     int64
+	TypeReal *Type
+}
+
+var _ Field = (*DateField)(nil)
+
+// NewDateField constructor of DateField, only the year/month/day of t is kept
+func NewDateField(t time.Time) Field {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return &DateField{Days: day.Unix() / 86400, TypeReal: DateType}
+}
+
+// Time the date as time.Time at 00:00 UTC
+func (d DateField) Time() time.Time {
+	return time.Unix(d.Days*86400, 0).UTC()
+}
+
+// Type the type of date
+func (d DateField) Type() *Type {
+	return d.TypeReal
+}
+
+// Compare compare with another DateField
+func (d DateField) Compare(op Op, val Field) bool {
+	dV, ok := val.(*DateField)
+	if !ok {
+		return false
+	}
+	return cmpResult(op, cmpInt64(d.Days, dV.Days))
+}
+
+// String the readable DateField
+func (d DateField) String() string {
+	return fmt.Sprintf("date(%v)", d.Time().Format(DateLayout))
+}
+
+// MarshalBinary implement encoding.BinaryMarshaler
+func (d DateField) MarshalBinary() ([]byte, error) {
+	return putInt64Field(d.TypeReal, d.Days)
+}
+
+// UnmarshalBinary implement encoding.BinaryUnmarshaler
+func (d *DateField) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	return binary.Read(reader, DefaultOrder, &d.Days)
+}
+
+// MarshalText implement encoding.TextMarshaler, in DateLayout
+func (d DateField) MarshalText() ([]byte, error) {
+	return []byte(d.Time().Format(DateLayout)), nil
+}
+
+// UnmarshalText implement encoding.TextUnmarshaler, in DateLayout
+func (d *DateField) UnmarshalText(text []byte) error {
+	t, err := time.Parse(DateLayout, strings.TrimSpace(string(text)))
+	if err != nil {
+		return err
+	}
+	d.Days = t.Unix() / 86400
+	return nil
+}
+
+// TimestampField timestamp field with nanosecond precision, always in UTC
+type TimestampField struct {
+	Val      time.Time
+	TypeReal *Type
+}
+
+var _ Field = (*TimestampField)(nil)
+
+// NewTimestampField constructor of TimestampField
+func NewTimestampField(t time.Time) Field {
+	return &TimestampField{Val: time.Unix(0, t.UnixNano()).UTC(), TypeReal: TimestampType}
+}
+
+// Type the type of timestamp
+func (ts TimestampField) Type() *Type {
+	return ts.TypeReal
+}
+
+// Compare compare with another TimestampField
+func (ts TimestampField) Compare(op Op, val Field) bool {
+	tV, ok := val.(*TimestampField)
+	if !ok {
+		return false
+	}
+	return cmpResult(op, cmpInt64(ts.Val.UnixNano(), tV.Val.UnixNano()))
+}
+
+// String the readable TimestampField
+func (ts TimestampField) String() string {
+	return fmt.Sprintf("timestamp(%v)", ts.Val.Format(time.RFC3339Nano))
+}
+
+// MarshalBinary implement encoding.BinaryMarshaler
+func (ts TimestampField) MarshalBinary() ([]byte, error) {
+	return putInt64Field(ts.TypeReal, ts.Val.UnixNano())
+}
+
+// UnmarshalBinary implement encoding.BinaryUnmarshaler
+func (ts *TimestampField) UnmarshalBinary(data []byte) error {
+	var nano int64
+	reader := bytes.NewReader(data)
+	if err := binary.Read(reader, DefaultOrder, &nano); err != nil {
+		return err
+	}
+	ts.Val = time.Unix(0, nano).UTC()
+	return nil
+}
+
+// MarshalText implement encoding.TextMarshaler, in time.RFC3339Nano
+func (ts TimestampField) MarshalText() ([]byte, error) {
+	return []byte(ts.Val.Format(time.RFC3339Nano)), nil
+}
+
+// UnmarshalText implement encoding.TextUnmarshaler, in time.RFC3339Nano
+func (ts *TimestampField) UnmarshalText(text []byte) error {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(text)))
+	if err != nil {
+		return err
+	}
+	ts.Val = time.Unix(0, t.UnixNano()).UTC()
+	return nil
+}
+
+// DecimalField fixed-precision decimal field
+//
+// the value is Unscaled / 10^DecimalScale
+type DecimalField struct {
+	Unscaled int64
+	TypeReal *Type
+}
+
+var _ Field = (*DecimalField)(nil)
+
+// NewDecimalField constructor of DecimalField, val is Unscaled, eg: 12345 means 1.2345
+func NewDecimalField(unscaled int64) Field {
+	return &DecimalField{Unscaled: unscaled, TypeReal: DecimalType}
+}
+
+// ParseDecimal parse decimal string like -12.34 to DecimalField,
+// more than DecimalScale digits after the point is error
+func ParseDecimal(s string) (Field, error) {
+	raw := strings.TrimSpace(s)
+	neg := strings.HasPrefix(raw, "-")
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "-"), "+")
+	parts := strings.SplitN(raw, ".", 2)
+	intPart, fracPart := parts[0], ""
+	if len(parts) == 2 {
+		fracPart = parts[1]
+	}
+	if intPart == "" && fracPart == "" {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	if len(fracPart) > DecimalScale {
+		return nil, fmt.Errorf("decimal %q has more than %v digits after the point", s, DecimalScale)
+	}
+	if len(intPart) > DecimalPrecision-DecimalScale {
+		return nil, fmt.Errorf("decimal %q out of range", s)
+	}
+	fracPart += strings.Repeat("0", DecimalScale-len(fracPart))
+	var unscaled int64
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("invalid decimal %q", s)
+		}
+		unscaled = unscaled*10 + int64(c-'0')
+	}
+	if neg {
+		unscaled = -unscaled
+	}
+	return NewDecimalField(unscaled), nil
+}
+
+// Type the type of decimal
+func (d DecimalField) Type() *Type {
+	return d.TypeReal
+}
+
+// Compare compare with another DecimalField
+func (d DecimalField) Compare(op Op, val Field) bool {
+	dV, ok := val.(*DecimalField)
+	if !ok {
+		return false
+	}
+	return cmpResult(op, cmpInt64(d.Unscaled, dV.Unscaled))
+}
+
+// Decimal the readable decimal without type name, eg: -1.2300
+func (d DecimalField) Decimal() string {
+	sign, abs := "", d.Unscaled
+	if abs < 0 {
+		sign, abs = "-", -abs
+	}
+	return fmt.Sprintf("%v%d.%0*d", sign, abs/decimalFactor, DecimalScale, abs%decimalFactor)
+}
+
+// String the readable DecimalField
+func (d DecimalField) String() string {
+	return fmt.Sprintf("decimal(%v)", d.Decimal())
+}
+
+// MarshalBinary implement encoding.BinaryMarshaler
+func (d DecimalField) MarshalBinary() ([]byte, error) {
+	return putInt64Field(d.TypeReal, d.Unscaled)
+}
+
+// UnmarshalBinary implement encoding.BinaryUnmarshaler
+func (d *DecimalField) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	return binary.Read(reader, DefaultOrder, &d.Unscaled)
+}
+
+// MarshalText implement encoding.TextMarshaler, see Decimal
+func (d DecimalField) MarshalText() ([]byte, error) {
+	return []byte(d.Decimal()), nil
+}
+
+// UnmarshalText implement encoding.TextUnmarshaler, see ParseDecimal
+func (d *DecimalField) UnmarshalText(text []byte) error {
+	f, err := ParseDecimal(string(text))
+	if err != nil {
+		return err
+	}
+	d.Unscaled = f.(*DecimalField).Unscaled
+	return nil
+}
@@ -0,0 +1,102 @@
+package newdb
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFields_MarshalParse(t *testing.T) {
+	ts := time.Date(2019, 10, 1, 8, 30, 15, 123456789, time.FixedZone("CST", 8*3600))
+	var tests = []struct {
+		name   string
+		field  Field
+		typ    *Type
+		wanted string
+	}{
+		{"float", NewFloatField(3.25), FloatType, "float(3.25)"},
+		{"float_neg", NewFloatField(-0.5), FloatType, "float(-0.5)"},
+		{"bool_true", NewBoolField(true), BoolType, "bool(true)"},
+		{"bool_false", NewBoolField(false), BoolType, "bool(false)"},
+		{"date", NewDateField(ts), DateType, "date(2019-10-01)"},
+		{"date_before_epoch", NewDateField(time.Date(1960, 2, 29, 0, 0, 0, 0, time.UTC)), DateType, "date(1960-02-29)"},
+		{"timestamp", NewTimestampField(ts), TimestampType, "timestamp(2019-10-01T00:30:15.123456789Z)"},
+		{"decimal", NewDecimalField(123456), DecimalType, "decimal(12.3456)"},
+		{"decimal_neg", NewDecimalField(-5), DecimalType, "decimal(-0.0005)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.typ, test.field.Type())
+			assert.Equal(t, test.wanted, test.field.String())
+			buf, err := test.field.MarshalBinary()
+			require.NoError(t, err)
+			assert.Len(t, buf, int(test.typ.Len))
+			parsed, err := test.typ.Parse(bytes.NewReader(buf))
+			require.NoError(t, err)
+			assert.Equal(t, test.field, parsed)
+		})
+	}
+}
+
+func TestFields_Compare(t *testing.T) {
+	day := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	pairs := []struct {
+		name       string
+		less, more Field
+	}{
+		{"float", NewFloatField(-1.5), NewFloatField(2)},
+		{"bool", NewBoolField(false), NewBoolField(true)},
+		{"date", NewDateField(day), NewDateField(day.AddDate(0, 0, 1))},
+		{"timestamp", NewTimestampField(day), NewTimestampField(day.Add(time.Nanosecond))},
+		{"decimal", NewDecimalField(-100), NewDecimalField(99)},
+	}
+	for _, p := range pairs {
+		t.Run(p.name, func(t *testing.T) {
+			assert.True(t, p.less.Compare(OpLessThan, p.more))
+			assert.True(t, p.less.Compare(OpLessThanOrEq, p.more))
+			assert.True(t, p.less.Compare(OpNotEquals, p.more))
+			assert.True(t, p.more.Compare(OpGreaterThan, p.less))
+			assert.True(t, p.more.Compare(OpGreaterThanOrEq, p.less))
+			assert.True(t, p.less.Compare(OpEquals, p.less))
+			assert.True(t, p.less.Compare(OpLike, p.less))
+			assert.True(t, p.less.Compare(OpGreaterThanOrEq, p.less))
+			assert.False(t, p.less.Compare(OpEquals, p.more))
+			assert.False(t, p.less.Compare(OpGreaterThan, p.more))
+			assert.False(t, p.less.Compare(Op(999), p.less))
+			assert.False(t, p.less.Compare(OpEquals, NewIntField(0)), "different type never match")
+		})
+	}
+	nan := NewFloatField(math.NaN())
+	assert.False(t, nan.Compare(OpEquals, nan))
+	assert.True(t, nan.Compare(OpNotEquals, nan))
+}
+
+func TestParseDecimal(t *testing.T) {
+	var tests = []struct {
+		in     string
+		wanted int64
+		err    bool
+	}{
+		{"12.34", 123400, false},
+		{"-0.5", -5000, false},
+		{"+7", 70000, false},
+		{".25", 2500, false},
+		{"1.23456", 0, true},
+		{"1a", 0, true},
+		{"", 0, true},
+		{"123456789012345", 0, true},
+	}
+	for _, test := range tests {
+		f, err := ParseDecimal(test.in)
+		if test.err {
+			assert.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.wanted, f.(*DecimalField).Unscaled, test.in)
+	}
+}
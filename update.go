@@ -0,0 +1,203 @@
+package newdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Expr expression evaluated against one tuple
+type Expr interface {
+	fmt.Stringer
+	// Eval evaluate the expression with the tuple
+	Eval(*Tuple) (Field, error)
+}
+
+var (
+	_ Expr = (*ConstExpr)(nil)
+	_ Expr = (*FieldExpr)(nil)
+)
+
+// ConstExpr constant expression, always Eval to Val
+type ConstExpr struct {
+	Val Field
+}
+
+// Eval return the constant
+func (e ConstExpr) Eval(*Tuple) (Field, error) {
+	return e.Val, nil
+}
+
+func (e ConstExpr) String() string {
+	return e.Val.String()
+}
+
+// FieldExpr reference the Index-th field of the tuple
+type FieldExpr struct {
+	Index int
+}
+
+// Eval return the Index-th field of tuple
+func (e FieldExpr) Eval(tuple *Tuple) (Field, error) {
+	if e.Index < 0 || e.Index >= len(tuple.Fields) {
+		return nil, fmt.Errorf("field %v out of range [0, %v)", e.Index, len(tuple.Fields))
+	}
+	return tuple.Fields[e.Index], nil
+}
+
+func (e FieldExpr) String() string {
+	return fmt.Sprintf("$%v", e.Index)
+}
+
+// Assignment set the Field-th field to the result of Expr
+type Assignment struct {
+	Field int
+	Expr  Expr
+}
+
+func (a Assignment) String() string {
+	return fmt.Sprintf("$%v=%v", a.Field, a.Expr.String())
+}
+
+// applyAssignments build a new tuple from tuple with assignments applied, the tuple is not modified
+func applyAssignments(assignments []Assignment, tuple *Tuple) (*Tuple, error) {
+	ret := &Tuple{TD: tuple.TD, Fields: make([]Field, len(tuple.Fields))}
+	copy(ret.Fields, tuple.Fields)
+	for _, a := range assignments {
+		if a.Field < 0 || a.Field >= len(ret.Fields) {
+			return nil, fmt.Errorf("assign field %v out of range [0, %v)", a.Field, len(ret.Fields))
+		}
+		// evaluate against the original tuple, so a=b, b=a swaps the fields
+		val, err := a.Expr.Eval(tuple)
+		if err != nil {
+			return nil, err
+		}
+		if want := ret.Fields[a.Field].Type(); val.Type().Name != want.Name {
+			return nil, fmt.Errorf("assign %v to field %v of type %v", val.Type(), a.Field, want)
+		}
+		ret.Fields[a.Field] = val
+	}
+	return ret, nil
+}
+
+// CountTupleDesc the TupleDesc of the tuple returned by Update and Insert
+func CountTupleDesc() *TupleDesc {
+	return NewTupleDesc([]*Type{IntType}, []string{"count"})
+}
+
+var _ OpIterator = (*Update)(nil)
+
+// Update apply the assignments to every tuple read from the child,
+// and return one tuple with the number of updated tuples
+type Update struct {
+	TxID        *TxID
+	Child       OpIterator
+	Assignments []Assignment
+
+	ctx  context.Context
+	open bool
+	done bool
+
+	Err error
+}
+
+// NewUpdate create new Update, the tuples of child must have RecordID, eg: SeqScan
+func NewUpdate(txID *TxID, child OpIterator, assignments []Assignment) *Update {
+	return &Update{TxID: txID, Child: child, Assignments: assignments}
+}
+
+// Open open the child
+func (u *Update) Open(ctx context.Context) error {
+	u.ctx = ctx
+	if u.Err = u.Child.Open(ctx); u.Err != nil {
+		return u.Err
+	}
+	u.open = true
+	u.done = false
+	return nil
+}
+
+// Close close the child
+func (u *Update) Close() {
+	u.Child.Close()
+	u.open = false
+}
+
+// HasNext the count tuple is only returned once
+func (u *Update) HasNext() bool {
+	if !u.open {
+		u.Err = fmt.Errorf("Operator not yet open")
+		return false
+	}
+	return !u.done
+}
+
+// Next do the update, and return the count tuple
+func (u *Update) Next() *Tuple {
+	if !u.HasNext() {
+		if u.Err == nil {
+			u.Err = fmt.Errorf("no such element")
+		}
+		return nil
+	}
+	u.done = true
+	// read all tuples first, so the tuples moved by update will not be seen twice
+	var olds []*Tuple
+	for u.Child.HasNext() {
+		tuple := u.Child.Next()
+		if u.Err = u.Child.Error(); u.Err != nil {
+			abortIfDone(u.ctx, u.TxID)
+			return nil
+		}
+		olds = append(olds, tuple)
+	}
+	if u.Err = u.Child.Error(); u.Err != nil {
+		abortIfDone(u.ctx, u.TxID)
+		return nil
+	}
+	for _, old := range olds {
+		tuple, err := applyAssignments(u.Assignments, old)
+		if err != nil {
+			u.Err = err
+			return nil
+		}
+		if u.Err = DB.B().UpdateTuple(u.ctx, u.TxID, old, tuple); u.Err != nil {
+			abortIfDone(u.ctx, u.TxID)
+			return nil
+		}
+	}
+	return &Tuple{TD: CountTupleDesc(), Fields: []Field{NewIntField(int64(len(olds)))}}
+}
+
+// Rewind rewind the child, Update could be done again
+func (u *Update) Rewind() error {
+	if u.Err = u.Child.Rewind(); u.Err != nil {
+		return u.Err
+	}
+	u.done = false
+	return nil
+}
+
+// TupleDesc the count TupleDesc
+func (u *Update) TupleDesc() *TupleDesc {
+	return CountTupleDesc()
+}
+
+// Explain one count tuple, the cost is to read the child
+func (u *Update) Explain() *PlanNode {
+	child := u.Child.Explain()
+	var assignments []string
+	for _, a := range u.Assignments {
+		assignments = append(assignments, a.String())
+	}
+	return &PlanNode{Operator: "Update", Detail: strings.Join(assignments, ", "), Rows: 1, Cost: child.Cost + cpuCost(child.Rows), Children: []*PlanNode{child}}
+}
+
+func (u *Update) children() []*OpIterator {
+	return []*OpIterator{&u.Child}
+}
+
+// Error return error
+func (u *Update) Error() error {
+	return u.Err
+}
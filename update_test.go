@@ -0,0 +1,65 @@
+package newdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignment_Apply(t *testing.T) {
+	td := GetTupleDesc(3, "f")
+	tuple := &Tuple{TD: td, Fields: GetFields(3)}
+	ret, err := applyAssignments([]Assignment{
+		{Field: 0, Expr: FieldExpr{Index: 1}},
+		{Field: 1, Expr: FieldExpr{Index: 0}},
+		{Field: 2, Expr: ConstExpr{Val: NewIntField(9)}},
+	}, tuple)
+	require.NoError(t, err)
+	assert.Equal(t, "int(1)\tint(0)\tint(9)", ret.String())
+	assert.Equal(t, "int(0)\tint(1)\tint(2)", tuple.String(), "the origin tuple is not modified")
+
+	_, err = applyAssignments([]Assignment{{Field: 3, Expr: FieldExpr{Index: 0}}}, tuple)
+	assert.Error(t, err)
+	_, err = applyAssignments([]Assignment{{Field: 0, Expr: FieldExpr{Index: 3}}}, tuple)
+	assert.Error(t, err)
+	_, err = applyAssignments([]Assignment{{Field: 0, Expr: ConstExpr{Val: NewBoolField(true)}}}, tuple)
+	assert.Error(t, err, "type mismatch")
+}
+
+func TestUpdate(t *testing.T) {
+	tableID, err := RandDBFile(2)
+	require.NoError(t, err)
+	td := DB.C().GetTableByID(tableID).TupleDesc()
+	txID := NewTxID()
+	for i := 0; i < 5; i++ {
+		tuple := &Tuple{TD: td, Fields: []Field{NewIntField(int64(i)), NewIntField(0)}}
+		require.NoError(t, DB.B().InsertTuple(context.Background(), txID, tableID, tuple))
+	}
+
+	pred := &Predicate{Field: 0, Op: OpGreaterThanOrEq, Operand: NewIntField(3)}
+	update := NewUpdate(txID, NewFilter(pred, NewSeqScan(txID, tableID, "t")), []Assignment{
+		{Field: 1, Expr: FieldExpr{Index: 0}},
+	})
+	assert.Equal(t, CountTupleDesc(), update.TupleDesc())
+	require.NoError(t, update.Open(context.Background()))
+	require.True(t, update.HasNext())
+	count := update.Next()
+	require.NoError(t, update.Error())
+	assert.Equal(t, "int(2)", count.String())
+	assert.False(t, update.HasNext())
+	update.Close()
+
+	scan := NewSeqScan(txID, tableID, "t")
+	require.NoError(t, scan.Open(context.Background()))
+	var got []string
+	for scan.HasNext() {
+		tuple := scan.Next()
+		require.NotNil(t, tuple)
+		got = append(got, tuple.String())
+	}
+	assert.Equal(t, []string{
+		"int(0)\tint(0)", "int(1)\tint(0)", "int(2)\tint(0)", "int(3)\tint(3)", "int(4)\tint(4)",
+	}, got)
+}
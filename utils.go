@@ -13,8 +13,7 @@ func Sizeof(t interface{}) uintptr {
 
 func assertEqual(a, b interface{}) {
 	// TODO: implement
-	logger := log.WithField("name", "assert")
-	logger.Debug(a, b)
+	dbL.Debug("assert equal", "a", a, "b", b)
 }
 
 const charset = "abcdefghijklmnopqrstuvwxyz" +